@@ -30,6 +30,13 @@ import (
 const (
 	serverFlagName = "server"
 	serverAlias    = "s"
+
+	selectorFlagName  = "selector"
+	selectorFlagUsage = `Only target nodes matching a selector expression, e.g.
+'label.room in (kitchen, hall) && !name~test || orientation=portrait'.
+Terms test name, orientation, label (label keys) or label.KEY (a label's
+value) using = (or :), !=, ~ (contains), !~, in (...), notin (...), exists
+or !exists, and combine with !, && and || and parentheses.`
 )
 
 // barnacleCmd represents the barnacle command
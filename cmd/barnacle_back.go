@@ -0,0 +1,61 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/cobra"
+)
+
+// barnacleBackCmd represents the back command
+var barnacleBackCmd = &cobra.Command{
+	Use:   "back <node>",
+	Short: "Put back what a node showed before.",
+	Long: `Put back the image a node showed before the one it is showing now,
+rendered as it was then. Repeat to step further back through its history.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("back called")
+
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		err = client.HistoryMove(args[0], message.HistoryBack, force)
+		if err != nil {
+			slog.Error("back returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleCmd.AddCommand(barnacleBackCmd)
+
+	barnacleBackCmd.Flags().Bool("force", false, "Show now, ignoring the node's quiet hours and refresh budget.")
+}
@@ -22,7 +22,7 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"log/slog"
 
 	"github.com/spf13/cobra"
 )
@@ -33,7 +33,7 @@ var barnacleConfigCmd = &cobra.Command{
 	Short: "Configuration for a node",
 	Long:  `Configuration for a node.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("config called")
+		slog.Debug("config called")
 	},
 }
 
@@ -23,10 +23,11 @@ package cmd
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/client"
 	"github.com/redgoat650/barnacle-net/internal/deploy"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 )
 
@@ -36,7 +37,7 @@ var barnacleConfigSetCmd = &cobra.Command{
 	Short: "Set configuration for a node",
 	Long:  `Set configuration for a node.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("set called", args)
+		slog.Debug("set called", "args", args)
 
 		nodeDeploySettings, err := deploy.GetValidNodeDeploySettings()
 		if err != nil {
@@ -44,7 +45,7 @@ var barnacleConfigSetCmd = &cobra.Command{
 		}
 
 		if err := client.ConfigSet(nodeDeploySettings...); err != nil {
-			log.Println("error setting config:", err)
+			slog.Error("error setting config", logging.Err(err))
 		}
 
 		return nil
@@ -24,10 +24,11 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/config"
 	"github.com/redgoat650/barnacle-net/internal/deploy"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -38,7 +39,7 @@ var barnacleDeployCmd = &cobra.Command{
 	Short: "Deploy barnacle to all nodes",
 	Long:  `Deploy barnacle to all nodes in the config file.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("deploy called")
+		slog.Debug("deploy called")
 
 		nodeDeploySettings, err := deploy.GetValidNodeDeploySettings()
 		if err != nil {
@@ -57,7 +58,7 @@ var barnacleDeployCmd = &cobra.Command{
 
 		err = deploy.DeployNodes(img, servAddr, nodeDeploySettings...)
 		if err != nil {
-			log.Println("error deploying nodes:", err)
+			slog.Error("error deploying nodes", logging.Err(err))
 		}
 
 		return nil
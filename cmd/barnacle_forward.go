@@ -0,0 +1,62 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/cobra"
+)
+
+// barnacleForwardCmd represents the forward command
+var barnacleForwardCmd = &cobra.Command{
+	Use:   "forward <node>",
+	Short: "Undo stepping a node back through its history.",
+	Long: `Show a node the image it showed before it was last stepped back. As
+in a browser, there is nothing to step forward to once a new image has
+been shown.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("forward called")
+
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		err = client.HistoryMove(args[0], message.HistoryForward, force)
+		if err != nil {
+			slog.Error("forward returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleCmd.AddCommand(barnacleForwardCmd)
+
+	barnacleForwardCmd.Flags().Bool("force", false, "Show now, ignoring the node's quiet hours and refresh budget.")
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// barnacleHistoryCmd represents the history command
+var barnacleHistoryCmd = &cobra.Command{
+	Use:   "history <node>",
+	Short: "Show what a node has been shown.",
+	Long: `Show what a node has been shown, oldest first: each image's hash, how it
+was rendered, when, and who or what asked for it. Use --format csv to
+export it to a spreadsheet. Step through the history with "barnacle back"
+and "barnacle forward".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("history called")
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+
+		err = client.History(args[0], format)
+		if err != nil {
+			slog.Error("history returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleCmd.AddCommand(barnacleHistoryCmd)
+
+	barnacleHistoryCmd.Flags().String("format", client.HistoryJSON, "Output format [json, csv].")
+}
@@ -22,15 +22,17 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 )
 
 const (
 	refreshFlagKey   = "refresh"
 	refreshFlagAlias = "r"
+	clientsFlagKey   = "clients"
 )
 
 // barnacleListCmd represents the list command
@@ -40,16 +42,26 @@ var barnacleListCmd = &cobra.Command{
 	Short:   "Query a list of barnacles connected to the net.",
 	Long:    `Query a list of barnacles connected to the net.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		log.Println("list called")
+		slog.Debug("list called")
 
 		r, err := cmd.Flags().GetBool(refreshFlagKey)
 		if err != nil {
 			return err
 		}
 
-		err = client.ListNodes(r)
+		clients, err := cmd.Flags().GetBool(clientsFlagKey)
 		if err != nil {
-			log.Println("list nodes returned error:", err)
+			return err
+		}
+
+		sel, err := cmd.Flags().GetString(selectorFlagName)
+		if err != nil {
+			return err
+		}
+
+		err = client.ListNodes(r, clients, sel)
+		if err != nil {
+			slog.Error("list nodes returned error", logging.Err(err))
 		}
 
 		return nil
@@ -60,4 +72,6 @@ func init() {
 	barnacleCmd.AddCommand(barnacleListCmd)
 
 	barnacleListCmd.Flags().BoolP(refreshFlagKey, refreshFlagAlias, false, "Re-identify all connected nodes. If false, just returns current server state.")
+	barnacleListCmd.Flags().Bool(clientsFlagKey, false, "Also list CLI clients connected to the server.")
+	barnacleListCmd.Flags().String(selectorFlagName, "", selectorFlagUsage)
 }
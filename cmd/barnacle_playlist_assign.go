@@ -0,0 +1,79 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// barnaclePlaylistAssignCmd represents the playlist assign command
+var barnaclePlaylistAssignCmd = &cobra.Command{
+	Use:   "assign <name>",
+	Short: "Choose the nodes a playlist is shown on.",
+	Long: `Choose the nodes a playlist is shown on, replacing any earlier
+assignment. Nodes may be named directly, or selected by label or selector
+expression; a node selected this way must have every label given and match
+the selector.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("playlist assign called")
+
+		nodes, err := cmd.Flags().GetStringSlice("node")
+		if err != nil {
+			return err
+		}
+
+		labels, err := cmd.Flags().GetStringSlice("label")
+		if err != nil {
+			return err
+		}
+
+		sel, err := cmd.Flags().GetString(selectorFlagName)
+		if err != nil {
+			return err
+		}
+
+		if len(nodes) == 0 && len(labels) == 0 && sel == "" {
+			return errors.New("at least one --node, --label or --selector is required")
+		}
+
+		err = client.AssignPlaylist(args[0], nodes, labels, sel)
+		if err != nil {
+			slog.Error("assign playlist returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnaclePlaylistCmd.AddCommand(barnaclePlaylistAssignCmd)
+
+	barnaclePlaylistAssignCmd.Flags().StringSliceP("node", "n", nil, "Names of nodes to show the playlist on.")
+	barnaclePlaylistAssignCmd.Flags().StringSliceP("label", "l", nil, "Show the playlist on nodes with these labels, each a key or key=value.")
+	barnaclePlaylistAssignCmd.Flags().String(selectorFlagName, "", selectorFlagUsage)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+const (
+	dwellFlagName   = "dwell"
+	shuffleFlagName = "shuffle"
+)
+
+// barnaclePlaylistCreateCmd represents the playlist create command
+var barnaclePlaylistCreateCmd = &cobra.Command{
+	Use:   "create <name> <image>[@dwell]...",
+	Short: "Create a playlist of images stored on the server.",
+	Long: `Create a playlist of images stored on the server, replacing any
+playlist of the same name. Each image is shown for the playlist dwell time
+unless it gives its own, e.g. "sunset.png@1h".`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("playlist create called")
+
+		dwell, err := cmd.Flags().GetDuration(dwellFlagName)
+		if err != nil {
+			return err
+		}
+
+		shuffle, err := cmd.Flags().GetBool(shuffleFlagName)
+		if err != nil {
+			return err
+		}
+
+		fit, err := cmd.Flags().GetString("fit")
+		if err != nil {
+			return err
+		}
+
+		err = client.CreatePlaylist(args[0], dwell, shuffle, fit, args[1:]...)
+		if err != nil {
+			slog.Error("create playlist returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnaclePlaylistCmd.AddCommand(barnaclePlaylistCreateCmd)
+
+	barnaclePlaylistCreateCmd.Flags().Duration(dwellFlagName, 30*time.Minute, "How long each image is shown for.")
+	barnaclePlaylistCreateCmd.Flags().Bool(shuffleFlagName, false, "Show images in a random order, reshuffled on each pass.")
+	barnaclePlaylistCreateCmd.Flags().StringP("fit", "f", "crop", "Crop or Pad images to fit [crop, pad].")
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+const (
+	resumeFlagName = "resume"
+)
+
+// barnaclePlaylistPauseCmd represents the playlist pause command
+var barnaclePlaylistPauseCmd = &cobra.Command{
+	Use:   "pause <name>",
+	Short: "Stop a playlist on its current image.",
+	Long: `Stop a playlist on its current image. With --resume, restart it
+from the next image.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("playlist pause called")
+
+		resume, err := cmd.Flags().GetBool(resumeFlagName)
+		if err != nil {
+			return err
+		}
+
+		err = client.PausePlaylist(args[0], !resume)
+		if err != nil {
+			slog.Error("pause playlist returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnaclePlaylistCmd.AddCommand(barnaclePlaylistPauseCmd)
+
+	barnaclePlaylistPauseCmd.Flags().Bool(resumeFlagName, false, "Resume the playlist instead.")
+}
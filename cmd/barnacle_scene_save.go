@@ -0,0 +1,67 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// barnacleSceneSaveCmd represents the scene save command
+var barnacleSceneSaveCmd = &cobra.Command{
+	Use:   "save <name>",
+	Short: "Save what nodes are showing now as a scene.",
+	Long: `Save the image, and how it is fit, that each node is showing now as a
+scene, replacing any scene of the same name. With no --node or --selector,
+every node showing an image is saved.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("scene save called")
+
+		nodes, err := cmd.Flags().GetStringSlice("node")
+		if err != nil {
+			return err
+		}
+
+		sel, err := cmd.Flags().GetString(selectorFlagName)
+		if err != nil {
+			return err
+		}
+
+		err = client.SaveScene(args[0], nodes, sel)
+		if err != nil {
+			slog.Error("save scene returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleSceneCmd.AddCommand(barnacleSceneSaveCmd)
+
+	barnacleSceneSaveCmd.Flags().StringSliceP("node", "n", nil, "Name of a node to save. May be repeated.")
+	barnacleSceneSaveCmd.Flags().String(selectorFlagName, "", selectorFlagUsage)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// barnacleSceneSetCmd represents the scene set command
+var barnacleSceneSetCmd = &cobra.Command{
+	Use:   "set <file>",
+	Short: "Create or replace a scene from a YAML or JSON file.",
+	Long: `Create or replace a scene from a YAML or JSON file, or from stdin if
+the file is "-". Each image is shown on the nodes its target selects, by
+name or selector. Where several images target one node, the last wins.
+Fit policy and saturation are optional. For example:
+
+  name: xmas
+  images:
+    - target:
+        selector: room=lounge
+      image: tree.png
+      fitPolicy: padToFit
+    - target:
+        nodes: [hallway]
+      image: wreath.png
+      saturation: 0.8`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("scene set called")
+
+		err := client.SetScene(args[0])
+		if err != nil {
+			slog.Error("set scene returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleSceneCmd.AddCommand(barnacleSceneSetCmd)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+const (
+	atFlagName = "at"
+)
+
+// barnacleSchedulePreviewCmd represents the schedule preview command
+var barnacleSchedulePreviewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Show what a node is scheduled to display.",
+	Long: `Show what a node is scheduled to display, and which schedule rule
+decides it. Times are local unless given in RFC 3339 with a zone; a bare
+time of day means today.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("schedule preview called")
+
+		node, err := cmd.Flags().GetString("node")
+		if err != nil {
+			return err
+		}
+
+		at, err := cmd.Flags().GetString(atFlagName)
+		if err != nil {
+			return err
+		}
+
+		err = client.PreviewSchedule(node, at)
+		if err != nil {
+			slog.Error("preview schedule returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleScheduleCmd.AddCommand(barnacleSchedulePreviewCmd)
+
+	barnacleSchedulePreviewCmd.Flags().StringP("node", "n", "", "Name of the node to preview.")
+	barnacleSchedulePreviewCmd.MarkFlagRequired("node")
+	barnacleSchedulePreviewCmd.Flags().String(atFlagName, "", "Time to preview, e.g. \"07:30\" or \"2024-01-02 07:30\". Defaults to now.")
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// barnacleScheduleSetCmd represents the schedule set command
+var barnacleScheduleSetCmd = &cobra.Command{
+	Use:   "set <file>",
+	Short: "Create or replace a schedule from a JSON file.",
+	Long: `Create or replace a schedule from a JSON file, or from stdin if the
+file is "-". For example, to show a calendar on kitchen frames on weekday
+mornings, art the rest of the day and nothing overnight:
+
+  {
+    "name": "kitchen",
+    "target": {"selectors": [{"key": "hasLabel", "value": "kitchen"}]},
+    "timezone": "America/Los_Angeles",
+    "rules": [
+      {"cron": "* 6-8 * * mon-fri", "playlist": "calendar"},
+      {"window": {"start": "22:00", "end": "06:00"}, "blank": true},
+      {"playlist": "art"}
+    ]
+  }
+
+Rules are tried in order and the first active one applies.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("schedule set called")
+
+		err := client.SetSchedule(args[0])
+		if err != nil {
+			slog.Error("set schedule returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleScheduleCmd.AddCommand(barnacleScheduleSetCmd)
+}
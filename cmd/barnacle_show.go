@@ -23,10 +23,10 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 )
 
@@ -35,17 +35,19 @@ var barnacleShowCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show the specified image on a barnacle node.",
 	Long: `Show the specified image on a barnacle node.
-A node may be optionally specified. If no node is specified,
-the image will be displayed on a random node.`,
+Nodes may be optionally specified. If no node is specified,
+the image will be displayed on a random node. An image given as
+node=image, e.g. hall=a.jpg, is shown on that node regardless of
+orientation. With --wall, a single image is sliced up and shown
+across every node of the wall.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("show called")
+		slog.Debug("show called")
 
 		if len(args) < 1 {
 			return errors.New("image argument required")
 		}
 
-		fmt.Println("Args", args)
-		node, err := cmd.Flags().GetString("node")
+		nodes, err := cmd.Flags().GetStringSlice("node")
 		if err != nil {
 			return err
 		}
@@ -55,9 +57,65 @@ the image will be displayed on a random node.`,
 			return err
 		}
 
-		err = client.ShowImage(node, fit, args...)
+		force, err := cmd.Flags().GetBool("force")
 		if err != nil {
-			log.Println("show image returned error:", err)
+			return err
+		}
+
+		wall, err := cmd.Flags().GetString("wall")
+		if err != nil {
+			return err
+		}
+
+		sel, err := cmd.Flags().GetString(selectorFlagName)
+		if err != nil {
+			return err
+		}
+
+		strategy, err := cmd.Flags().GetString("assign")
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		ttl, err := cmd.Flags().GetDuration("ttl")
+		if err != nil {
+			return err
+		}
+
+		priority, err := cmd.Flags().GetInt("priority")
+		if err != nil {
+			return err
+		}
+
+		opts := client.ShowOptions{
+			Nodes:    nodes,
+			Selector: sel,
+			Wall:     wall,
+			Fit:      fit,
+			Force:    force,
+			DryRun:   dryRun,
+			Assign:   strategy,
+			TTL:      ttl,
+			Priority: priority,
+		}
+
+		if cmd.Flags().Changed("seed") {
+			seed, err := cmd.Flags().GetInt64("seed")
+			if err != nil {
+				return err
+			}
+
+			opts.Seed = &seed
+		}
+
+		err = client.ShowImage(opts, args...)
+		if err != nil {
+			slog.Error("show image returned error", logging.Err(err))
 		}
 
 		return nil
@@ -67,6 +125,14 @@ the image will be displayed on a random node.`,
 func init() {
 	barnacleCmd.AddCommand(barnacleShowCmd)
 
-	barnacleShowCmd.Flags().StringP("node", "n", "", "Identifier of the specific node to display on.")
+	barnacleShowCmd.Flags().StringSliceP("node", "n", nil, "Name of a node to display on. May be repeated to choose among several.")
 	barnacleShowCmd.Flags().StringP("fit", "f", "crop", "Crop or Pad images to fit [crop, pad].")
+	barnacleShowCmd.Flags().StringP("wall", "w", "", "Name of a wall to spread a single image across.")
+	barnacleShowCmd.Flags().Bool("force", false, "Show now, ignoring the node's quiet hours and refresh budget.")
+	barnacleShowCmd.Flags().Bool("dry-run", false, "Print which node each image would go to, without showing anything.")
+	barnacleShowCmd.Flags().String(selectorFlagName, "", selectorFlagUsage)
+	barnacleShowCmd.Flags().String("assign", "", "How to choose a node for each image [fit, roundRobin, lru, random, sticky]. Defaults to fit, matching aspect ratios.")
+	barnacleShowCmd.Flags().Int64("seed", 0, "Seed for --assign random, to place the same images on the same nodes each time.")
+	barnacleShowCmd.Flags().Duration("ttl", 0, "Show as an alert for this long, then go back to what was there before. Schedules and other shows wait until it ends.")
+	barnacleShowCmd.Flags().Int("priority", 0, "Priority against alerts. Showing over an alert takes at least its priority.")
 }
@@ -22,7 +22,7 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/barnacle"
 	"github.com/redgoat650/barnacle-net/internal/config"
@@ -37,6 +37,10 @@ const (
 	nodeOrientShorthand = "o"
 	nodeLabelsFlagName  = "labels"
 	nodeLabelsShorthand = "l"
+
+	nodeQuietHoursFlagName       = "quiet-hours"
+	nodeMaxRefreshesHourFlagName = "max-refreshes-per-hour"
+	nodeMaxRefreshesDayFlagName  = "max-refreshes-per-day"
 )
 
 // barnacleStartCmd represents the start command
@@ -45,7 +49,10 @@ var barnacleStartCmd = &cobra.Command{
 	Short: "Start a barnacle node",
 	Long:  `Start a barnacle node.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		log.Println("start called")
+		slog.Debug("start called")
+
+		// Bound here rather than in init since server start shares the key.
+		viper.BindPFlag(config.ChaosPlanCfgPath, cmd.Flags().Lookup(chaosFlagName))
 
 		return barnacle.RunBarnacle()
 	},
@@ -56,9 +63,16 @@ func init() {
 
 	barnacleStartCmd.Flags().StringP(nodeNameFlagName, nodeNameShorthand, "", "node name")
 	barnacleStartCmd.Flags().StringP(nodeOrientFlagName, nodeOrientShorthand, "", "node orientation based on button position [u,d,l,r]")
-	barnacleStartCmd.Flags().StringSliceP(nodeLabelsFlagName, nodeLabelsShorthand, nil, "list of aliases for a node")
+	barnacleStartCmd.Flags().StringSliceP(nodeLabelsFlagName, nodeLabelsShorthand, nil, "labels for the node, as key=value or a bare key, e.g. room=kitchen,floor=2")
+	barnacleStartCmd.Flags().String(nodeQuietHoursFlagName, "", "daily window display refreshes are held back during, e.g. 22:00-07:00 or 22:00-07:00@Europe/London")
+	barnacleStartCmd.Flags().Int(nodeMaxRefreshesHourFlagName, 0, "most display refreshes allowed in any hour, 0 for no limit")
+	barnacleStartCmd.Flags().Int(nodeMaxRefreshesDayFlagName, 0, "most display refreshes allowed in any day, 0 for no limit")
+	barnacleStartCmd.Flags().String(chaosFlagName, "", "debug: path to a fault injection plan (YAML/JSON) applied to the server conn")
 
 	viper.BindPFlag(config.NodeNameConfigKey, barnacleStartCmd.Flags().Lookup(nodeNameFlagName))
 	viper.BindPFlag(config.NodeOrientationConfigKey, barnacleStartCmd.Flags().Lookup(nodeOrientFlagName))
 	viper.BindPFlag(config.NodeLabelsConfigKey, barnacleStartCmd.Flags().Lookup(nodeLabelsFlagName))
+	viper.BindPFlag(config.NodeQuietHoursConfigKey, barnacleStartCmd.Flags().Lookup(nodeQuietHoursFlagName))
+	viper.BindPFlag(config.NodeMaxRefreshesPerHourConfigKey, barnacleStartCmd.Flags().Lookup(nodeMaxRefreshesHourFlagName))
+	viper.BindPFlag(config.NodeMaxRefreshesPerDayConfigKey, barnacleStartCmd.Flags().Lookup(nodeMaxRefreshesDayFlagName))
 }
@@ -0,0 +1,64 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// barnacleWallSetCmd represents the wall set command
+var barnacleWallSetCmd = &cobra.Command{
+	Use:   "set <file>",
+	Short: "Create or replace a wall from a JSON file.",
+	Long: `Create or replace a wall from a JSON file, or from stdin if the file
+is "-". Members give the position and size of each frame as hung, in any
+one unit, measured from the top left of the wall, and the width of the
+bezel around its display. For example, two landscape frames side by side
+with a 20mm gap:
+
+  {
+    "name": "living-room",
+    "members": [
+      {"node": "left", "x": 0, "y": 0, "width": 300, "height": 200, "bezel": 15},
+      {"node": "right", "x": 320, "y": 0, "width": 300, "height": 200, "bezel": 15}
+    ]
+  }`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("wall set called")
+
+		err := client.SetWall(args[0])
+		if err != nil {
+			slog.Error("set wall returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleWallCmd.AddCommand(barnacleWallSetCmd)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2023 Nick Wright <nwright970@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/cobra"
+)
+
+const (
+	eventTypeFlagName = "type"
+	eventNodeFlagName = "node"
+)
+
+// barnacleWatchCmd represents the watch command
+var barnacleWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream events from the server.",
+	Long: `Stream events from the server as JSON lines until interrupted.
+Events are: connected, disconnected, registered, imageStored, imageShown and
+configChanged.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		slog.Debug("watch called")
+
+		typeStrs, err := cmd.Flags().GetStringSlice(eventTypeFlagName)
+		if err != nil {
+			return err
+		}
+
+		nodes, err := cmd.Flags().GetStringSlice(eventNodeFlagName)
+		if err != nil {
+			return err
+		}
+
+		var types []message.EventType
+		for _, t := range typeStrs {
+			types = append(types, message.EventType(t))
+		}
+
+		err = client.Watch(types, nodes)
+		if err != nil {
+			slog.Error("watch returned error", logging.Err(err))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	barnacleCmd.AddCommand(barnacleWatchCmd)
+
+	barnacleWatchCmd.Flags().StringSliceP(eventTypeFlagName, "t", nil, "Only print events of these types.")
+	barnacleWatchCmd.Flags().StringSliceP(eventNodeFlagName, "n", nil, "Only print events about these nodes.")
+}
@@ -22,10 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/client"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 )
 
@@ -36,9 +36,9 @@ var filesystemListCmd = &cobra.Command{
 	Short:   "List files in the network.",
 	Long:    `List files in the network.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("list called")
+		slog.Debug("list called")
 		if err := client.ListFiles(); err != nil {
-			log.Println("error listing files:", err)
+			slog.Error("error listing files", logging.Err(err))
 		}
 	},
 }
@@ -4,9 +4,11 @@ Copyright © 2023 Nick Wright nwright970@gmail.com
 package cmd
 
 import (
-	"fmt"
+	"log/slog"
 	"os"
 
+	"github.com/redgoat650/barnacle-net/internal/config"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -40,6 +42,11 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.barnacle-net.yaml)")
+	rootCmd.PersistentFlags().String("log-level", "info", "Log level [debug, info, warn, error].")
+	rootCmd.PersistentFlags().String("log-format", logging.TextFormat, "Log format [text, json].")
+
+	viper.BindPFlag(config.LogLevelCfgPath, rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag(config.LogFormatCfgPath, rootCmd.PersistentFlags().Lookup("log-format"))
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -65,7 +72,11 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	cfgErr := viper.ReadInConfig()
+
+	cobra.CheckErr(logging.Setup(viper.GetString(config.LogLevelCfgPath), viper.GetString(config.LogFormatCfgPath)))
+
+	if cfgErr == nil {
+		slog.Debug("using config file", "path", viper.ConfigFileUsed())
 	}
 }
@@ -23,11 +23,11 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/redgoat650/barnacle-net/internal/config"
 	"github.com/redgoat650/barnacle-net/internal/deploy"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -38,7 +38,7 @@ var serverDeployCmd = &cobra.Command{
 	Short: "Deploy a server",
 	Long:  `Deploy a new server or redeploy an existing server.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("deploy called")
+		slog.Debug("deploy called")
 
 		img := viper.GetString(config.DeployImageCfgPath)
 		if img == "" {
@@ -47,7 +47,7 @@ var serverDeployCmd = &cobra.Command{
 
 		err := deploy.DeployServer(img)
 		if err != nil {
-			log.Println("deploying server:", err)
+			slog.Error("deploying server", logging.Err(err))
 		}
 
 		return nil
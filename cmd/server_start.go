@@ -22,24 +22,41 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"log"
+	"log/slog"
 
+	"github.com/redgoat650/barnacle-net/internal/config"
 	"github.com/redgoat650/barnacle-net/internal/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+const (
+	chaosFlagName    = "chaos"
+	grpcPortFlagName = "grpc-port"
+	stateDirFlagName = "state-dir"
+)
+
 // serverStartCmd represents the start command
 var serverStartCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start a barnacle-net server.",
 	Long:  `Start a barnacle-net server.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		log.Println("running server")
+		slog.Debug("running server")
+
+		// Bound here rather than in init since barnacle start shares the key.
+		viper.BindPFlag(config.ChaosPlanCfgPath, cmd.Flags().Lookup(chaosFlagName))
+
 		return server.RunServer(viper.GetViper())
 	},
 }
 
 func init() {
 	serverCmd.AddCommand(serverStartCmd)
+
+	serverStartCmd.Flags().String(chaosFlagName, "", "Debug: path to a fault injection plan (YAML/JSON) applied to every websocket conn.")
+	serverStartCmd.Flags().String(grpcPortFlagName, viper.GetString(config.DeployServerGRPCPortConfigKey), "Port to serve the gRPC control API on; empty disables it.")
+	serverStartCmd.Flags().String(stateDirFlagName, viper.GetString(config.ServerStateDirCfgPath), "Directory to persist playlists and other server state to.")
+	viper.BindPFlag(config.DeployServerGRPCPortConfigKey, serverStartCmd.Flags().Lookup(grpcPortFlagName))
+	viper.BindPFlag(config.ServerStateDirCfgPath, serverStartCmd.Flags().Lookup(stateDirFlagName))
 }
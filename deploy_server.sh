@@ -10,6 +10,7 @@ docker run -d \
   --name ${CONTAINER_NAME} \
   --rm \
   -p 8080:8080 \
+  -p 9090:9090 \
   --ip "172.17.0.4" \
   redgoat650/barnacle-net:${TAG} \
   server start
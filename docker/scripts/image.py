@@ -11,9 +11,11 @@ from inky.auto import auto
 inky = auto(ask_user=True, verbose=True)
 saturation = 0.5
 
-if len(sys.argv) != 5:
+if len(sys.argv) not in (5, 6):
     print("""
-Usage: {file} image-file [rotation] [saturation] [fitType]
+Usage: {file} image-file [rotation] [saturation] [fitType] [prepared-file]
+
+With prepared-file, the fitted image is saved there instead of shown.
 """.format(file=sys.argv[0]))
     sys.exit(1)
 
@@ -34,6 +36,10 @@ else:
 
 image.save(os.path.join(os.path.dirname(imgFullPath), "debug_fitted.jpg"))
 
+if len(sys.argv) == 6:
+    image.save(sys.argv[5], format="PNG")
+    sys.exit(0)
+
 
 inky.set_image(image, saturation=saturation)
 inky.show()
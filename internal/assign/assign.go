@@ -0,0 +1,377 @@
+// Package assign decides which node shows each image of a show request.
+// Assigners see only plain descriptions of images and nodes, so strategies
+// don't depend on how nodes are connected.
+package assign
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Image is an image waiting for a node.
+type Image struct {
+	Name   string
+	Hash   string
+	Width  int
+	Height int
+}
+
+// Portrait reports whether the image is at least as tall as it is wide.
+func (i Image) Portrait() bool {
+	return i.Width <= i.Height
+}
+
+func (i Image) key() string {
+	if i.Hash != "" {
+		return i.Hash
+	}
+
+	return i.Name
+}
+
+// Node is a node free to show an image.
+type Node struct {
+	Name     string
+	Portrait bool
+
+	// Width and Height are the display's resolution as it is hung, or zero
+	// if unknown.
+	Width  int
+	Height int
+
+	// LastUpdate is when the display last refreshed, zero if never.
+	LastUpdate time.Time
+}
+
+// aspect returns the width of the display over its height, guessing from
+// its orientation if the resolution is unknown.
+func (n Node) aspect() float64 {
+	if n.Width > 0 && n.Height > 0 {
+		return float64(n.Width) / float64(n.Height)
+	}
+
+	if n.Portrait {
+		return 3.0 / 4
+	}
+
+	return 4.0 / 3
+}
+
+// Assigner chooses nodes for images.
+type Assigner interface {
+	// Assign returns, for each image, the index in nodes of the node to
+	// show it on, or -1 if it gets none. No node gets more than one image.
+	// Images earlier in the list are placed first when there are more
+	// images than nodes.
+	Assign(images []Image, nodes []Node) []int
+}
+
+// Strategy names an Assigner.
+type Strategy string
+
+const (
+	BestFitStrategy     Strategy = "fit"        // Match aspect ratios as closely as possible.
+	RoundRobinStrategy  Strategy = "roundRobin" // Take turns through the nodes by name.
+	LeastRecentStrategy Strategy = "lru"        // Prefer nodes updated longest ago.
+	RandomStrategy      Strategy = "random"     // Shuffle, optionally with a seed.
+	StickyStrategy      Strategy = "sticky"     // Return images to where they last showed.
+)
+
+var Strategies = []Strategy{BestFitStrategy, RoundRobinStrategy, LeastRecentStrategy, RandomStrategy, StickyStrategy}
+
+func (s Strategy) Validate() error {
+	for _, chk := range Strategies {
+		if s == chk {
+			return nil
+		}
+	}
+
+	names := make([]string, len(Strategies))
+	for i, chk := range Strategies {
+		names[i] = string(chk)
+	}
+
+	return fmt.Errorf("unknown assignment strategy %q, want one of %s", s, strings.Join(names, ", "))
+}
+
+// unassigned returns a result with no image placed.
+func unassigned(n int) []int {
+	ret := make([]int, n)
+	for i := range ret {
+		ret[i] = -1
+	}
+
+	return ret
+}
+
+// byName returns the indexes of nodes sorted by node name, so strategies
+// don't depend on the order nodes were found in.
+func byName(nodes []Node) []int {
+	ret := make([]int, len(nodes))
+	for i := range ret {
+		ret[i] = i
+	}
+
+	sort.SliceStable(ret, func(a, b int) bool {
+		return nodes[ret[a]].Name < nodes[ret[b]].Name
+	})
+
+	return ret
+}
+
+// inOrder gives images, in order, the nodes at the given indexes, in order.
+func inOrder(nImages int, order []int) []int {
+	ret := unassigned(nImages)
+	for i := range ret {
+		if i >= len(order) {
+			break
+		}
+
+		ret[i] = order[i]
+	}
+
+	return ret
+}
+
+// BestFit places images on the displays closest to their aspect ratio.
+type BestFit struct{}
+
+func (BestFit) Assign(images []Image, nodes []Node) []int {
+	type pair struct {
+		image, node int
+		score       float64
+	}
+
+	var pairs []pair
+	for i, img := range images {
+		imgAspect := 1.0
+		if img.Width > 0 && img.Height > 0 {
+			imgAspect = float64(img.Width) / float64(img.Height)
+		}
+
+		for j, n := range nodes {
+			pairs = append(pairs, pair{
+				image: i,
+				node:  j,
+				score: math.Abs(math.Log(imgAspect / n.aspect())),
+			})
+		}
+	}
+
+	// Ties go to earlier images, then to nodes by name.
+	sort.SliceStable(pairs, func(a, b int) bool {
+		pa, pb := pairs[a], pairs[b]
+		switch {
+		case pa.score != pb.score:
+			return pa.score < pb.score
+		case pa.image != pb.image:
+			return pa.image < pb.image
+		}
+
+		return nodes[pa.node].Name < nodes[pb.node].Name
+	})
+
+	// Only as many images as there are nodes are placed, earliest first.
+	placing := min(len(images), len(nodes))
+
+	ret := unassigned(len(images))
+	taken := make([]bool, len(nodes))
+	for _, p := range pairs {
+		if p.image >= placing || ret[p.image] >= 0 || taken[p.node] {
+			continue
+		}
+
+		ret[p.image] = p.node
+		taken[p.node] = true
+	}
+
+	return ret
+}
+
+// RoundRobin takes turns through the nodes in name order, each request
+// starting after the node the last one ended on.
+type RoundRobin struct {
+	mu   *sync.Mutex
+	last string
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{
+		mu: new(sync.Mutex),
+	}
+}
+
+func (r *RoundRobin) Assign(images []Image, nodes []Node) []int {
+	order := byName(nodes)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := sort.Search(len(order), func(i int) bool {
+		return nodes[order[i]].Name > r.last
+	})
+
+	order = append(append([]int(nil), order[start:]...), order[:start]...)
+
+	ret := inOrder(len(images), order)
+	for _, j := range ret {
+		if j >= 0 {
+			r.last = nodes[j].Name
+		}
+	}
+
+	return ret
+}
+
+// LeastRecent places images on the nodes updated longest ago.
+type LeastRecent struct{}
+
+func (LeastRecent) Assign(images []Image, nodes []Node) []int {
+	order := byName(nodes)
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return nodes[order[a]].LastUpdate.Before(nodes[order[b]].LastUpdate)
+	})
+
+	return inOrder(len(images), order)
+}
+
+// Random places images on nodes at random. The same seed places the same
+// images on the same nodes.
+type Random struct {
+	Seed int64
+}
+
+func (s Random) Assign(images []Image, nodes []Node) []int {
+	order := byName(nodes)
+
+	rng := rand.New(rand.NewSource(s.Seed))
+	rng.Shuffle(len(order), func(a, b int) {
+		order[a], order[b] = order[b], order[a]
+	})
+
+	return inOrder(len(images), order)
+}
+
+// Sticky returns each image to the node it was last shown on, if that node
+// is free, and places the rest with BestFit.
+type Sticky struct {
+	mu   *sync.Mutex
+	last map[string]string // Node name, by image hash.
+}
+
+func NewSticky() *Sticky {
+	return &Sticky{
+		mu:   new(sync.Mutex),
+		last: make(map[string]string),
+	}
+}
+
+// Shown records that an image was shown on a node.
+func (s *Sticky) Shown(img Image, node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last[img.key()] = node
+}
+
+func (s *Sticky) Assign(images []Image, nodes []Node) []int {
+	nodeIdx := make(map[string]int, len(nodes))
+	for j, n := range nodes {
+		nodeIdx[n.Name] = j
+	}
+
+	ret := unassigned(len(images))
+	taken := make([]bool, len(nodes))
+
+	s.mu.Lock()
+	for i, img := range images {
+		j, ok := nodeIdx[s.last[img.key()]]
+		if ok && !taken[j] {
+			ret[i] = j
+			taken[j] = true
+		}
+	}
+	s.mu.Unlock()
+
+	var (
+		restImages, restNodes []int
+		imgs                  []Image
+		ns                    []Node
+	)
+
+	for i, img := range images {
+		if ret[i] < 0 {
+			restImages = append(restImages, i)
+			imgs = append(imgs, img)
+		}
+	}
+
+	for j, n := range nodes {
+		if !taken[j] {
+			restNodes = append(restNodes, j)
+			ns = append(ns, n)
+		}
+	}
+
+	for k, j := range (BestFit{}).Assign(imgs, ns) {
+		if j >= 0 {
+			ret[restImages[k]] = restNodes[j]
+		}
+	}
+
+	return ret
+}
+
+// MatchOrientation wraps an Assigner so that portrait images only go to
+// portrait nodes and landscape images to landscape nodes.
+func MatchOrientation(a Assigner) Assigner {
+	return orientationAssigner{inner: a}
+}
+
+type orientationAssigner struct {
+	inner Assigner
+}
+
+func (o orientationAssigner) Assign(images []Image, nodes []Node) []int {
+	ret := unassigned(len(images))
+
+	for _, portrait := range []bool{true, false} {
+		var (
+			imgIdx, nodeIdx []int
+			imgs            []Image
+			ns              []Node
+		)
+
+		for i, img := range images {
+			if img.Portrait() == portrait {
+				imgIdx = append(imgIdx, i)
+				imgs = append(imgs, img)
+			}
+		}
+
+		for j, n := range nodes {
+			if n.Portrait == portrait {
+				nodeIdx = append(nodeIdx, j)
+				ns = append(ns, n)
+			}
+		}
+
+		if len(imgs) == 0 || len(ns) == 0 {
+			continue
+		}
+
+		for k, j := range o.inner.Assign(imgs, ns) {
+			if j >= 0 {
+				ret[imgIdx[k]] = nodeIdx[j]
+			}
+		}
+	}
+
+	return ret
+}
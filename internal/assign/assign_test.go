@@ -0,0 +1,309 @@
+package assign
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	land = Image{Name: "land.png", Width: 1600, Height: 900}
+	port = Image{Name: "port.png", Width: 900, Height: 1600}
+	sq   = Image{Name: "square.png", Width: 1000, Height: 1000}
+
+	landNode = func(name string) Node { return Node{Name: name, Width: 600, Height: 448} }
+	portNode = func(name string) Node { return Node{Name: name, Portrait: true, Width: 448, Height: 600} }
+)
+
+func TestBestFit(t *testing.T) {
+	tests := []struct {
+		name   string
+		images []Image
+		nodes  []Node
+		want   []int
+	}{
+		{
+			name:   "matches aspect",
+			images: []Image{land, port},
+			nodes:  []Node{portNode("a"), landNode("b")},
+			want:   []int{1, 0},
+		},
+		{
+			name:   "guesses aspect from orientation",
+			images: []Image{port, land},
+			nodes:  []Node{{Name: "a"}, {Name: "b", Portrait: true}},
+			want:   []int{1, 0},
+		},
+		{
+			name:   "tied nodes go by name",
+			images: []Image{land},
+			nodes:  []Node{landNode("b"), landNode("a")},
+			want:   []int{1},
+		},
+		{
+			name:   "tied images go to the earlier",
+			images: []Image{land, land},
+			nodes:  []Node{landNode("a")},
+			want:   []int{0, -1},
+		},
+		{
+			name:   "earlier images are placed first",
+			images: []Image{sq, land},
+			nodes:  []Node{landNode("a")},
+			want:   []int{0, -1},
+		},
+		{
+			name:   "poor fits still placed",
+			images: []Image{land, port},
+			nodes:  []Node{landNode("a"), landNode("b")},
+			want:   []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (BestFit{}).Assign(tt.images, tt.nodes); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	nodes := []Node{landNode("c"), landNode("a"), landNode("b")}
+
+	tests := []struct {
+		images int
+		want   []string
+	}{
+		{1, []string{"a"}},
+		{1, []string{"b"}},
+		{2, []string{"c", "a"}},
+		{3, []string{"b", "c", "a"}},
+		{4, []string{"b", "c", "a", ""}},
+		{1, []string{"b"}},
+	}
+
+	// Each call picks up where the last left off.
+	r := NewRoundRobin()
+	for i, tt := range tests {
+		got := names(nodes, r.Assign(make([]Image, tt.images), nodes))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("call %d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestLeastRecent(t *testing.T) {
+	now := time.Now()
+
+	node := func(name string, ago time.Duration) Node {
+		n := landNode(name)
+		if ago > 0 {
+			n.LastUpdate = now.Add(-ago)
+		}
+		return n
+	}
+
+	tests := []struct {
+		name   string
+		images int
+		nodes  []Node
+		want   []string
+	}{
+		{
+			name:   "oldest first",
+			images: 3,
+			nodes:  []Node{node("a", time.Minute), node("b", time.Hour), node("c", time.Second)},
+			want:   []string{"b", "a", "c"},
+		},
+		{
+			name:   "never updated first",
+			images: 2,
+			nodes:  []Node{node("a", time.Hour), node("b", 0)},
+			want:   []string{"b", "a"},
+		},
+		{
+			name:   "ties go by name",
+			images: 2,
+			nodes:  []Node{node("b", time.Hour), node("a", time.Hour), node("c", 2*time.Hour)},
+			want:   []string{"c", "a"},
+		},
+		{
+			name:   "more images than nodes",
+			images: 3,
+			nodes:  []Node{node("a", time.Hour), node("b", time.Minute)},
+			want:   []string{"a", "b", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(tt.nodes, (LeastRecent{}).Assign(make([]Image, tt.images), tt.nodes))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomSeeded(t *testing.T) {
+	nodes := []Node{landNode("a"), landNode("b"), landNode("c"), landNode("d"), landNode("e")}
+	reversed := slices.Clone(nodes)
+	slices.Reverse(reversed)
+
+	images := make([]Image, 4)
+
+	want := names(nodes, (Random{Seed: 42}).Assign(images, nodes))
+
+	seen := make(map[string]bool)
+	for _, n := range want {
+		if n == "" || seen[n] {
+			t.Fatalf("got %v, want each image on a different node", want)
+		}
+		seen[n] = true
+	}
+
+	tests := []struct {
+		name  string
+		nodes []Node
+	}{
+		{"same seed", nodes},
+		{"nodes in another order", reversed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(tt.nodes, (Random{Seed: 42}).Assign(images, tt.nodes))
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSticky(t *testing.T) {
+	shownLand := Image{Name: "land.png", Hash: "h1", Width: 1600, Height: 900}
+	renamed := Image{Name: "renamed.png", Hash: "h1", Width: 1600, Height: 900}
+
+	tests := []struct {
+		name   string
+		last   string // Node land.png was last shown on.
+		images []Image
+		nodes  []Node
+		want   []string
+	}{
+		{
+			name:   "returns to previous node",
+			last:   "b",
+			images: []Image{shownLand},
+			nodes:  []Node{landNode("a"), portNode("b")},
+			want:   []string{"b"},
+		},
+		{
+			name:   "follows the hash",
+			last:   "b",
+			images: []Image{renamed},
+			nodes:  []Node{landNode("a"), portNode("b")},
+			want:   []string{"b"},
+		},
+		{
+			name:   "previous node gone",
+			last:   "z",
+			images: []Image{shownLand},
+			nodes:  []Node{portNode("a"), landNode("b")},
+			want:   []string{"b"},
+		},
+		{
+			name:   "others fit around it",
+			last:   "b",
+			images: []Image{port, shownLand},
+			nodes:  []Node{landNode("a"), landNode("b"), portNode("c")},
+			want:   []string{"c", "b"},
+		},
+		{
+			name:   "more images than nodes",
+			last:   "a",
+			images: []Image{port, shownLand},
+			nodes:  []Node{portNode("a")},
+			want:   []string{"", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSticky()
+			s.Shown(shownLand, tt.last)
+
+			got := names(tt.nodes, s.Assign(tt.images, tt.nodes))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoreImagesThanNodes(t *testing.T) {
+	images := []Image{land, port, sq}
+	nodes := []Node{landNode("a"), portNode("b")}
+
+	tests := []struct {
+		name string
+		a    Assigner
+	}{
+		{"fit", BestFit{}},
+		{"roundRobin", NewRoundRobin()},
+		{"lru", LeastRecent{}},
+		{"random", Random{Seed: 1}},
+		{"sticky", NewSticky()},
+		{"matchOrientation", MatchOrientation(BestFit{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.a.Assign(images, nodes)
+			if len(got) != len(images) {
+				t.Fatalf("got %d results for %d images", len(got), len(images))
+			}
+
+			placed := 0
+			taken := make(map[int]bool)
+			for _, j := range got {
+				if j < 0 {
+					continue
+				}
+				if taken[j] {
+					t.Fatalf("got %v, want no node given two images", got)
+				}
+				taken[j] = true
+				placed++
+			}
+
+			if placed != len(nodes) {
+				t.Errorf("got %v, want %d images placed and the rest -1", got, len(nodes))
+			}
+		})
+	}
+}
+
+func TestMatchOrientation(t *testing.T) {
+	images := []Image{land, port}
+	nodes := []Node{landNode("a"), landNode("b")}
+
+	want := []int{0, -1}
+	if got := MatchOrientation(BestFit{}).Assign(images, nodes); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// names returns the name of the node each image was given, or "" if none.
+func names(nodes []Node, assigned []int) []string {
+	ret := make([]string, len(assigned))
+	for i, j := range assigned {
+		if j >= 0 {
+			ret[i] = nodes[j].Name
+		}
+	}
+
+	return ret
+}
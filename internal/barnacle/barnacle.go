@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"os/user"
@@ -16,8 +16,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/redgoat650/barnacle-net/internal/chaos"
 	"github.com/redgoat650/barnacle-net/internal/config"
 	"github.com/redgoat650/barnacle-net/internal/hash"
+	"github.com/redgoat650/barnacle-net/internal/imaging"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/redgoat650/barnacle-net/internal/message"
 	"github.com/redgoat650/barnacle-net/internal/python"
 	"github.com/redgoat650/barnacle-net/internal/transport"
@@ -28,13 +31,31 @@ const (
 	registerTimeout  = 10 * time.Second
 	reconnectBackoff = 10 * time.Second
 	imgCacheDir      = "barnacle-images"
+	preparedDir      = "barnacle-prepared"
+
+	// preparedTTL is how long a prepared image waits for its commit before
+	// it may be discarded.
+	preparedTTL = 10 * time.Minute
 )
 
 type Barnacle struct {
 	imageDir      string
+	prepareDir    string
 	imagePYRunner *python.PyRunner
 	t             *transport.Transport
 	cfgMu         *sync.Mutex
+	log           *slog.Logger
+
+	prepMu   *sync.Mutex
+	prepared map[string]preparedImage // Keyed by reveal ID.
+}
+
+// preparedImage is an image rendered for the display, waiting to be shown.
+type preparedImage struct {
+	path       string
+	saturation *float64
+	fitPolicy  message.FitPolicy
+	time       time.Time
 }
 
 func RunBarnacle() error {
@@ -43,14 +64,14 @@ func RunBarnacle() error {
 		err := runBarnacle()
 		if err != nil {
 			if errors.Is(err, ErrInterrupt) {
-				log.Println("node shutting down:", err)
+				slog.Info("node shutting down", logging.Err(err))
 				return err
 			}
-			log.Println("error running barnacle:", err)
+			slog.Error("error running barnacle", logging.Err(err))
 		}
 
 		reconnectRetries++
-		log.Printf("attempting reconnect %d in %v", reconnectRetries, reconnectBackoff)
+		slog.Info("attempting reconnect", "attempt", reconnectRetries, "backoff", reconnectBackoff)
 		time.Sleep(reconnectBackoff)
 	}
 }
@@ -62,8 +83,8 @@ func runBarnacle() error {
 	}
 
 	// Register host with the server.
-	if err := b.Register(); err != nil {
-		log.Println("closing connection:", b.t.GracefullyClose())
+	if err := b.Register(nil); err != nil {
+		b.log.Info("closing connection", logging.Err(b.t.GracefullyClose()))
 		return fmt.Errorf("failed to register with server: %s", err)
 	}
 
@@ -73,15 +94,34 @@ func runBarnacle() error {
 
 func NewBarnacle() (*Barnacle, error) {
 	server := viper.GetString(config.ConnectServerAddrCfgPath)
-	path := viper.GetString(config.ConnectWebsocketPathCfgPath)
+	path := config.WebsocketPath(viper.GetString(config.ConnectWebsocketPathCfgPath), message.NodeRole)
 
-	log.Println("connecting to:", server, "at", path)
+	l := slog.With(slog.String(logging.NodeKey, viper.GetString(config.NodeNameConfigKey)))
 
-	t, err := transport.NewTransportConn(server, path)
+	l.Info("connecting to server", "server", server, "path", path)
+
+	ws, err := transport.Dial(server, path)
 	if err != nil {
 		return nil, err
 	}
 
+	var conn transport.Conn = ws
+	if planPath := viper.GetString(config.ChaosPlanCfgPath); planPath != "" {
+		plan, err := chaos.LoadPlan(planPath)
+		if err != nil {
+			ws.Close()
+			return nil, err
+		}
+
+		l.Warn("injecting faults from chaos plan", "plan", planPath)
+		conn = chaos.Wrap(ws, plan)
+	}
+
+	opts := config.TransportOptions(viper.GetViper())
+	opts.Logger = l.With(slog.String(logging.RemoteKey, server))
+
+	t := transport.NewTransportForConn(conn, opts)
+
 	imageDir := filepath.Join(os.TempDir(), imgCacheDir)
 
 	err = os.MkdirAll(imageDir, 0644)
@@ -89,30 +129,38 @@ func NewBarnacle() (*Barnacle, error) {
 		panic(err)
 	}
 
+	prepareDir := filepath.Join(os.TempDir(), preparedDir)
+	if err := os.MkdirAll(prepareDir, 0755); err != nil {
+		panic(err)
+	}
+
 	b := &Barnacle{
 		imageDir:      imageDir,
+		prepareDir:    prepareDir,
 		imagePYRunner: python.NewImagePYRunner(getScriptDir()),
 		t:             t,
 		cfgMu:         new(sync.Mutex),
+		log:           l,
+		prepMu:        new(sync.Mutex),
+		prepared:      make(map[string]preparedImage),
 	}
 
 	return b, nil
 }
 
-func (b *Barnacle) Register() error {
+// Register sends this node's identity to the server. parent is the command
+// that prompted the registration, if any.
+func (b *Barnacle) Register(parent *message.Command) error {
 	id, err := b.getIdentity()
 	if err != nil {
 		return err
 	}
 
-	c := &message.Command{
-		Op: message.RegisterCmd,
-		Payload: &message.CommandPayload{
-			RegisterPayload: &message.RegisterPayload{
-				Identity: *id,
-			},
+	c := parent.Derive(message.RegisterCmd, &message.CommandPayload{
+		RegisterPayload: &message.RegisterPayload{
+			Identity: *id,
 		},
-	}
+	})
 
 	respCh, err := b.t.SendCommand(c)
 	if err != nil {
@@ -150,7 +198,7 @@ func (b *Barnacle) handleIncomingCmds() error {
 
 			err := b.handleIncomingCommand(cmd)
 			if err != nil {
-				fmt.Println("Error handling incoming command", err)
+				logging.WithCommand(b.log, cmd).Error("error handling incoming command", logging.Err(err))
 			}
 
 		case <-interrupt:
@@ -161,8 +209,8 @@ func (b *Barnacle) handleIncomingCmds() error {
 }
 
 func (b *Barnacle) handleInterrupt() {
-	log.Println("Caught interrupt signal - gracefully disconnecting websocket")
-	log.Println("Websocket close error:", b.t.GracefullyClose()) // Blocks until incoming cmds channel closes
+	b.log.Info("caught interrupt signal - gracefully disconnecting websocket")
+	b.log.Info("websocket closed", logging.Err(b.t.GracefullyClose())) // Blocks until incoming cmds channel closes
 }
 
 func (b *Barnacle) handleIncomingCommand(cmd *message.Command) error {
@@ -175,23 +223,28 @@ func (b *Barnacle) handleIncomingCommand(cmd *message.Command) error {
 	case message.IdentifyCmd:
 		rp, err = b.handleIdentify()
 	case message.SetImageCmd:
-		rp, err = b.handleSetImage(cmd.Payload)
+		rp, err = b.handleSetImage(cmd)
+	case message.PrepareImageCmd:
+		err = b.handlePrepareImage(cmd)
+	case message.CommitImageCmd:
+		err = b.handleCommitImage(cmd)
 	case message.ListFilesCmd:
 		rp, err = b.handleListFiles()
 	case message.ConfigSetCmd:
-		err = b.handleConfigSet(cmd.Payload)
+		err = b.handleConfigSet(cmd)
 	default:
 		err = fmt.Errorf("unrecognized command: %s", cmd.Op)
 	}
 
 	if err != nil {
-		log.Printf("Hit error handling command %s. Attempting to send error as response: %s", cmd.Op, err)
+		logging.WithCommand(b.log, cmd).Warn("hit error handling command; attempting to send error as response", logging.Err(err))
 	}
 
 	return b.t.SendResponse(rp, err, cmd)
 }
 
-func (b *Barnacle) handleConfigSet(p *message.CommandPayload) error {
+func (b *Barnacle) handleConfigSet(cmd *message.Command) error {
+	p := cmd.Payload
 	if p == nil || p.ConfigSetPayload == nil {
 		return errors.New("invalid command payload")
 	}
@@ -223,7 +276,18 @@ func (b *Barnacle) handleConfigSet(p *message.CommandPayload) error {
 	}
 
 	if cfg.Labels != nil {
-		viper.Set(config.NodeLabelsConfigKey, cfg.Labels)
+		viper.Set(config.NodeLabelsConfigKey, cfg.Labels.Strings())
+		changed = true
+	}
+
+	if cfg.QuietHours != nil {
+		viper.Set(config.NodeQuietHoursConfigKey, cfg.QuietHours.String())
+		changed = true
+	}
+
+	if cfg.RefreshBudget != nil {
+		viper.Set(config.NodeMaxRefreshesPerHourConfigKey, cfg.RefreshBudget.PerHour)
+		viper.Set(config.NodeMaxRefreshesPerDayConfigKey, cfg.RefreshBudget.PerDay)
 		changed = true
 	}
 
@@ -231,8 +295,8 @@ func (b *Barnacle) handleConfigSet(p *message.CommandPayload) error {
 		// Register asynchronously (since it might take a bit to perform the eeprom checks).
 		// Server can assume an eventual update.
 		go func() {
-			if err := b.Register(); err != nil {
-				log.Println("node unable to re-register after config change:", err)
+			if err := b.Register(cmd); err != nil {
+				b.log.Error("node unable to re-register after config change", logging.Err(err))
 			}
 		}()
 	}
@@ -251,8 +315,6 @@ func (b *Barnacle) handleListFiles() (*message.ResponsePayload, error) {
 		name := info.Name()
 		fullPath := filepath.Join(b.imageDir, name)
 
-		log.Println("Walk reached", name, fullPath, "dir?", info.IsDir())
-
 		if info.IsDir() {
 			return nil
 		}
@@ -282,28 +344,21 @@ func (b *Barnacle) handleListFiles() (*message.ResponsePayload, error) {
 	}, err
 }
 
-func (b *Barnacle) handleSetImage(p *message.CommandPayload) (*message.ResponsePayload, error) {
+func (b *Barnacle) handleSetImage(cmd *message.Command) (*message.ResponsePayload, error) {
+	p := cmd.Payload
 	if p == nil || p.SetImagePayload == nil {
 		return nil, errors.New("invalid command payload")
 	}
 
 	imgData := p.SetImagePayload
-	fileName := imgData.Name
-	filePath := b.getFilePath(fileName)
 
-	_, err := os.Stat(filePath)
+	filePath, err := b.fetchFile(cmd, imgData.Name, imgData.Hash)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Download the file
-			fmt.Printf("download file %s to %s", fileName, filePath)
-			if err := b.downloadFile(fileName); err != nil {
-				return nil, err
-			}
-		}
+		return nil, err
 	}
 
 	orient := viper.GetString(config.NodeOrientationConfigKey)
-	rot := orientationToRotation(message.Orientation(orient))
+	rot := message.Orientation(orient).Rotation()
 
 	err = b.imagePYRunner.RunImagePY(filePath, rot, imgData.Saturation, imgData.FitPolicy)
 	if err != nil {
@@ -313,29 +368,131 @@ func (b *Barnacle) handleSetImage(p *message.CommandPayload) (*message.ResponseP
 	return nil, nil
 }
 
-func orientationToRotation(o message.Orientation) int {
-	rotationDeg := 0
-	switch o {
-	case message.ButtonsD:
-		rotationDeg = 270
-	case message.ButtonsR:
-		rotationDeg = 180
-	case message.ButtonsU:
-		rotationDeg = 90
-	}
-	return rotationDeg
+// handlePrepareImage downloads and renders an image for the display without
+// showing it, so that committing the reveal only has to refresh the panel.
+func (b *Barnacle) handlePrepareImage(cmd *message.Command) error {
+	p := cmd.Payload
+	if p == nil || p.PrepareImagePayload == nil {
+		return errors.New("invalid command payload")
+	}
+
+	reveal := p.PrepareImagePayload.Reveal
+	imgData := p.PrepareImagePayload.Image
+
+	filePath, err := b.fetchFile(cmd, imgData.Name, imgData.Hash)
+	if err != nil {
+		return err
+	}
+
+	orient := viper.GetString(config.NodeOrientationConfigKey)
+	rot := message.Orientation(orient).Rotation()
+
+	outPath := filepath.Join(b.prepareDir, reveal+".png")
+
+	err = b.imagePYRunner.PrepareImagePY(filePath, outPath, rot, imgData.Saturation, imgData.FitPolicy)
+	if err != nil {
+		return fmt.Errorf("running image preparing script: %s", err)
+	}
+
+	now := time.Now()
+
+	b.prepMu.Lock()
+	defer b.prepMu.Unlock()
+
+	// Forget reveals the server abandoned.
+	for id, prep := range b.prepared {
+		if now.Sub(prep.time) > preparedTTL {
+			os.Remove(prep.path)
+			delete(b.prepared, id)
+		}
+	}
+
+	b.prepared[reveal] = preparedImage{
+		path:       outPath,
+		saturation: imgData.Saturation,
+		fitPolicy:  imgData.FitPolicy,
+		time:       now,
+	}
+
+	return nil
+}
+
+// handleCommitImage shows a prepared image once the node's clock reaches the
+// reveal time.
+func (b *Barnacle) handleCommitImage(cmd *message.Command) error {
+	p := cmd.Payload
+	if p == nil || p.CommitImagePayload == nil {
+		return errors.New("invalid command payload")
+	}
+
+	reveal := p.CommitImagePayload.Reveal
+
+	b.prepMu.Lock()
+	prep, ok := b.prepared[reveal]
+	delete(b.prepared, reveal)
+	b.prepMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no image prepared for reveal %s", reveal)
+	}
+
+	defer os.Remove(prep.path)
+
+	if d := time.Until(p.CommitImagePayload.At); d > 0 {
+		b.log.Debug("waiting to reveal image", "reveal", reveal, "wait", d)
+		time.Sleep(d)
+	}
+
+	// The prepared image is already rotated and fitted to the display.
+	err := b.imagePYRunner.RunImagePY(prep.path, 0, prep.saturation, prep.fitPolicy)
+	if err != nil {
+		return fmt.Errorf("running image setting script: %s", err)
+	}
+
+	return nil
 }
 
-func (b *Barnacle) downloadFile(fileName string) error {
-	c := &message.Command{
-		Op: message.GetImageCmd,
-		Payload: &message.CommandPayload{
-			GetImagePayload: &message.GetImagePayload{
-				Name: fileName,
-			},
-		},
+// fetchFile returns the path of an image in the node's cache, downloading
+// it from the server first if it isn't there or, when the server gave its
+// hash, if the cached copy is stale.
+func (b *Barnacle) fetchFile(parent *message.Command, fileName, wantHash string) (string, error) {
+	filePath := b.getFilePath(fileName)
+
+	_, err := os.Stat(filePath)
+	switch {
+	case os.IsNotExist(err):
+		b.log.Info("downloading file", "file", fileName, "path", filePath)
+	case err != nil:
+		return "", err
+	case wantHash != "":
+		_, cachedHash, err := hash.ReadHashFile(filePath)
+		if err != nil {
+			return "", err
+		}
+
+		if cachedHash == wantHash {
+			return filePath, nil
+		}
+
+		b.log.Info("downloading changed file", "file", fileName, "path", filePath)
+	default:
+		return filePath, nil
+	}
+
+	if err := b.downloadFile(parent, fileName); err != nil {
+		return "", err
 	}
 
+	return filePath, nil
+}
+
+func (b *Barnacle) downloadFile(parent *message.Command, fileName string) error {
+	c := parent.Derive(message.GetImageCmd, &message.CommandPayload{
+		GetImagePayload: &message.GetImagePayload{
+			Name: fileName,
+		},
+	})
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -344,13 +501,26 @@ func (b *Barnacle) downloadFile(fileName string) error {
 		return fmt.Errorf("barnacle error downloading file from server: %s", err)
 	}
 
-	if resp == nil || resp.Payload == nil || resp.Payload.GetImageResponse == nil || len(resp.Payload.GetImageResponse.ImageData) == 0 {
+	if resp == nil {
+		return errors.New("no response to download image request")
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("server error downloading file: %s", resp.Error)
+	}
+
+	if resp.Payload == nil || resp.Payload.GetImageResponse == nil || len(resp.Payload.GetImageResponse.ImageData) == 0 {
 		return errors.New("unexpected payload returned for download image request")
 	}
 
+	imgData := resp.Payload.GetImageResponse.ImageData
+	if _, _, err := imaging.Validate(imgData, config.ImageLimits(viper.GetViper())); err != nil {
+		return fmt.Errorf("downloaded invalid image %s: %s", fileName, err)
+	}
+
 	filePath := b.getFilePath(fileName)
 
-	err = os.WriteFile(filePath, resp.Payload.GetImageResponse.ImageData, 0644)
+	err = os.WriteFile(filePath, imgData, 0644)
 	if err != nil {
 		return fmt.Errorf("unable to write image data to file %s: %s", filePath, err)
 	}
@@ -398,14 +568,33 @@ func (b *Barnacle) getIdentity() (*message.Identity, error) {
 	display, err := b.detectDisplay()
 	var errMsg string
 	if err != nil {
-		log.Println("error detecting display:", err)
+		b.log.Warn("error detecting display", logging.Err(err))
 		errMsg = err.Error()
 		// Continue to identify anyway, display will be nil.
 	}
 
 	name := viper.GetString(config.NodeNameConfigKey)
 	orient := viper.GetString(config.NodeOrientationConfigKey)
-	labels := viper.GetStringSlice(config.NodeLabelsConfigKey)
+	if o, ok := config.TranslateOrientation(orient); ok {
+		orient = string(o)
+	}
+	labels, err := message.ParseLabels(viper.GetStringSlice(config.NodeLabelsConfigKey))
+	if err != nil {
+		return nil, err
+	}
+
+	quietHours, err := message.ParseQuietHours(viper.GetString(config.NodeQuietHoursConfigKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var budget *message.RefreshBudget
+	if b := (message.RefreshBudget{
+		PerHour: viper.GetInt(config.NodeMaxRefreshesPerHourConfigKey),
+		PerDay:  viper.GetInt(config.NodeMaxRefreshesPerDayConfigKey),
+	}); !b.Empty() {
+		budget = &b
+	}
 
 	return &message.Identity{
 		Name:           name,
@@ -418,6 +607,8 @@ func (b *Barnacle) getIdentity() (*message.Identity, error) {
 		PID:            os.Getpid(),
 		Display:        display,
 		DisplayIDError: errMsg,
+		QuietHours:     quietHours,
+		RefreshBudget:  budget,
 	}, nil
 }
 
@@ -454,26 +645,26 @@ func toKV(b []byte, sep string) map[string]string {
 func displayToWH(kv map[string]string) (int, int) {
 	displayStr, ok := kv["Display"]
 	if !ok {
-		log.Println("could not find display field")
+		slog.Warn("could not find display field")
 		return 0, 0
 	}
 
 	d := strings.Split(displayStr, "x")
 
 	if len(d) != 2 {
-		log.Printf("display field %q did not split as expected", displayStr)
+		slog.Warn("display field did not split as expected", "display", displayStr)
 		return 0, 0
 	}
 
 	w, err := strconv.Atoi(strings.TrimSpace(d[0]))
 	if err != nil {
-		log.Printf("error parsing width %q: %s", d[0], err)
+		slog.Warn("error parsing width", "width", d[0], logging.Err(err))
 		return 0, 0
 	}
 
 	h, err := strconv.Atoi(strings.TrimSpace(d[1]))
 	if err != nil {
-		log.Printf("error parsing height %q: %s", d[1], err)
+		slog.Warn("error parsing height", "height", d[1], logging.Err(err))
 		return 0, 0
 	}
 
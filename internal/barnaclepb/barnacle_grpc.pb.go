@@ -0,0 +1,327 @@
+// Control API for a barnacle-net server. Each RPC mirrors a websocket op and
+// is handled by the same server logic.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: barnacle/v1/barnacle.proto
+
+package barnaclepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Barnacle_ListNodes_FullMethodName   = "/barnacle.v1.Barnacle/ListNodes"
+	Barnacle_ListFiles_FullMethodName   = "/barnacle.v1.Barnacle/ListFiles"
+	Barnacle_ShowImages_FullMethodName  = "/barnacle.v1.Barnacle/ShowImages"
+	Barnacle_ConfigSet_FullMethodName   = "/barnacle.v1.Barnacle/ConfigSet"
+	Barnacle_WatchEvents_FullMethodName = "/barnacle.v1.Barnacle/WatchEvents"
+	Barnacle_UploadImage_FullMethodName = "/barnacle.v1.Barnacle/UploadImage"
+)
+
+// BarnacleClient is the client API for Barnacle service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BarnacleClient interface {
+	// ListNodes lists connected nodes and, optionally, CLI clients.
+	ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error)
+	// ListFiles lists the images stored on the server and on every node.
+	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
+	// ShowImages displays images on eligible nodes. Images sent without data
+	// refer to images already stored on the server.
+	ShowImages(ctx context.Context, in *ShowImagesRequest, opts ...grpc.CallOption) (*ShowImagesResponse, error)
+	// ConfigSet applies config to connected nodes by name.
+	ConfigSet(ctx context.Context, in *ConfigSetRequest, opts ...grpc.CallOption) (*ConfigSetResponse, error)
+	// WatchEvents streams server events until the call is canceled.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// UploadImage stores an image on the server. The first message must set
+	// name; data may be split across any number of messages.
+	UploadImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadImageRequest, FileInfo], error)
+}
+
+type barnacleClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBarnacleClient(cc grpc.ClientConnInterface) BarnacleClient {
+	return &barnacleClient{cc}
+}
+
+func (c *barnacleClient) ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListNodesResponse)
+	err := c.cc.Invoke(ctx, Barnacle_ListNodes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *barnacleClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFilesResponse)
+	err := c.cc.Invoke(ctx, Barnacle_ListFiles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *barnacleClient) ShowImages(ctx context.Context, in *ShowImagesRequest, opts ...grpc.CallOption) (*ShowImagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShowImagesResponse)
+	err := c.cc.Invoke(ctx, Barnacle_ShowImages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *barnacleClient) ConfigSet(ctx context.Context, in *ConfigSetRequest, opts ...grpc.CallOption) (*ConfigSetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfigSetResponse)
+	err := c.cc.Invoke(ctx, Barnacle_ConfigSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *barnacleClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Barnacle_ServiceDesc.Streams[0], Barnacle_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Barnacle_WatchEventsClient = grpc.ServerStreamingClient[Event]
+
+func (c *barnacleClient) UploadImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadImageRequest, FileInfo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Barnacle_ServiceDesc.Streams[1], Barnacle_UploadImage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadImageRequest, FileInfo]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Barnacle_UploadImageClient = grpc.ClientStreamingClient[UploadImageRequest, FileInfo]
+
+// BarnacleServer is the server API for Barnacle service.
+// All implementations must embed UnimplementedBarnacleServer
+// for forward compatibility.
+type BarnacleServer interface {
+	// ListNodes lists connected nodes and, optionally, CLI clients.
+	ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error)
+	// ListFiles lists the images stored on the server and on every node.
+	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
+	// ShowImages displays images on eligible nodes. Images sent without data
+	// refer to images already stored on the server.
+	ShowImages(context.Context, *ShowImagesRequest) (*ShowImagesResponse, error)
+	// ConfigSet applies config to connected nodes by name.
+	ConfigSet(context.Context, *ConfigSetRequest) (*ConfigSetResponse, error)
+	// WatchEvents streams server events until the call is canceled.
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error
+	// UploadImage stores an image on the server. The first message must set
+	// name; data may be split across any number of messages.
+	UploadImage(grpc.ClientStreamingServer[UploadImageRequest, FileInfo]) error
+	mustEmbedUnimplementedBarnacleServer()
+}
+
+// UnimplementedBarnacleServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBarnacleServer struct{}
+
+func (UnimplementedBarnacleServer) ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNodes not implemented")
+}
+func (UnimplementedBarnacleServer) ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
+}
+func (UnimplementedBarnacleServer) ShowImages(context.Context, *ShowImagesRequest) (*ShowImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ShowImages not implemented")
+}
+func (UnimplementedBarnacleServer) ConfigSet(context.Context, *ConfigSetRequest) (*ConfigSetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfigSet not implemented")
+}
+func (UnimplementedBarnacleServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedBarnacleServer) UploadImage(grpc.ClientStreamingServer[UploadImageRequest, FileInfo]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadImage not implemented")
+}
+func (UnimplementedBarnacleServer) mustEmbedUnimplementedBarnacleServer() {}
+func (UnimplementedBarnacleServer) testEmbeddedByValue()                  {}
+
+// UnsafeBarnacleServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BarnacleServer will
+// result in compilation errors.
+type UnsafeBarnacleServer interface {
+	mustEmbedUnimplementedBarnacleServer()
+}
+
+func RegisterBarnacleServer(s grpc.ServiceRegistrar, srv BarnacleServer) {
+	// If the following call pancis, it indicates UnimplementedBarnacleServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Barnacle_ServiceDesc, srv)
+}
+
+func _Barnacle_ListNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BarnacleServer).ListNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Barnacle_ListNodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BarnacleServer).ListNodes(ctx, req.(*ListNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Barnacle_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BarnacleServer).ListFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Barnacle_ListFiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BarnacleServer).ListFiles(ctx, req.(*ListFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Barnacle_ShowImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShowImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BarnacleServer).ShowImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Barnacle_ShowImages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BarnacleServer).ShowImages(ctx, req.(*ShowImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Barnacle_ConfigSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BarnacleServer).ConfigSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Barnacle_ConfigSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BarnacleServer).ConfigSet(ctx, req.(*ConfigSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Barnacle_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BarnacleServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Barnacle_WatchEventsServer = grpc.ServerStreamingServer[Event]
+
+func _Barnacle_UploadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BarnacleServer).UploadImage(&grpc.GenericServerStream[UploadImageRequest, FileInfo]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Barnacle_UploadImageServer = grpc.ClientStreamingServer[UploadImageRequest, FileInfo]
+
+// Barnacle_ServiceDesc is the grpc.ServiceDesc for Barnacle service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Barnacle_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "barnacle.v1.Barnacle",
+	HandlerType: (*BarnacleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListNodes",
+			Handler:    _Barnacle_ListNodes_Handler,
+		},
+		{
+			MethodName: "ListFiles",
+			Handler:    _Barnacle_ListFiles_Handler,
+		},
+		{
+			MethodName: "ShowImages",
+			Handler:    _Barnacle_ShowImages_Handler,
+		},
+		{
+			MethodName: "ConfigSet",
+			Handler:    _Barnacle_ConfigSet_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Barnacle_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "UploadImage",
+			Handler:       _Barnacle_UploadImage_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "barnacle/v1/barnacle.proto",
+}
@@ -0,0 +1,5 @@
+// Package barnaclepb holds the generated gRPC control API. Regenerate it after
+// editing proto/barnacle/v1/barnacle.proto.
+package barnaclepb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/redgoat650/barnacle-net --go-grpc_out=../.. --go-grpc_opt=module=github.com/redgoat650/barnacle-net barnacle/v1/barnacle.proto
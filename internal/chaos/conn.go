@@ -0,0 +1,362 @@
+package chaos
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/transport"
+)
+
+const (
+	// defaultReorderFlush is how long a reordered message is held if its
+	// rule sets no delay.
+	defaultReorderFlush = time.Second
+)
+
+var ErrSevered = errors.New("chaos: connection severed")
+
+// Conn wraps a transport.Conn and applies the faults described by a Plan to
+// every message passing through it.
+type Conn struct {
+	conn transport.Conn
+	plan *Plan
+
+	// Guards rule state and the random source.
+	mu      *sync.Mutex
+	rng     *rand.Rand
+	matched []int
+	fired   []int
+
+	// Messages read from conn by readLoop, started by the first read. Once
+	// conn fails, readErr is set and readDone closed.
+	reads     chan *rawMessage
+	readOnce  *sync.Once
+	readErr   error
+	readDone  chan struct{}
+	closed    chan struct{}
+	closeOnce *sync.Once
+
+	// Only touched from the (single) reader goroutine.
+	readQ     []*rawMessage
+	heldIn    *rawMessage
+	heldInDue time.Time
+	failed    error // Returned once readQ is drained.
+
+	wMu     *sync.Mutex
+	heldOut *message.Message
+}
+
+type rawMessage struct {
+	messageType int
+	data        []byte
+	err         error
+}
+
+// Wrap returns conn with the faults from plan applied. A nil plan passes all
+// messages through untouched.
+func Wrap(conn transport.Conn, plan *Plan) *Conn {
+	if plan == nil {
+		plan = NewPlan()
+	}
+
+	seed := plan.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &Conn{
+		conn:      conn,
+		plan:      plan,
+		mu:        new(sync.Mutex),
+		rng:       rand.New(rand.NewSource(seed)),
+		matched:   make([]int, len(plan.Rules)),
+		fired:     make([]int, len(plan.Rules)),
+		reads:     make(chan *rawMessage),
+		readOnce:  new(sync.Once),
+		readDone:  make(chan struct{}),
+		closed:    make(chan struct{}),
+		closeOnce: new(sync.Once),
+		wMu:       new(sync.Mutex),
+	}
+}
+
+// Sever closes the underlying connection, as if the network dropped it.
+func (c *Conn) Sever() error {
+	return c.Close()
+}
+
+// pick returns the first rule that fires for m, if any.
+func (c *Conn) pick(dir Direction, m *message.Message) (Rule, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, r := range c.plan.Rules {
+		if !r.matches(dir, m) {
+			continue
+		}
+
+		c.matched[i]++
+		if c.matched[i] <= r.After {
+			continue
+		}
+
+		if r.Count > 0 && c.fired[i] >= r.Count {
+			continue
+		}
+
+		if r.Probability > 0 && c.rng.Float64() >= r.Probability {
+			continue
+		}
+
+		c.fired[i]++
+
+		return r, true
+	}
+
+	return Rule{}, false
+}
+
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	c.readOnce.Do(func() {
+		go c.readLoop()
+	})
+
+	for {
+		if len(c.readQ) > 0 {
+			next := c.readQ[0]
+			c.readQ = c.readQ[1:]
+			return next.messageType, next.data, nil
+		}
+
+		if c.failed != nil {
+			return 0, nil, c.failed
+		}
+
+		in := c.next()
+		if in == nil {
+			// Nothing came along to overtake the held message in time.
+			c.readQ = append(c.readQ, c.heldIn)
+			c.heldIn = nil
+			continue
+		}
+
+		if in.err != nil {
+			c.fail(in.err)
+			continue
+		}
+
+		m := &message.Message{}
+		if err := json.Unmarshal(in.data, m); err != nil {
+			// Not ours to judge; let the transport reject it.
+			return in.messageType, in.data, nil
+		}
+
+		r, ok := c.pick(Inbound, m)
+		if !ok {
+			c.deliver(in)
+			continue
+		}
+
+		slog.Info("chaos: injecting inbound fault", "action", r.Action, logging.OpKey, opOf(m))
+
+		switch r.Action {
+		case DelayAction:
+			time.Sleep(r.Delay)
+			c.deliver(in)
+		case DropAction:
+		case DuplicateAction:
+			c.deliver(in)
+			c.readQ = append(c.readQ, in)
+		case ReorderAction:
+			if c.heldIn != nil {
+				c.deliver(in)
+				continue
+			}
+			c.heldIn = in
+			c.heldInDue = time.Now().Add(reorderFlush(r))
+		case SeverAction:
+			c.Sever()
+			c.fail(ErrSevered)
+		}
+	}
+}
+
+// fail ends reading with err, once any held message has been read.
+func (c *Conn) fail(err error) {
+	if c.heldIn != nil {
+		c.readQ = append(c.readQ, c.heldIn)
+		c.heldIn = nil
+	}
+
+	c.failed = err
+}
+
+// next returns the next message read from conn, one carrying the error if
+// conn failed or was closed, or nil if a held message is due to be released
+// first.
+func (c *Conn) next() *rawMessage {
+	var due <-chan time.Time
+	if c.heldIn != nil {
+		tm := time.NewTimer(time.Until(c.heldInDue))
+		defer tm.Stop()
+		due = tm.C
+	}
+
+	select {
+	case in := <-c.reads:
+		return in
+	case <-c.readDone:
+		return &rawMessage{err: c.readErr}
+	case <-c.closed:
+		return &rawMessage{err: ErrSevered}
+	case <-due:
+		return nil
+	}
+}
+
+// readLoop reads from conn until it fails, so that a read can give up
+// waiting to release a held message.
+func (c *Conn) readLoop() {
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.readErr = err
+			close(c.readDone)
+			return
+		}
+
+		select {
+		case c.reads <- &rawMessage{messageType: messageType, data: data}:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// deliver queues m for the reader, releasing any held message behind it.
+func (c *Conn) deliver(m *rawMessage) {
+	c.readQ = append(c.readQ, m)
+
+	if c.heldIn != nil {
+		c.readQ = append(c.readQ, c.heldIn)
+		c.heldIn = nil
+	}
+}
+
+func (c *Conn) WriteJSON(v any) error {
+	m, ok := v.(*message.Message)
+	if !ok {
+		return c.conn.WriteJSON(v)
+	}
+
+	r, ok := c.pick(Outbound, m)
+	if !ok {
+		return c.write(m)
+	}
+
+	slog.Info("chaos: injecting outbound fault", "action", r.Action, logging.OpKey, opOf(m))
+
+	switch r.Action {
+	case DelayAction:
+		time.Sleep(r.Delay)
+		return c.write(m)
+	case DropAction:
+		return nil
+	case DuplicateAction:
+		if err := c.write(m); err != nil {
+			return err
+		}
+		return c.write(m)
+	case ReorderAction:
+		return c.hold(m, reorderFlush(r))
+	case SeverAction:
+		c.Sever()
+		return ErrSevered
+	}
+
+	return c.write(m)
+}
+
+// write sends m followed by any held outbound message.
+func (c *Conn) write(m *message.Message) error {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	if err := c.conn.WriteJSON(m); err != nil {
+		return err
+	}
+
+	if held := c.heldOut; held != nil {
+		c.heldOut = nil
+		return c.conn.WriteJSON(held)
+	}
+
+	return nil
+}
+
+func (c *Conn) hold(m *message.Message, flushAfter time.Duration) error {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	if c.heldOut != nil {
+		// Already holding one back; this one overtakes it.
+		held := c.heldOut
+		c.heldOut = nil
+
+		if err := c.conn.WriteJSON(m); err != nil {
+			return err
+		}
+		return c.conn.WriteJSON(held)
+	}
+
+	c.heldOut = m
+	time.AfterFunc(flushAfter, c.flush)
+
+	return nil
+}
+
+// reorderFlush returns how long r holds a message back if nothing overtakes
+// it.
+func reorderFlush(r Rule) time.Duration {
+	if r.Delay > 0 {
+		return r.Delay
+	}
+
+	return defaultReorderFlush
+}
+
+func (c *Conn) flush() {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	if c.heldOut == nil {
+		return
+	}
+
+	if err := c.conn.WriteJSON(c.heldOut); err != nil {
+		slog.Warn("chaos: flushing held message", logging.Err(err))
+	}
+	c.heldOut = nil
+}
+
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *Conn) SetReadLimit(limit int64) {
+	c.conn.SetReadLimit(limit)
+}
+
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return c.conn.Close()
+}
@@ -0,0 +1,257 @@
+package chaos
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/transport"
+)
+
+// pipeConn is one end of an in-memory transport.Conn pair.
+type pipeConn struct {
+	in  <-chan []byte
+	out chan<- []byte
+
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newPipe() (*pipeConn, *pipeConn) {
+	ab, ba := make(chan []byte, 10), make(chan []byte, 10)
+	closed, once := make(chan struct{}), new(sync.Once)
+
+	return &pipeConn{in: ba, out: ab, closed: closed, once: once},
+		&pipeConn{in: ab, out: ba, closed: closed, once: once}
+}
+
+func (p *pipeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case b := <-p.in:
+		return websocket.TextMessage, b, nil
+	case <-p.closed:
+		return 0, nil, errors.New("pipe closed")
+	}
+}
+
+func (p *pipeConn) WriteJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case p.out <- b:
+		return nil
+	case <-p.closed:
+		return errors.New("pipe closed")
+	}
+}
+
+func (p *pipeConn) WriteMessage(messageType int, data []byte) error {
+	return nil
+}
+
+func (p *pipeConn) SetReadLimit(limit int64) {}
+
+func (p *pipeConn) Close() error {
+	p.once.Do(func() {
+		close(p.closed)
+	})
+
+	return nil
+}
+
+func TestSeverRepliesToInflight(t *testing.T) {
+	a, b := newPipe()
+
+	// Cut the conn as the answer to the first command arrives.
+	client := transport.NewTransportForConn(Wrap(a, NewPlan(Rule{
+		Action:    SeverAction,
+		Direction: Inbound,
+		Kind:      ResponseKind,
+	})), transport.Options{})
+	peer := transport.NewTransportForConn(b, transport.Options{})
+
+	go func() {
+		for cmd := range peer.IncomingCmds() {
+			peer.SendResponse(nil, nil, cmd)
+		}
+	}()
+
+	respCh, err := client.SendCommand(&message.Command{Op: message.IdentifyCmd})
+	if err != nil {
+		t.Fatalf("sending command: %s", err)
+	}
+
+	resp, err := transport.WaitOnResponse(respCh, 5*time.Second)
+	if err != nil {
+		t.Fatalf("waiting on response: %s", err)
+	}
+
+	if resp.Success || resp.Error != "transport shutting down" {
+		t.Errorf("got response %+v, want a closing reply", resp)
+	}
+
+	if _, err := client.SendCommand(&message.Command{Op: message.IdentifyCmd}); err == nil {
+		t.Error("sending on a severed transport succeeded")
+	}
+}
+
+func TestReorderInboundFlushes(t *testing.T) {
+	a, b := newPipe()
+
+	c := Wrap(a, NewPlan(Rule{
+		Action:    ReorderAction,
+		Direction: Inbound,
+		Delay:     50 * time.Millisecond,
+	}))
+
+	tests := []message.Op{message.IdentifyCmd, message.ListFilesCmd, message.ListNodesCmd}
+
+	// The first is held until the second overtakes it; the last is held
+	// until it is flushed, as nothing follows it.
+	for _, op := range tests {
+		if err := b.WriteJSON(&message.Message{Command: &message.Command{Op: op}}); err != nil {
+			t.Fatalf("writing %s: %s", op, err)
+		}
+	}
+
+	want := []message.Op{message.ListFilesCmd, message.IdentifyCmd, message.ListNodesCmd}
+
+	done := make(chan []message.Op)
+	go func() {
+		var got []message.Op
+		for range want {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				t.Errorf("reading: %s", err)
+				break
+			}
+
+			m := &message.Message{}
+			if err := json.Unmarshal(data, m); err != nil {
+				t.Errorf("decoding: %s", err)
+				break
+			}
+			got = append(got, m.Command.Op)
+		}
+		done <- got
+	}()
+
+	select {
+	case got := <-done:
+		if len(got) != len(want) {
+			t.Fatalf("got ops %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("got ops %v, want %v", got, want)
+				break
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("held message was never released")
+	}
+}
+
+func TestCloseUnblocksRead(t *testing.T) {
+	// Run it repeatedly, as the reader and closer race.
+	for i := 0; i < 200; i++ {
+		a, _ := newPipe()
+		c := Wrap(a, nil)
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := c.ReadMessage()
+			errCh <- err
+		}()
+
+		time.Sleep(time.Millisecond)
+		c.Close()
+
+		select {
+		case err := <-errCh:
+			if err == nil {
+				t.Fatalf("run %d: read succeeded on a closed conn", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d: read still blocked after close", i)
+		}
+	}
+}
+
+func TestSeverKeepsHeldMessage(t *testing.T) {
+	a, b := newPipe()
+
+	// Hold the first message back, then cut the conn on the second.
+	c := Wrap(a, NewPlan(
+		Rule{Action: ReorderAction, Direction: Inbound, Op: message.IdentifyCmd, Delay: time.Hour},
+		Rule{Action: SeverAction, Direction: Inbound},
+	))
+
+	for _, op := range []message.Op{message.IdentifyCmd, message.ListFilesCmd} {
+		if err := b.WriteJSON(&message.Message{Command: &message.Command{Op: op}}); err != nil {
+			t.Fatalf("writing %s: %s", op, err)
+		}
+	}
+
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading held message: %s", err)
+	}
+
+	m := &message.Message{}
+	if err := json.Unmarshal(data, m); err != nil || m.Command == nil || m.Command.Op != message.IdentifyCmd {
+		t.Errorf("got %s, want the held %s command", data, message.IdentifyCmd)
+	}
+
+	if _, _, err := c.ReadMessage(); !errors.Is(err, ErrSevered) {
+		t.Errorf("got error %v, want %v", err, ErrSevered)
+	}
+}
+
+func TestLoadPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+
+	err := os.WriteFile(path, []byte(`seed: 7
+rules:
+- action: reorder
+  direction: in
+  kind: response
+  op: showImages
+  after: 2
+  count: 1
+  probability: 0.5
+  delay: 2s
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPlan(path)
+	if err != nil {
+		t.Fatalf("loading plan: %s", err)
+	}
+
+	want := Rule{
+		Action:      ReorderAction,
+		Direction:   Inbound,
+		Kind:        ResponseKind,
+		Op:          message.ShowImagesCmd,
+		After:       2,
+		Count:       1,
+		Probability: 0.5,
+		Delay:       2 * time.Second,
+	}
+
+	if p.Seed != 7 || len(p.Rules) != 1 || p.Rules[0] != want {
+		t.Errorf("got plan %+v, want seed 7 and rule %+v", p, want)
+	}
+}
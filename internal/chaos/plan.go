@@ -0,0 +1,152 @@
+package chaos
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/viper"
+)
+
+// Action is the fault applied to a message matched by a Rule.
+type Action string
+
+const (
+	// DelayAction holds the message for Rule.Delay before passing it on.
+	DelayAction Action = "delay"
+	// DropAction silently discards the message.
+	DropAction Action = "drop"
+	// DuplicateAction delivers the message twice.
+	DuplicateAction Action = "duplicate"
+	// ReorderAction holds the message back until the next message in the
+	// same direction has been delivered. It is released after Rule.Delay, or
+	// a second if unset, if nothing else passes in the meantime.
+	ReorderAction Action = "reorder"
+	// SeverAction closes the underlying connection.
+	SeverAction Action = "sever"
+)
+
+// Direction selects which side of the connection a Rule applies to.
+type Direction string
+
+const (
+	AnyDirection Direction = ""
+	Inbound      Direction = "in"
+	Outbound     Direction = "out"
+)
+
+// Kind selects whether a Rule applies to commands, responses or both.
+type Kind string
+
+const (
+	AnyKind      Kind = ""
+	CommandKind  Kind = "command"
+	ResponseKind Kind = "response"
+)
+
+// Rule describes a single fault and the messages it applies to.
+type Rule struct {
+	Action    Action     `mapstructure:"action"`
+	Direction Direction  `mapstructure:"direction"`
+	Kind      Kind       `mapstructure:"kind"`
+	Op        message.Op `mapstructure:"op"` // Responses match on the op of the command they answer.
+
+	// After skips the first After matching messages before the rule fires.
+	After int `mapstructure:"after"`
+	// Count limits the number of times the rule fires. Zero is unlimited.
+	Count int `mapstructure:"count"`
+	// Probability that a matching message is affected. Zero is treated as 1.
+	Probability float64 `mapstructure:"probability"`
+
+	Delay time.Duration `mapstructure:"delay"`
+}
+
+// Plan is a scripted set of faults to inject into a connection. Rules are
+// checked in order and the first one that fires is applied.
+type Plan struct {
+	// Seed makes probabilistic rules repeatable. Zero seeds from the clock.
+	Seed  int64  `mapstructure:"seed"`
+	Rules []Rule `mapstructure:"rules"`
+}
+
+func NewPlan(rules ...Rule) *Plan {
+	return &Plan{
+		Rules: rules,
+	}
+}
+
+// LoadPlan reads a plan from a YAML or JSON file.
+func LoadPlan(path string) (*Plan, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading chaos plan %s: %s", path, err)
+	}
+
+	p := &Plan{}
+	if err := v.Unmarshal(p); err != nil {
+		return nil, fmt.Errorf("decoding chaos plan %s: %s", path, err)
+	}
+
+	return p, p.Validate()
+}
+
+func (p *Plan) Validate() error {
+	for i, r := range p.Rules {
+		switch r.Action {
+		case DelayAction, DropAction, DuplicateAction, ReorderAction, SeverAction:
+		default:
+			return fmt.Errorf("rule %d: unrecognized action %q", i, r.Action)
+		}
+
+		switch r.Direction {
+		case AnyDirection, Inbound, Outbound:
+		default:
+			return fmt.Errorf("rule %d: unrecognized direction %q", i, r.Direction)
+		}
+
+		switch r.Kind {
+		case AnyKind, CommandKind, ResponseKind:
+		default:
+			return fmt.Errorf("rule %d: unrecognized kind %q", i, r.Kind)
+		}
+
+		if r.Probability < 0 || r.Probability > 1 {
+			return fmt.Errorf("rule %d: probability must be between 0 and 1", i)
+		}
+	}
+
+	return nil
+}
+
+func opOf(m *message.Message) message.Op {
+	switch {
+	case m.Command != nil:
+		return m.Command.Op
+	case m.Response != nil && m.Response.Command != nil:
+		return m.Response.Command.Op
+	}
+
+	return ""
+}
+
+func (r Rule) matches(dir Direction, m *message.Message) bool {
+	if r.Direction != AnyDirection && r.Direction != dir {
+		return false
+	}
+
+	var kind Kind
+	switch {
+	case m.Command != nil:
+		kind = CommandKind
+	case m.Response != nil:
+		kind = ResponseKind
+	}
+
+	if r.Kind != AnyKind && r.Kind != kind {
+		return false
+	}
+
+	return r.Op == "" || r.Op == opOf(m)
+}
@@ -4,32 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/redgoat650/barnacle-net/internal/config"
 	"github.com/redgoat650/barnacle-net/internal/deploy"
 	"github.com/redgoat650/barnacle-net/internal/hash"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/selector"
+	"github.com/redgoat650/barnacle-net/internal/trace"
 	"github.com/redgoat650/barnacle-net/internal/transport"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-func ListNodes(refresh bool) error {
+func ListNodes(refresh, clients bool, sel string) error {
+	if err := checkSelector(sel); err != nil {
+		return err
+	}
+
 	t, err := connect()
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		fmt.Println("closing websocket:", t.GracefullyClose())
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
 	}()
 
-	c := makeListNodesCmd(refresh)
+	c := makeListNodesCmd(refresh, clients, sel)
 
 	respCh, err := t.SendCommand(c)
 	if err != nil {
@@ -52,6 +64,28 @@ func ListNodes(refresh bool) error {
 	return displayJSON(resp.Payload.ListNodesResponse)
 }
 
+// NodeStatus prints a node's status, including what it is showing. Nodes
+// that aren't connected are reported with what they were last shown.
+func NodeStatus(name string) error {
+	rp, err := request(&message.Command{
+		Op: message.NodeStatusCmd,
+		Payload: &message.CommandPayload{
+			NodeStatusPayload: &message.NodeStatusPayload{
+				Name: name,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.NodeStatusResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return displayJSON(rp.NodeStatusResponse)
+}
+
 func displayJSON(p any) error {
 	b, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
@@ -62,6 +96,63 @@ func displayJSON(p any) error {
 	return nil
 }
 
+// readFile returns the contents of a file, or of stdin if path is "-".
+func readFile(path string) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", path, err)
+	}
+
+	return b, nil
+}
+
+// readJSONFile decodes a JSON file, or stdin if path is "-", into v.
+func readJSONFile(path string, v any) error {
+	b, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("decoding %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// readYAMLFile decodes a YAML or JSON file, or stdin if path is "-", into v.
+// The document is converted to JSON first so v's JSON field names apply.
+func readYAMLFile(path string, v any) error {
+	b, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("decoding %s: %s", path, err)
+	}
+
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %s", path, err)
+	}
+
+	if err := json.Unmarshal(j, v); err != nil {
+		return fmt.Errorf("decoding %s: %s", path, err)
+	}
+
+	return nil
+}
+
 func ConfigSet(cfgs ...deploy.NodeDeploySettings) error {
 	t, err := connect()
 	if err != nil {
@@ -91,6 +182,8 @@ func ConfigSet(cfgs ...deploy.NodeDeploySettings) error {
 		return err
 	}
 
+	slog.Info("sent request", slog.String(logging.TraceKey, c.TraceID))
+
 	if !resp.Success {
 		return fmt.Errorf("error from request: %s", resp.Error)
 	}
@@ -98,17 +191,170 @@ func ConfigSet(cfgs ...deploy.NodeDeploySettings) error {
 	return nil
 }
 
-func ShowImage(node string, fit string, imgPaths ...string) error {
+// Trace prints the span tree of a trace. Spans are read from the server, or
+// from a local JSON lines export if file is set.
+func Trace(traceID, file string) error {
+	if file != "" {
+		spans, err := trace.ReadTrace(file, traceID)
+		if err != nil {
+			return err
+		}
+
+		return printTrace(traceID, spans)
+	}
+
 	t, err := connect()
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		fmt.Println("closing websocket:", t.GracefullyClose())
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
 	}()
 
-	c, err := makeShowImageCmd(node, fit, imgPaths...)
+	c := &message.Command{
+		Op: message.GetTraceCmd,
+		Payload: &message.CommandPayload{
+			GetTracePayload: &message.GetTracePayload{
+				TraceID: traceID,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("error from request: %s", resp.Error)
+	}
+
+	if resp.Payload == nil || resp.Payload.GetTraceResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return printTrace(traceID, resp.Payload.GetTraceResponse.Spans)
+}
+
+// Watch prints server events matching the given filters to stdout as JSON
+// lines until interrupted or the server closes the connection.
+func Watch(types []message.EventType, nodes []string) error {
+	t, err := connect()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
+	}()
+
+	c := &message.Command{
+		Op: message.WatchEventsCmd,
+		Payload: &message.CommandPayload{
+			WatchEventsPayload: &message.WatchEventsPayload{
+				Types: types,
+				Nodes: nodes,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration(config.ClientTimeoutKey))
+	defer cancel()
+
+	resp, err := t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("error from request: %s", resp.Error)
+	}
+
+	slog.Info("watching events", slog.String(logging.TraceKey, c.TraceID))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	enc := json.NewEncoder(os.Stdout)
+
+	for {
+		select {
+		case cmd := <-t.IncomingCmds():
+			if cmd == nil {
+				return errors.New("server closed the connection")
+			}
+
+			if cmd.Op != message.EventCmd {
+				t.SendResponse(nil, fmt.Errorf("unexpected command: %s", cmd.Op), cmd)
+				continue
+			}
+
+			if err := enc.Encode(cmd.Payload.EventPayload.Event); err != nil {
+				return err
+			}
+
+			if err := t.SendResponse(nil, nil, cmd); err != nil {
+				return err
+			}
+
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+func printTrace(traceID string, spans []message.Span) error {
+	if len(spans) == 0 {
+		return fmt.Errorf("no spans recorded for trace %s", traceID)
+	}
+
+	trace.PrintTree(os.Stdout, spans)
+
+	return nil
+}
+
+// ShowOptions say where and how images are shown.
+type ShowOptions struct {
+	Nodes    []string // Names of nodes to choose among; all if empty.
+	Selector string
+	Wall     string
+	Fit      string
+	Force    bool
+	DryRun   bool // Only print where images would go.
+
+	// Assign names the strategy used to place images on nodes, and Seed
+	// seeds the random strategy.
+	Assign string
+	Seed   *int64
+
+	// TTL, if set, shows the images as alerts for that long, ranked against
+	// other alerts by Priority.
+	TTL      time.Duration
+	Priority int
+}
+
+// ShowImage shows images on nodes chosen by opts. Arguments of the form
+// node=image instead show the image on that node.
+func ShowImage(opts ShowOptions, args ...string) error {
+	if err := checkSelector(opts.Selector); err != nil {
+		return err
+	}
+
+	t, err := connect()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
+	}()
+
+	c, err := makeShowImageCmd(opts, args...)
 	if err != nil {
 		return err
 	}
@@ -118,16 +364,26 @@ func ShowImage(node string, fit string, imgPaths ...string) error {
 		return err
 	}
 
+	slog.Info("sent request", slog.String(logging.TraceKey, c.TraceID))
+
 	resp, err := transport.WaitOnResponse(respCh, viper.GetDuration(config.ClientTimeoutKey))
 	if err != nil {
 		return err
 	}
 
+	if resp.Payload != nil && resp.Payload.ShowImagesResponse != nil {
+		if err := displayJSON(resp.Payload.ShowImagesResponse.Results); err != nil {
+			return err
+		}
+	}
+
 	if !resp.Success {
 		return fmt.Errorf("error from request: %s", resp.Error)
 	}
 
-	fmt.Println("success")
+	if !opts.DryRun {
+		slog.Info("images shown")
+	}
 
 	return nil
 }
@@ -139,7 +395,7 @@ func ListFiles() error {
 	}
 
 	defer func() {
-		fmt.Println("closing websocket:", t.GracefullyClose())
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
 	}()
 
 	c := makeListFilesCmd()
@@ -165,13 +421,24 @@ func makeListFilesCmd() *message.Command {
 	}
 }
 
-func makeShowImageCmd(node string, fit string, imgPaths ...string) (*message.Command, error) {
+func makeShowImageCmd(opts ShowOptions, args ...string) (*message.Command, error) {
+	assigned, imgPaths := parseShowArgs(args)
+
 	irefs, err := makeImageRefs(imgPaths...)
 	if err != nil {
 		return nil, err
 	}
 
-	fitMsg, err := fitStrToPolicy(fit)
+	var nodeSels []message.NodeSelector
+	for _, node := range opts.Nodes {
+		nodeSels = append(nodeSels, message.NodeSelector{
+			Logic: message.LogicOr,
+			Key:   message.NameSelKey,
+			Value: node,
+		})
+	}
+
+	fitMsg, err := fitStrToPolicy(opts.Fit)
 	if err != nil {
 		return nil, err
 	}
@@ -180,13 +447,61 @@ func makeShowImageCmd(node string, fit string, imgPaths ...string) (*message.Com
 		Op: message.ShowImagesCmd,
 		Payload: &message.CommandPayload{
 			ShowImagesPayload: &message.ShowImagesPayload{
-				Images:    irefs,
-				FitPolicy: fitMsg,
+				Images:        irefs,
+				FitPolicy:     fitMsg,
+				Force:         opts.Force,
+				Wall:          opts.Wall,
+				Selector:      opts.Selector,
+				NodeSelectors: nodeSels,
+				Nodes:         assigned,
+				Assign:        opts.Assign,
+				Seed:          opts.Seed,
+				DryRun:        opts.DryRun,
+				TTL:           opts.TTL,
+				Priority:      opts.Priority,
 			},
 		},
 	}, nil
 }
 
+// parseShowArgs splits show arguments into image paths and the node each
+// is assigned to, or "" if it isn't. An argument node=image assigns the
+// image unless it names an existing file or a URL. nodes is nil if no image
+// is assigned.
+func parseShowArgs(args []string) (nodes, imgPaths []string) {
+	assigned := false
+
+	for _, arg := range args {
+		node, img, ok := strings.Cut(arg, "=")
+		if !ok || node == "" || strings.ContainsAny(node, "/:") {
+			node, img = "", arg
+		} else if _, err := os.Stat(arg); err == nil {
+			node, img = "", arg
+		}
+
+		assigned = assigned || node != ""
+		nodes = append(nodes, node)
+		imgPaths = append(imgPaths, img)
+	}
+
+	if !assigned {
+		nodes = nil
+	}
+
+	return nodes, imgPaths
+}
+
+// checkSelector parses a selector expression, if one is given, so mistakes
+// are reported before connecting to the server.
+func checkSelector(expr string) error {
+	if expr == "" {
+		return nil
+	}
+
+	_, err := selector.Parse(expr)
+	return err
+}
+
 func fitStrToPolicy(s string) (message.FitPolicy, error) {
 	switch s {
 	case "crop", message.CropToFit:
@@ -237,7 +552,7 @@ func tryPathAsURL(imgPath string) (*message.ImageData, bool) {
 
 	_, err = io.Copy(buf, resp.Body)
 	if err != nil {
-		log.Println("error copying http body to a buffer:", err)
+		slog.Warn("error copying http body to a buffer", logging.Err(err))
 		return nil, false
 	}
 
@@ -245,7 +560,7 @@ func tryPathAsURL(imgPath string) (*message.ImageData, bool) {
 
 	h, err := hash.HashBytes(b)
 	if err != nil {
-		log.Println("hashing data:", err)
+		slog.Warn("hashing data", logging.Err(err))
 		return nil, false
 	}
 
@@ -257,12 +572,14 @@ func tryPathAsURL(imgPath string) (*message.ImageData, bool) {
 	}, true
 }
 
-func makeListNodesCmd(refresh bool) *message.Command {
+func makeListNodesCmd(refresh, clients bool, sel string) *message.Command {
 	return &message.Command{
 		Op: message.ListNodesCmd,
 		Payload: &message.CommandPayload{
 			ListNodesPayload: &message.ListNodesPayload{
 				RefreshIdentities: refresh,
+				IncludeClients:    clients,
+				Selector:          sel,
 			},
 		},
 	}
@@ -270,11 +587,11 @@ func makeListNodesCmd(refresh bool) *message.Command {
 
 func connect() (*transport.Transport, error) {
 	server := viper.GetString(config.ConnectServerAddrCfgPath)
-	path := viper.GetString(config.ConnectWebsocketPathCfgPath)
+	path := config.WebsocketPath(viper.GetString(config.ConnectWebsocketPathCfgPath), message.ClientRole)
 
-	fmt.Println("Connecting to:", server, "at", path)
+	slog.Debug("connecting to server", "server", server, "path", path)
 
-	t, err := transport.NewTransportConn(server, path)
+	t, err := transport.NewTransportConn(server, path, config.TransportOptions(viper.GetViper()))
 	if err != nil {
 		return nil, fmt.Errorf("instantiating transport: %s", err)
 	}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/config"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/viper"
+)
+
+// History formats.
+const (
+	HistoryJSON = "json"
+	HistoryCSV  = "csv"
+)
+
+// History prints a node's display history as JSON or CSV.
+func History(node, format string) error {
+	if format != HistoryJSON && format != HistoryCSV {
+		return fmt.Errorf("unknown format %q, want %s or %s", format, HistoryJSON, HistoryCSV)
+	}
+
+	rp, err := request(&message.Command{
+		Op: message.HistoryCmd,
+		Payload: &message.CommandPayload{
+			HistoryPayload: &message.HistoryPayload{
+				Node: node,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.HistoryResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	if format == HistoryCSV {
+		return writeHistoryCSV(rp.HistoryResponse)
+	}
+
+	return displayJSON(rp.HistoryResponse)
+}
+
+// writeHistoryCSV prints a row for each history entry, oldest first.
+func writeHistoryCSV(h *message.HistoryResponsePayload) error {
+	w := csv.NewWriter(os.Stdout)
+
+	header := []string{"seq", "current", "shownTime", "node", "image", "hash", "fitPolicy", "saturation", "rotationDeg", "shownBy", "move"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, e := range h.Entries {
+		err := w.Write([]string{
+			strconv.Itoa(e.Seq),
+			strconv.FormatBool(e.Seq == h.Current),
+			e.ShownTime.Format(time.RFC3339),
+			h.Node,
+			e.Name,
+			e.Hash,
+			string(e.FitPolicy),
+			strconv.FormatFloat(e.Saturation, 'f', -1, 64),
+			strconv.Itoa(e.RotationDeg),
+			e.ShownBy,
+			string(e.Move),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+// HistoryMove shows a node the image before or after the one it is showing
+// in its history, printing what became of it.
+func HistoryMove(node string, move message.HistoryMove, force bool) error {
+	t, err := connect()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
+	}()
+
+	op := message.HistoryBackCmd
+	if move == message.HistoryForward {
+		op = message.HistoryForwardCmd
+	}
+
+	c := &message.Command{
+		Op: op,
+		Payload: &message.CommandPayload{
+			HistoryMovePayload: &message.HistoryMovePayload{
+				Node:  node,
+				Force: force,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration(config.ClientTimeoutKey))
+	defer cancel()
+
+	resp, err := t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if resp.Payload != nil && resp.Payload.ShowImagesResponse != nil {
+		if err := displayJSON(resp.Payload.ShowImagesResponse.Results); err != nil {
+			return err
+		}
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("error from request: %s", resp.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+// Cordon takes a node out of automatic assignment, or puts it back.
+func Cordon(node string, cordoned bool) error {
+	return setNodeMode(&message.NodeModePayload{
+		Node:     node,
+		Cordoned: &cordoned,
+	})
+}
+
+// Lock pins what a node is showing, or unpins it.
+func Lock(node string, locked bool) error {
+	return setNodeMode(&message.NodeModePayload{
+		Node:   node,
+		Locked: &locked,
+	})
+}
+
+func setNodeMode(p *message.NodeModePayload) error {
+	_, err := request(&message.Command{
+		Op: message.NodeModeCmd,
+		Payload: &message.CommandPayload{
+			NodeModePayload: p,
+		},
+	})
+
+	return err
+}
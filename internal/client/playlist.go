@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/config"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/viper"
+)
+
+// CreatePlaylist creates a playlist of stored images, each given as a name
+// with an optional dwell time override, e.g. "beach.png" or "beach.png@10m".
+func CreatePlaylist(name string, dwell time.Duration, shuffle bool, fit string, items ...string) error {
+	fitMsg, err := fitStrToPolicy(fit)
+	if err != nil {
+		return err
+	}
+
+	p := message.Playlist{
+		Name:      name,
+		Dwell:     dwell,
+		Shuffle:   shuffle,
+		FitPolicy: fitMsg,
+	}
+
+	for _, s := range items {
+		item, err := parsePlaylistItem(s)
+		if err != nil {
+			return err
+		}
+
+		p.Items = append(p.Items, item)
+	}
+
+	_, err = request(&message.Command{
+		Op: message.PlaylistCreateCmd,
+		Payload: &message.CommandPayload{
+			PlaylistCreatePayload: &message.PlaylistCreatePayload{
+				Playlist: p,
+			},
+		},
+	})
+
+	return err
+}
+
+// AssignPlaylist targets a playlist at the named nodes and at nodes with
+// every one of the given labels that match the selector expression sel.
+func AssignPlaylist(name string, nodes, labels []string, sel string) error {
+	if err := checkSelector(sel); err != nil {
+		return err
+	}
+
+	target := message.NodeTarget{
+		Nodes:    nodes,
+		Selector: sel,
+	}
+
+	for _, l := range labels {
+		target.Selectors = append(target.Selectors, message.NodeSelector{
+			Logic: message.LogicAnd,
+			Key:   message.HasLabelSelKey,
+			Value: l,
+		})
+	}
+
+	_, err := request(&message.Command{
+		Op: message.PlaylistAssignCmd,
+		Payload: &message.CommandPayload{
+			PlaylistAssignPayload: &message.PlaylistAssignPayload{
+				Name:   name,
+				Target: target,
+			},
+		},
+	})
+
+	return err
+}
+
+func PausePlaylist(name string, paused bool) error {
+	_, err := request(&message.Command{
+		Op: message.PlaylistPauseCmd,
+		Payload: &message.CommandPayload{
+			PlaylistPausePayload: &message.PlaylistPausePayload{
+				Name:   name,
+				Paused: paused,
+			},
+		},
+	})
+
+	return err
+}
+
+func NextPlaylist(name string) error {
+	_, err := request(&message.Command{
+		Op: message.PlaylistNextCmd,
+		Payload: &message.CommandPayload{
+			PlaylistNextPayload: &message.PlaylistNextPayload{
+				Name: name,
+			},
+		},
+	})
+
+	return err
+}
+
+func ListPlaylists() error {
+	rp, err := request(&message.Command{
+		Op: message.ListPlaylistsCmd,
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.ListPlaylistsResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return displayJSON(rp.ListPlaylistsResponse)
+}
+
+func parsePlaylistItem(s string) (message.PlaylistItem, error) {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] != '@' {
+			continue
+		}
+
+		d, err := time.ParseDuration(s[i+1:])
+		if err != nil {
+			return message.PlaylistItem{}, fmt.Errorf("invalid dwell time in %q: %s", s, err)
+		}
+
+		return message.PlaylistItem{Image: s[:i], Dwell: d}, nil
+	}
+
+	return message.PlaylistItem{Image: s}, nil
+}
+
+// request sends a single command to the server and returns the payload of
+// its successful response.
+func request(c *message.Command) (*message.ResponsePayload, error) {
+	t, err := connect()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration(config.ClientTimeoutKey))
+	defer cancel()
+
+	resp, err := t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("got response", slog.String(logging.TraceKey, c.TraceID))
+
+	if !resp.Success {
+		return nil, fmt.Errorf("error from request: %s", resp.Error)
+	}
+
+	return resp.Payload, nil
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/redgoat650/barnacle-net/internal/config"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/spf13/viper"
+)
+
+// SetScene creates or replaces a scene described by a YAML or JSON file, or
+// by stdin if path is "-".
+func SetScene(path string) error {
+	sc := message.Scene{}
+	if err := readYAMLFile(path, &sc); err != nil {
+		return err
+	}
+
+	_, err := request(&message.Command{
+		Op: message.SceneSetCmd,
+		Payload: &message.CommandPayload{
+			SceneSetPayload: &message.SceneSetPayload{
+				Scene: sc,
+			},
+		},
+	})
+
+	return err
+}
+
+// SaveScene saves what nodes are showing now as a scene. With no nodes or
+// selector, every node showing an image is saved.
+func SaveScene(name string, nodes []string, sel string) error {
+	if err := checkSelector(sel); err != nil {
+		return err
+	}
+
+	_, err := request(&message.Command{
+		Op: message.SceneSaveCmd,
+		Payload: &message.CommandPayload{
+			SceneSavePayload: &message.SceneSavePayload{
+				Name: name,
+				Target: message.NodeTarget{
+					Nodes:    nodes,
+					Selector: sel,
+				},
+			},
+		},
+	})
+
+	return err
+}
+
+// ApplyScene shows a scene on its nodes, printing the result for each node
+// even if the scene could not be shown.
+func ApplyScene(name string, force bool) error {
+	t, err := connect()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		slog.Debug("closed websocket", logging.Err(t.GracefullyClose()))
+	}()
+
+	c := &message.Command{
+		Op: message.SceneApplyCmd,
+		Payload: &message.CommandPayload{
+			SceneApplyPayload: &message.SceneApplyPayload{
+				Name:  name,
+				Force: force,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration(config.ClientTimeoutKey))
+	defer cancel()
+
+	resp, err := t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if resp.Payload != nil && resp.Payload.ShowImagesResponse != nil {
+		if err := displayJSON(resp.Payload.ShowImagesResponse.Results); err != nil {
+			return err
+		}
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("error from request: %s", resp.Error)
+	}
+
+	return nil
+}
+
+func DeleteScene(name string) error {
+	_, err := request(&message.Command{
+		Op: message.SceneDeleteCmd,
+		Payload: &message.CommandPayload{
+			SceneDeletePayload: &message.SceneDeletePayload{
+				Name: name,
+			},
+		},
+	})
+
+	return err
+}
+
+func ListScenes() error {
+	rp, err := request(&message.Command{
+		Op: message.ListScenesCmd,
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.ListScenesResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return displayJSON(rp.ListScenesResponse)
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+// atLayouts are the formats accepted for preview times, in local time unless
+// they carry a zone.
+var atLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"15:04",
+}
+
+// SetSchedule creates or replaces a schedule described by a JSON file, or by
+// stdin if path is "-".
+func SetSchedule(path string) error {
+	sc := message.Schedule{}
+	if err := readJSONFile(path, &sc); err != nil {
+		return err
+	}
+
+	_, err := request(&message.Command{
+		Op: message.ScheduleSetCmd,
+		Payload: &message.CommandPayload{
+			ScheduleSetPayload: &message.ScheduleSetPayload{
+				Schedule: sc,
+			},
+		},
+	})
+
+	return err
+}
+
+func DeleteSchedule(name string) error {
+	_, err := request(&message.Command{
+		Op: message.ScheduleDeleteCmd,
+		Payload: &message.CommandPayload{
+			ScheduleDeletePayload: &message.ScheduleDeletePayload{
+				Name: name,
+			},
+		},
+	})
+
+	return err
+}
+
+func ListSchedules() error {
+	rp, err := request(&message.Command{
+		Op: message.ListSchedulesCmd,
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.ListSchedulesResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return displayJSON(rp.ListSchedulesResponse)
+}
+
+// PreviewSchedule shows what a node is scheduled to display at a time given
+// in one of atLayouts, or now if at is empty.
+func PreviewSchedule(node, at string) error {
+	t, err := parseAt(at, time.Now())
+	if err != nil {
+		return err
+	}
+
+	rp, err := request(&message.Command{
+		Op: message.SchedulePreviewCmd,
+		Payload: &message.CommandPayload{
+			SchedulePreviewPayload: &message.SchedulePreviewPayload{
+				Node: node,
+				Time: t,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.SchedulePreviewResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return displayJSON(rp.SchedulePreviewResponse)
+}
+
+// parseAt parses a time in one of atLayouts. A bare time of day is taken to be
+// on the same day as now.
+func parseAt(at string, now time.Time) (time.Time, error) {
+	if at == "" {
+		return now, nil
+	}
+
+	for _, layout := range atLayouts {
+		t, err := time.ParseInLocation(layout, at, time.Local)
+		if err != nil {
+			continue
+		}
+
+		if layout == "15:04" {
+			y, m, d := now.Date()
+			t = time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, time.Local)
+		}
+
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, want RFC 3339, \"2006-01-02 15:04\" or \"15:04\"", at)
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+// SetWall creates or replaces a wall described by a JSON file, or by stdin if
+// path is "-".
+func SetWall(path string) error {
+	w := message.Wall{}
+	if err := readJSONFile(path, &w); err != nil {
+		return err
+	}
+
+	_, err := request(&message.Command{
+		Op: message.WallSetCmd,
+		Payload: &message.CommandPayload{
+			WallSetPayload: &message.WallSetPayload{
+				Wall: w,
+			},
+		},
+	})
+
+	return err
+}
+
+func DeleteWall(name string) error {
+	_, err := request(&message.Command{
+		Op: message.WallDeleteCmd,
+		Payload: &message.CommandPayload{
+			WallDeletePayload: &message.WallDeletePayload{
+				Name: name,
+			},
+		},
+	})
+
+	return err
+}
+
+func ListWalls() error {
+	rp, err := request(&message.Command{
+		Op: message.ListWallsCmd,
+	})
+	if err != nil {
+		return err
+	}
+
+	if rp == nil || rp.ListWallsResponse == nil {
+		return fmt.Errorf("malformatted response")
+	}
+
+	return displayJSON(rp.ListWallsResponse)
+}
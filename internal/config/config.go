@@ -1,10 +1,15 @@
 package config
 
 import (
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/redgoat650/barnacle-net/internal/imaging"
 	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/transport"
 	"github.com/spf13/viper"
 )
 
@@ -15,24 +20,90 @@ const (
 	NodeLabelsConfigKey      = "node.labels"
 	NodeOrientationConfigKey = "node.orientation"
 
+	NodeQuietHoursConfigKey          = "node.quiethours"           // START-END[@TIMEZONE], e.g. 22:00-07:00@Europe/London
+	NodeMaxRefreshesPerHourConfigKey = "node.maxrefreshes.perhour" // 0 for no limit
+	NodeMaxRefreshesPerDayConfigKey  = "node.maxrefreshes.perday"  // 0 for no limit
+
 	NodesConfigKey = "nodes.config"
 
 	DeployImageCfgPath          = "deploy.image"       // Deploy node - image to deploy
 	DeployNodesCfgPath          = "deploy.nodes"       // Deploy node, set config - list of node configs for deploy/set config
 	ConnectServerAddrCfgPath    = "connect.serveraddr" // Deploy node - Set to the server host address
-	ConnectWebsocketPathCfgPath = "connect.wspath"     // Deploy node - Set the path to the websocket endpoint
+	ConnectWebsocketPathCfgPath = "connect.wspath"     // Deploy node - Set the base path of the websocket endpoints
+
+	DeployServerPortConfigKey     = "deploy.server.port"     // Deploy server - Set to the port to serve the server over
+	DeployServerGRPCPortConfigKey = "deploy.server.grpcport" // Deploy server - Port for the gRPC control API; empty disables it
+
+	ChaosPlanCfgPath = "chaos.plan" // Debug - path to a fault injection plan applied to websocket conns
+	TraceFileCfgPath = "trace.file" // Server - JSON lines file spans are exported to; empty disables tracing
+
+	ServerStateDirCfgPath = "server.statedir" // Server - directory playlists and other server state persist to
+
+	LogLevelCfgPath  = "log.level"  // debug, info, warn or error
+	LogFormatCfgPath = "log.format" // text or json
 
-	DeployServerPortConfigKey = "deploy.server.port" // Deploy server - Set to the port to serve the server over
+	MessageLimitDefaultKey = "limits.message.default" // Max size of an incoming message, e.g. "1mb"
+	MessageLimitOpsKey     = "limits.message.ops"     // Per-op overrides of the default, keyed by op
+	ImageMaxWidthKey       = "limits.image.maxwidth"
+	ImageMaxHeightKey      = "limits.image.maxheight"
+	ImageMaxPixelsKey      = "limits.image.maxpixels"
+	ImageFormatsKey        = "limits.image.formats"
 
 	DefaultDeployImage = "redgoat650/barnacle-net:scratch"
 )
 
 func init() {
 	viper.SetDefault(DeployServerPortConfigKey, "8080")
+	viper.SetDefault(DeployServerGRPCPortConfigKey, "9090")
 	viper.SetDefault(ConnectWebsocketPathCfgPath, "/ws")
 	viper.SetDefault(ClientTimeoutKey, 60*time.Second)
 	viper.SetDefault(NodeOrientationConfigKey, message.ButtonsL)
 	viper.SetDefault(DeployImageCfgPath, DefaultDeployImage)
+	viper.SetDefault(TraceFileCfgPath, filepath.Join(os.TempDir(), "barnacle-traces.jsonl"))
+	viper.SetDefault(ServerStateDirCfgPath, filepath.Join(os.TempDir(), "barnacle-state"))
+	viper.SetDefault(MessageLimitDefaultKey, "1mb")
+	viper.SetDefault(opLimitKey(message.ShowImagesCmd), "64mb")
+	viper.SetDefault(opLimitKey(message.GetImageCmd), "64mb")
+	viper.SetDefault(ImageMaxWidthKey, 12000)
+	viper.SetDefault(ImageMaxHeightKey, 12000)
+	viper.SetDefault(ImageMaxPixelsKey, 50_000_000)
+	viper.SetDefault(ImageFormatsKey, []string{"png", "jpeg"})
+}
+
+// WebsocketPath returns the endpoint under the websocket base path for
+// conns of the given role.
+func WebsocketPath(base string, role message.Role) string {
+	return path.Join(base, string(role))
+}
+
+func opLimitKey(op message.Op) string {
+	return MessageLimitOpsKey + "." + string(op)
+}
+
+func TransportOptions(v *viper.Viper) transport.Options {
+	l := transport.Limits{
+		Default: int64(v.GetSizeInBytes(MessageLimitDefaultKey)),
+		PerOp:   make(map[message.Op]int64),
+	}
+
+	for _, op := range message.Ops {
+		if key := opLimitKey(op); v.IsSet(key) {
+			l.PerOp[op] = int64(v.GetSizeInBytes(key))
+		}
+	}
+
+	return transport.Options{
+		Limits: l,
+	}
+}
+
+func ImageLimits(v *viper.Viper) imaging.Limits {
+	return imaging.Limits{
+		MaxWidth:  v.GetInt(ImageMaxWidthKey),
+		MaxHeight: v.GetInt(ImageMaxHeightKey),
+		MaxPixels: v.GetInt64(ImageMaxPixelsKey),
+		Formats:   v.GetStringSlice(ImageFormatsKey),
+	}
 }
 
 func TranslateOrientation(o string) (message.Orientation, bool) {
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/docker/cli/cli/command/formatter"
 	"github.com/docker/docker/api/types"
+	"github.com/mitchellh/mapstructure"
 	"github.com/redgoat650/barnacle-net/internal/config"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/redgoat650/barnacle-net/internal/message"
 	"github.com/spf13/viper"
 )
@@ -28,7 +31,12 @@ func GetValidNodeDeploySettings() (ret []NodeDeploySettings, err error) {
 	}
 
 	nodeConfigMap := map[string]message.NodeConfig{}
-	err = viper.UnmarshalKey(config.NodesConfigKey, &nodeConfigMap)
+	err = viper.UnmarshalKey(config.NodesConfigKey, &nodeConfigMap, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		// Viper's default hooks, plus reading labels from a list.
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		message.LabelsDecodeHook,
+	)))
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode config: %s", err)
 	}
@@ -59,6 +67,16 @@ func GetValidNodeDeploySettings() (ret []NodeDeploySettings, err error) {
 				nodeCfg.Orientation = &validatedOrientStr
 			}
 
+			if err := nodeCfg.Labels.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid labels provided for %s: %s", nodeDeployCfg.Name, err)
+			}
+
+			if !nodeCfg.QuietHours.Empty() {
+				if err := nodeCfg.QuietHours.Validate(); err != nil {
+					return nil, fmt.Errorf("invalid quiet hours provided for %s: %s", nodeDeployCfg.Name, err)
+				}
+			}
+
 			thisNodeDeploySettings.Config = nodeCfg
 		}
 
@@ -69,21 +87,30 @@ func GetValidNodeDeploySettings() (ret []NodeDeploySettings, err error) {
 }
 
 func DeployServer(image string) error {
-	log.Printf("deploying %s as a local server.", image)
+	slog.Info("deploying local server", "image", image)
 
 	err := cleanupExistingImage(image, "")
 	if err != nil {
 		return err
 	}
 
+	// The gRPC API is published on the same port the server serves it on,
+	// and disabled if no port is set.
+	grpcPort := viper.GetString(config.DeployServerGRPCPortConfigKey)
+
+	ports := []string{"8080:8080"}
+	if grpcPort != "" {
+		ports = append(ports, grpcPort+":"+grpcPort)
+	}
+
 	opts := RunOpts{
 		Name:          serverContainerName,
 		Detached:      true,
-		Port:          []string{"8080:8080"},
+		Port:          ports,
 		RestartPolicy: unlessStoppedRestartPolicy,
 	}
 
-	servCmd := []string{"server", "start"}
+	servCmd := []string{"server", "start", "--grpc-port=" + grpcPort}
 
 	err = dockerRun(image, "", opts, servCmd...)
 	if err != nil {
@@ -115,7 +142,7 @@ func DeployNodes(img, server string, nodes ...NodeDeploySettings) error {
 }
 
 func DeployImageToNode(node NodeDeploySettings, image, server string) error {
-	log.Printf("deploying %s to host %s, node will be named %s.", image, node.Addr, node.Name)
+	slog.Info("deploying node", "image", image, "host", node.Addr, slog.String(logging.NodeKey, node.Name))
 
 	err := cleanupExistingImage(image, node.Addr)
 	if err != nil {
@@ -133,7 +160,18 @@ func DeployImageToNode(node NodeDeploySettings, image, server string) error {
 	}
 
 	if node.Config.Labels != nil {
-		barnacleStartCmd = append(barnacleStartCmd, "--labels", fmt.Sprintf("%q", strings.Join(node.Config.Labels, ",")))
+		barnacleStartCmd = append(barnacleStartCmd, "--labels", fmt.Sprintf("%q", node.Config.Labels.String()))
+	}
+
+	if !node.Config.QuietHours.Empty() {
+		barnacleStartCmd = append(barnacleStartCmd, "--quiet-hours", node.Config.QuietHours.String())
+	}
+
+	if b := node.Config.RefreshBudget; !b.Empty() {
+		barnacleStartCmd = append(barnacleStartCmd,
+			"--max-refreshes-per-hour", strconv.Itoa(b.PerHour),
+			"--max-refreshes-per-day", strconv.Itoa(b.PerDay),
+		)
 	}
 
 	opts := RunOpts{
@@ -164,7 +202,7 @@ func cleanupExistingImage(image, nodeAddr string) error {
 		return err
 	}
 
-	fmt.Println(list)
+	slog.Debug("listed containers", "containers", list)
 
 	for _, cntr := range list {
 		if cntr["Image"] == image {
@@ -191,7 +229,7 @@ func cleanupExistingImage(image, nodeAddr string) error {
 	}
 
 	for _, img := range imgs {
-		fmt.Println(img)
+		slog.Debug("found image", "image", img)
 
 		if fmt.Sprintf("%s:%s", img["Repository"], img["Tag"]) == image {
 			id := img["ID"]
@@ -306,7 +344,7 @@ func dockerRun(image, addr string, opts RunOpts, cmd ...string) error {
 
 	out, err := runDockerCmd(args...)
 
-	fmt.Println("STDOUT:", out)
+	slog.Debug("docker output", "stdout", out)
 
 	return err
 }
@@ -319,7 +357,7 @@ func dockerContainerStop(id, addr string) error {
 
 	out, err := runDockerCmd(args...)
 
-	fmt.Println("STDOUT:", out)
+	slog.Debug("docker output", "stdout", out)
 
 	return err
 }
@@ -340,7 +378,7 @@ func dockerResourceRemove(id, resource, addr string) error {
 
 	out, err := runDockerCmd(args...)
 
-	fmt.Println("STDOUT:", out)
+	slog.Debug("docker output", "stdout", out)
 
 	return err
 }
@@ -357,7 +395,7 @@ func dockerContainerInspect(id, addr string) ([]types.ContainerJSON, error) {
 		return nil, err
 	}
 
-	fmt.Println("CONTAINER INSPECT:", out)
+	slog.Debug("container inspect", "stdout", out)
 
 	c := []types.ContainerJSON{}
 
@@ -366,8 +404,6 @@ func dockerContainerInspect(id, addr string) ([]types.ContainerJSON, error) {
 		return nil, err
 	}
 
-	fmt.Println("UNMARSHALLED", c)
-
 	return c, nil
 }
 
@@ -454,7 +490,7 @@ func runDockerCmd(cmdArgs ...string) (out string, err error) {
 		cmdArgs = cmdArgs[1:]
 	}
 
-	log.Println("running command:", dockerCmd, strings.Join(cmdArgs, " "))
+	slog.Debug("running command", "cmd", dockerCmd+" "+strings.Join(cmdArgs, " "))
 
 	cmd := exec.Command(dockerCmd, cmdArgs...)
 
@@ -462,7 +498,7 @@ func runDockerCmd(cmdArgs ...string) (out string, err error) {
 	if err != nil {
 		exitErr := &exec.ExitError{}
 		if errors.As(err, &exitErr) {
-			log.Println("STDERR:", string(exitErr.Stderr))
+			slog.Warn("docker command failed", "stderr", string(exitErr.Stderr))
 		}
 	}
 
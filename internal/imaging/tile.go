@@ -0,0 +1,103 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Rect is a rectangle in physical wall units, e.g. millimetres.
+type Rect struct {
+	X, Y, W, H float64
+}
+
+// Union returns the smallest rectangle containing r and o.
+func (r Rect) Union(o Rect) Rect {
+	x0, y0 := math.Min(r.X, o.X), math.Min(r.Y, o.Y)
+	x1, y1 := math.Max(r.X+r.W, o.X+o.W), math.Max(r.Y+r.H, o.Y+o.H)
+
+	return Rect{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}
+}
+
+// TileSpec is one display's share of a wall: the area of the wall it shows
+// and its resolution in pixels.
+type TileSpec struct {
+	Area          Rect
+	Width, Height int
+}
+
+// TileWall lays src over a wall and cuts out a tile for each spec. The
+// image is centered on the wall and scaled to cover it, cropping whatever
+// overhangs, or to fit within it if pad is set, leaving the margins white.
+// Parts of the wall between displays, such as bezels, hide the image behind
+// them so it stays continuous across displays.
+func TileWall(src image.Image, wall Rect, pad bool, specs []TileSpec) []*image.RGBA {
+	rgba, ok := src.(*image.RGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) {
+		b := src.Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+
+	sw, sh := float64(rgba.Bounds().Dx()), float64(rgba.Bounds().Dy())
+
+	// Source pixels per wall unit.
+	scale := math.Min(sw/wall.W, sh/wall.H)
+	if pad {
+		scale = math.Max(sw/wall.W, sh/wall.H)
+	}
+
+	offX := (sw - wall.W*scale) / 2
+	offY := (sh - wall.H*scale) / 2
+
+	tiles := make([]*image.RGBA, len(specs))
+	for i, spec := range specs {
+		area := Rect{
+			X: (spec.Area.X-wall.X)*scale + offX,
+			Y: (spec.Area.Y-wall.Y)*scale + offY,
+			W: spec.Area.W * scale,
+			H: spec.Area.H * scale,
+		}
+
+		tiles[i] = resample(rgba, area, spec.Width, spec.Height)
+	}
+
+	return tiles
+}
+
+// resample scales the area of src to a w by h image, averaging the source
+// pixels under each destination pixel. Source outside src's bounds is white.
+func resample(src *image.RGBA, area Rect, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	for dy := 0; dy < h; dy++ {
+		y0 := int(math.Floor(area.Y + float64(dy)*area.H/float64(h)))
+		y1 := max(int(math.Ceil(area.Y+float64(dy+1)*area.H/float64(h))), y0+1)
+
+		for dx := 0; dx < w; dx++ {
+			x0 := int(math.Floor(area.X + float64(dx)*area.W/float64(w)))
+			x1 := max(int(math.Ceil(area.X+float64(dx+1)*area.W/float64(w))), x0+1)
+
+			var r, g, bl, a, n uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					c := white
+					if (image.Point{x, y}).In(b) {
+						c = src.RGBAAt(x, y)
+					}
+
+					r, g, bl, a = r+uint32(c.R), g+uint32(c.G), bl+uint32(c.B), a+uint32(c.A)
+					n++
+				}
+			}
+
+			dst.SetRGBA(dx, dy, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), uint8(a / n)})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,57 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Limits bounds the images accepted for display.
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64
+	Formats   []string
+}
+
+// Validate reads only the image header to check its format and pixel
+// dimensions, so oversized images are rejected before anything decodes them.
+func Validate(data []byte, lim Limits) (image.Config, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return cfg, format, fmt.Errorf("reading image header: %s", err)
+	}
+
+	if len(lim.Formats) > 0 && !contains(lim.Formats, format) {
+		return cfg, format, fmt.Errorf("image format %s is not allowed", format)
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return cfg, format, fmt.Errorf("invalid image dimensions %dx%d", cfg.Width, cfg.Height)
+	}
+
+	if lim.MaxWidth > 0 && cfg.Width > lim.MaxWidth {
+		return cfg, format, fmt.Errorf("image width %d exceeds limit of %d", cfg.Width, lim.MaxWidth)
+	}
+
+	if lim.MaxHeight > 0 && cfg.Height > lim.MaxHeight {
+		return cfg, format, fmt.Errorf("image height %d exceeds limit of %d", cfg.Height, lim.MaxHeight)
+	}
+
+	if px := int64(cfg.Width) * int64(cfg.Height); lim.MaxPixels > 0 && px > lim.MaxPixels {
+		return cfg, format, fmt.Errorf("image of %d pixels exceeds limit of %d", px, lim.MaxPixels)
+	}
+
+	return cfg, format, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, chk := range ss {
+		if chk == s {
+			return true
+		}
+	}
+	return false
+}
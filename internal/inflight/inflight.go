@@ -51,6 +51,14 @@ func (i *Inflight) Get(id uint64) (chan *message.Response, bool) {
 	return ch, ok
 }
 
+// Len returns the number of commands awaiting a response.
+func (i *Inflight) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.m)
+}
+
 func (i *Inflight) Keys() []uint64 {
 	var ret []uint64
 
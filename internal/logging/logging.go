@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// Attribute keys shared by every component so log lines can be correlated.
+const (
+	NodeKey   = "node"
+	RoleKey   = "role"
+	RemoteKey = "remote"
+	OpKey     = "op"
+	OpaqueKey = "opaque"
+	TraceKey  = "trace"
+	ErrKey    = "err"
+)
+
+// Setup installs a leveled default logger writing to stderr, so that stdout
+// is left to command output. The standard library logger is routed through
+// it as well.
+func Setup(level, format string) error {
+	return SetupWriter(os.Stderr, level, format)
+}
+
+func SetupWriter(w io.Writer, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: lvl,
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", TextFormat:
+		h = slog.NewTextHandler(w, opts)
+	case JSONFormat:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(h))
+
+	return nil
+}
+
+// Err returns an attribute for err.
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Any(ErrKey, nil)
+	}
+
+	return slog.String(ErrKey, err.Error())
+}
+
+// WithCommand returns l annotated with the identifying fields of c.
+func WithCommand(l *slog.Logger, c *message.Command) *slog.Logger {
+	if c == nil {
+		return l
+	}
+
+	return l.With(
+		slog.String(OpKey, string(c.Op)),
+		slog.Uint64(OpaqueKey, c.Opaque),
+		slog.String(TraceKey, c.TraceID),
+	)
+}
@@ -0,0 +1,107 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Labels describe a node as key/value pairs, such as room=kitchen. A bare
+// label, as nodes and configs gave before labels had values, is a key with
+// an empty value.
+type Labels map[string]string
+
+// ParseLabels parses labels given as "key=value" or as a bare "key".
+func ParseLabels(items []string) (Labels, error) {
+	if items == nil {
+		return nil, nil
+	}
+
+	ret := make(Labels, len(items))
+	for _, item := range items {
+		k, v, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if _, ok := ret[k]; ok {
+			return nil, fmt.Errorf("label %q given more than once", k)
+		}
+
+		ret[k] = v
+	}
+
+	return ret, ret.Validate()
+}
+
+// Strings formats labels as "key=value", or "key" for empty values, sorted
+// by key. ParseLabels reads them back.
+func (l Labels) Strings() []string {
+	ret := make([]string, 0, len(l))
+	for k, v := range l {
+		if v == "" {
+			ret = append(ret, k)
+			continue
+		}
+
+		ret = append(ret, k+"="+v)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+func (l Labels) String() string {
+	return strings.Join(l.Strings(), ",")
+}
+
+// Keys returns the label keys, sorted.
+func (l Labels) Keys() []string {
+	ret := make([]string, 0, len(l))
+	for k := range l {
+		ret = append(ret, k)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// UnmarshalJSON reads labels from an object, or from a list of labels as
+// sent before labels had values.
+func (l *Labels) UnmarshalJSON(b []byte) error {
+	var items []string
+	if err := json.Unmarshal(b, &items); err == nil {
+		parsed, err := ParseLabels(items)
+		if err != nil {
+			return err
+		}
+
+		*l = parsed
+		return nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("labels must be an object or a list: %s", err)
+	}
+
+	*l = m
+	return nil
+}
+
+// LabelsDecodeHook lets config decoding read labels given as a list, as in
+// config files written before labels had values, as well as a map.
+func LabelsDecodeHook(from, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeOf(Labels{}) || from.Kind() != reflect.Slice {
+		return data, nil
+	}
+
+	rv := reflect.ValueOf(data)
+
+	items := make([]string, rv.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+
+	return ParseLabels(items)
+}
@@ -1,7 +1,10 @@
 package message
 
 import (
+	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -14,10 +17,30 @@ type Command struct {
 	Op      Op              `json:"op"`
 	Payload *CommandPayload `json:"payload,omitempty"`
 
-	// Set by transport layer.
-	Opaque     uint64     `json:"opaque"`
-	SubmitTime *time.Time `json:"submitTime,omitempty"`
-	ArriveTime *time.Time `json:"arriveTime,omitempty"`
+	// Set by transport layer. TraceID is only set if not already inherited
+	// via Derive.
+	Opaque       uint64     `json:"opaque"`
+	SubmitTime   *time.Time `json:"submitTime,omitempty"`
+	ArriveTime   *time.Time `json:"arriveTime,omitempty"`
+	TraceID      string     `json:"traceID,omitempty"`
+	SpanID       string     `json:"spanID,omitempty"`
+	ParentSpanID string     `json:"parentSpanID,omitempty"`
+}
+
+// Derive returns a new command issued on behalf of c, belonging to the same
+// trace. c may be nil, in which case the new command starts its own trace.
+func (c *Command) Derive(op Op, p *CommandPayload) *Command {
+	ret := &Command{
+		Op:      op,
+		Payload: p,
+	}
+
+	if c != nil {
+		ret.TraceID = c.TraceID
+		ret.ParentSpanID = c.SpanID
+	}
+
+	return ret
 }
 
 type Op string
@@ -28,27 +51,195 @@ const (
 	GetImageCmd   Op = "getImage"
 	IdentifyCmd   Op = "identify"
 	ListNodesCmd  Op = "listNodes"
+	NodeStatusCmd Op = "nodeStatus"
+	NodeModeCmd   Op = "nodeMode"
 	RegisterCmd   Op = "register"
 	ShowImagesCmd Op = "showImages"
 	ListFilesCmd  Op = "listFiles"
+	GetTraceCmd   Op = "getTrace"
+
+	WatchEventsCmd Op = "watchEvents"
+	EventCmd       Op = "event" // Pushed by the server to conns watching events.
+
+	PlaylistCreateCmd Op = "playlistCreate"
+	PlaylistAssignCmd Op = "playlistAssign"
+	PlaylistPauseCmd  Op = "playlistPause"
+	PlaylistNextCmd   Op = "playlistNext"
+	ListPlaylistsCmd  Op = "listPlaylists"
+
+	ScheduleSetCmd     Op = "scheduleSet"
+	ScheduleDeleteCmd  Op = "scheduleDelete"
+	ListSchedulesCmd   Op = "listSchedules"
+	SchedulePreviewCmd Op = "schedulePreview"
+
+	WallSetCmd    Op = "wallSet"
+	WallDeleteCmd Op = "wallDelete"
+	ListWallsCmd  Op = "listWalls"
+
+	SceneSetCmd    Op = "sceneSet"
+	SceneSaveCmd   Op = "sceneSave"
+	SceneApplyCmd  Op = "sceneApply"
+	SceneDeleteCmd Op = "sceneDelete"
+	ListScenesCmd  Op = "listScenes"
+
+	HistoryCmd        Op = "history"
+	HistoryBackCmd    Op = "historyBack"
+	HistoryForwardCmd Op = "historyForward"
+
+	// Two-phase display, used to reveal images on several nodes at the
+	// same moment.
+	PrepareImageCmd Op = "prepareImage"
+	CommitImageCmd  Op = "commitImage"
 )
 
+// Ops lists every known op.
+var Ops = []Op{
+	ConfigSetCmd,
+	SetImageCmd,
+	GetImageCmd,
+	IdentifyCmd,
+	ListNodesCmd,
+	NodeStatusCmd,
+	NodeModeCmd,
+	RegisterCmd,
+	ShowImagesCmd,
+	ListFilesCmd,
+	GetTraceCmd,
+	WatchEventsCmd,
+	EventCmd,
+	PlaylistCreateCmd,
+	PlaylistAssignCmd,
+	PlaylistPauseCmd,
+	PlaylistNextCmd,
+	ListPlaylistsCmd,
+	ScheduleSetCmd,
+	ScheduleDeleteCmd,
+	ListSchedulesCmd,
+	SchedulePreviewCmd,
+	WallSetCmd,
+	WallDeleteCmd,
+	ListWallsCmd,
+	SceneSetCmd,
+	SceneSaveCmd,
+	SceneApplyCmd,
+	SceneDeleteCmd,
+	ListScenesCmd,
+	HistoryCmd,
+	HistoryBackCmd,
+	HistoryForwardCmd,
+	PrepareImageCmd,
+	CommitImageCmd,
+}
+
 type CommandPayload struct {
 	ConfigSetPayload  *ConfigSetPayload  `json:"configSetPayload,omitempty"`
 	SetImagePayload   *SetImagePayload   `json:"setImagePayload,omitempty"`
 	GetImagePayload   *GetImagePayload   `json:"getImagePayload,omitempty"`
 	ListNodesPayload  *ListNodesPayload  `json:"listNodesPayload,omitempty"`
+	NodeStatusPayload *NodeStatusPayload `json:"nodeStatusPayload,omitempty"`
+	NodeModePayload   *NodeModePayload   `json:"nodeModePayload,omitempty"`
 	RegisterPayload   *RegisterPayload   `json:"registerPayload,omitempty"`
 	ShowImagesPayload *ShowImagesPayload `json:"showImagesPayload,omitempty"`
+	GetTracePayload   *GetTracePayload   `json:"getTracePayload,omitempty"`
+
+	WatchEventsPayload *WatchEventsPayload `json:"watchEventsPayload,omitempty"`
+	EventPayload       *EventPayload       `json:"eventPayload,omitempty"`
+
+	PlaylistCreatePayload *PlaylistCreatePayload `json:"playlistCreatePayload,omitempty"`
+	PlaylistAssignPayload *PlaylistAssignPayload `json:"playlistAssignPayload,omitempty"`
+	PlaylistPausePayload  *PlaylistPausePayload  `json:"playlistPausePayload,omitempty"`
+	PlaylistNextPayload   *PlaylistNextPayload   `json:"playlistNextPayload,omitempty"`
+
+	ScheduleSetPayload     *ScheduleSetPayload     `json:"scheduleSetPayload,omitempty"`
+	ScheduleDeletePayload  *ScheduleDeletePayload  `json:"scheduleDeletePayload,omitempty"`
+	SchedulePreviewPayload *SchedulePreviewPayload `json:"schedulePreviewPayload,omitempty"`
+
+	WallSetPayload    *WallSetPayload    `json:"wallSetPayload,omitempty"`
+	WallDeletePayload *WallDeletePayload `json:"wallDeletePayload,omitempty"`
+
+	SceneSetPayload    *SceneSetPayload    `json:"sceneSetPayload,omitempty"`
+	SceneSavePayload   *SceneSavePayload   `json:"sceneSavePayload,omitempty"`
+	SceneApplyPayload  *SceneApplyPayload  `json:"sceneApplyPayload,omitempty"`
+	SceneDeletePayload *SceneDeletePayload `json:"sceneDeletePayload,omitempty"`
+
+	HistoryPayload     *HistoryPayload     `json:"historyPayload,omitempty"`
+	HistoryMovePayload *HistoryMovePayload `json:"historyMovePayload,omitempty"`
+
+	PrepareImagePayload *PrepareImagePayload `json:"prepareImagePayload,omitempty"`
+	CommitImagePayload  *CommitImagePayload  `json:"commitImagePayload,omitempty"`
 }
 
 type ConfigSetPayload struct {
 	Configs map[string]NodeConfig `json:"configs,omitempty"`
 }
 
+// NodeConfig changes a node's settings. Unset fields are left alone, and an
+// empty QuietHours or RefreshBudget clears it.
 type NodeConfig struct {
-	Labels      []string `json:"labels,omitempty"`
-	Orientation *string  `json:"orientation,omitempty"`
+	Labels        Labels         `json:"labels,omitempty"`
+	Orientation   *string        `json:"orientation,omitempty"`
+	QuietHours    *QuietHours    `json:"quietHours,omitempty"`
+	RefreshBudget *RefreshBudget `json:"refreshBudget,omitempty"`
+}
+
+// QuietHours is a daily window, given as "HH:MM" times, during which the
+// server holds back refreshes of a node's display. The latest held back
+// image is shown when the window closes. A window ending at or before its
+// start runs past midnight.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"` // IANA zone, UTC if unset.
+}
+
+func (q *QuietHours) Empty() bool {
+	return q == nil || (q.Start == "" && q.End == "")
+}
+
+// String formats quiet hours as "START-END[@TIMEZONE]", the form accepted by
+// ParseQuietHours.
+func (q *QuietHours) String() string {
+	if q.Empty() {
+		return ""
+	}
+
+	s := q.Start + "-" + q.End
+	if q.Timezone != "" {
+		s += "@" + q.Timezone
+	}
+
+	return s
+}
+
+// ParseQuietHours parses quiet hours such as "22:00-07:00" or
+// "22:00-07:00@Europe/London". An empty string means none.
+func ParseQuietHours(s string) (*QuietHours, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	span, tz, _ := strings.Cut(s, "@")
+
+	start, end, ok := strings.Cut(span, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours %q, want START-END[@TIMEZONE]", s)
+	}
+
+	q := &QuietHours{Start: start, End: end, Timezone: tz}
+
+	return q, q.Validate()
+}
+
+// RefreshBudget caps how many times a node's display may be refreshed in any
+// hour or day. Zero means no limit. Refreshes over budget are held back until
+// the budget allows them.
+type RefreshBudget struct {
+	PerHour int `json:"perHour,omitempty"`
+	PerDay  int `json:"perDay,omitempty"`
+}
+
+func (b *RefreshBudget) Empty() bool {
+	return b == nil || (b.PerHour == 0 && b.PerDay == 0)
 }
 
 type SetImagePayload struct {
@@ -59,39 +250,326 @@ type SetImagePayload struct {
 	FitPolicy   FitPolicy `json:"fitPolicy,omitempty"`
 }
 
+// PrepareImagePayload asks a node to download and pre-render an image
+// without showing it, ready for a CommitImageCmd with the same Reveal.
+type PrepareImagePayload struct {
+	Reveal string          `json:"reveal"`
+	Image  SetImagePayload `json:"image"`
+}
+
+// CommitImagePayload asks a node to show the image it prepared for Reveal
+// at At, as read by the node's own clock.
+type CommitImagePayload struct {
+	Reveal string    `json:"reveal"`
+	At     time.Time `json:"at"`
+}
+
 type GetImagePayload struct {
 	Name string `json:"name"`
 }
 
 type ListNodesPayload struct {
-	RefreshIdentities bool `json:"refreshIdentities,omitempty"`
+	RefreshIdentities bool   `json:"refreshIdentities,omitempty"`
+	IncludeClients    bool   `json:"includeClients,omitempty"`
+	Selector          string `json:"selector,omitempty"` // Only list matching nodes.
+}
+
+// NodeStatusPayload asks for the status of one node, which need not be
+// connected.
+type NodeStatusPayload struct {
+	Name string `json:"name"`
+}
+
+// NodeModePayload cordons or locks a node, or lifts either. Unset fields are
+// left alone.
+type NodeModePayload struct {
+	Node     string `json:"node"`
+	Cordoned *bool  `json:"cordoned,omitempty"`
+	Locked   *bool  `json:"locked,omitempty"`
 }
 
 type RegisterPayload struct {
 	Identity Identity `json:"identity,omitempty"`
 }
 
+type GetTracePayload struct {
+	TraceID string `json:"traceID"`
+}
+
+// WatchEventsPayload subscribes the sending conn to server events. Each
+// filter matches anything when empty.
+type WatchEventsPayload struct {
+	Types []EventType `json:"types,omitempty"`
+	Nodes []string    `json:"nodes,omitempty"`
+}
+
+// Matches reports whether e passes the filters of p.
+func (p WatchEventsPayload) Matches(e Event) bool {
+	return (len(p.Types) == 0 || slices.Contains(p.Types, e.Type)) &&
+		(len(p.Nodes) == 0 || slices.Contains(p.Nodes, e.Node))
+}
+
+type EventPayload struct {
+	Event Event `json:"event"`
+}
+
+// PlaylistCreatePayload creates a playlist, replacing any of the same name.
+type PlaylistCreatePayload struct {
+	Playlist Playlist `json:"playlist"`
+}
+
+type PlaylistAssignPayload struct {
+	Name   string     `json:"name"`
+	Target NodeTarget `json:"target"`
+}
+
+// PlaylistPausePayload pauses a playlist, or resumes it if Paused is false.
+type PlaylistPausePayload struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// PlaylistNextPayload advances a playlist to its next item immediately.
+type PlaylistNextPayload struct {
+	Name string `json:"name"`
+}
+
+// Playlist is a named set of stored images cycled through on the nodes it
+// targets.
+type Playlist struct {
+	Name      string         `json:"name"`
+	Items     []PlaylistItem `json:"items"`
+	Shuffle   bool           `json:"shuffle,omitempty"`
+	Dwell     time.Duration  `json:"dwell"` // Time each item is shown, unless overridden by the item.
+	FitPolicy FitPolicy      `json:"fitPolicy,omitempty"`
+	Target    NodeTarget     `json:"target,omitempty"`
+	Paused    bool           `json:"paused,omitempty"`
+}
+
+// MinPlaylistDwell bounds how often a playlist may change images; e-ink
+// displays take several seconds to refresh.
+const MinPlaylistDwell = 10 * time.Second
+
+type PlaylistItem struct {
+	Image string        `json:"image"`
+	Dwell time.Duration `json:"dwell,omitempty"`
+}
+
+// ItemDwell returns how long item i is shown for.
+func (p Playlist) ItemDwell(i int) time.Duration {
+	if d := p.Items[i].Dwell; d > 0 {
+		return d
+	}
+
+	return p.Dwell
+}
+
+// ScheduleSetPayload creates a schedule, replacing any of the same name.
+type ScheduleSetPayload struct {
+	Schedule Schedule `json:"schedule"`
+}
+
+type ScheduleDeletePayload struct {
+	Name string `json:"name"`
+}
+
+// SchedulePreviewPayload asks what a node would be scheduled to show at a
+// given time.
+type SchedulePreviewPayload struct {
+	Node string    `json:"node"`
+	Time time.Time `json:"time"`
+}
+
+// Schedule decides what the nodes it targets show over time. Its rules are
+// tried in order and the first active one applies; a rule with neither a
+// cron expression nor a window is always active, so it makes a fallback when
+// listed last. Where several schedules target a node, the one with the
+// highest priority that has an active rule wins, with ties going to the first
+// by name. Nodes no schedule applies to fall back to their assigned playlists.
+type Schedule struct {
+	Name     string         `json:"name"`
+	Target   NodeTarget     `json:"target"`
+	Timezone string         `json:"timezone,omitempty"` // IANA zone rules are evaluated in, UTC if unset.
+	Priority int            `json:"priority,omitempty"`
+	Rules    []ScheduleRule `json:"rules"`
+}
+
+// ScheduleRule shows a playlist, a stored image or a blank screen while it is
+// active. Exactly one of Playlist, Image and Blank is set.
+type ScheduleRule struct {
+	// Cron is a five-field cron expression. The rule is active during every
+	// minute it matches, so "* 6-8 * * mon-fri" covers 6-9am on weekdays.
+	Cron   string      `json:"cron,omitempty"`
+	Window *TimeWindow `json:"window,omitempty"`
+
+	Playlist  string    `json:"playlist,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	Blank     bool      `json:"blank,omitempty"`
+	FitPolicy FitPolicy `json:"fitPolicy,omitempty"` // For Image.
+}
+
+// TimeWindow is active daily between Start and End, given as "HH:MM". A
+// window ending at or before its start runs past midnight. Days limits the
+// window to the weekdays it starts on, e.g. "mon"; it is active every day if
+// none are given.
+type TimeWindow struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// WallSetPayload creates a wall, replacing any of the same name.
+type WallSetPayload struct {
+	Wall Wall `json:"wall"`
+}
+
+type WallDeletePayload struct {
+	Name string `json:"name"`
+}
+
+// Wall is a group of nodes hung together that can show one image across
+// all of their displays.
+type Wall struct {
+	Name    string       `json:"name"`
+	Members []WallMember `json:"members"`
+}
+
+// WallMember places a node's frame on a wall. Positions and sizes are in any
+// one unit, e.g. millimetres, with X and Y measured right and down from the
+// wall's top left to the frame's. Width and Height are of the frame as hung,
+// and Bezel is the width of the border around its display; the image carries
+// on behind bezels and the gaps between frames.
+type WallMember struct {
+	Node   string  `json:"node"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Bezel  float64 `json:"bezel,omitempty"`
+}
+
+// SceneSetPayload creates a scene, replacing any of the same name.
+type SceneSetPayload struct {
+	Scene Scene `json:"scene"`
+}
+
+// SceneSavePayload creates a scene from what nodes are showing now,
+// replacing any of the same name. Target limits the nodes captured; every
+// node showing an image is captured if it is empty.
+type SceneSavePayload struct {
+	Name   string     `json:"name"`
+	Target NodeTarget `json:"target,omitempty"`
+}
+
+// SceneApplyPayload shows a scene's images on all of its nodes at once.
+// Force ignores quiet hours and refresh budgets.
+type SceneApplyPayload struct {
+	Name  string `json:"name"`
+	Force bool   `json:"force,omitempty"`
+}
+
+type SceneDeletePayload struct {
+	Name string `json:"name"`
+}
+
+// HistoryPayload asks for what a node has been shown.
+type HistoryPayload struct {
+	Node string `json:"node"`
+}
+
+// HistoryMovePayload shows a node the entry before or after the one it is
+// showing in its history, as a browser's back and forward buttons do. Force
+// ignores quiet hours and refresh budgets.
+type HistoryMovePayload struct {
+	Node  string `json:"node"`
+	Force bool   `json:"force,omitempty"`
+}
+
+// Scene is a saved look for a group of nodes, such as holiday photos across
+// the house, that is applied all at once.
+type Scene struct {
+	Name   string       `json:"name"`
+	Images []SceneImage `json:"images"`
+}
+
+// SceneImage shows a stored image on the nodes Target selects. Where several
+// of a scene's images select a node, the last one wins, so a scene can give
+// an image for a selector and override it for single nodes.
+type SceneImage struct {
+	Target     NodeTarget `json:"target"`
+	Image      string     `json:"image"`
+	FitPolicy  FitPolicy  `json:"fitPolicy,omitempty"`
+	Saturation *float64   `json:"saturation,omitempty"` // Unset for the default.
+}
+
+// NodeTarget selects nodes by name and selector. A node is targeted if it is
+// named in Nodes, or if Selectors or Selector are given and it matches them.
+type NodeTarget struct {
+	Nodes     []string       `json:"nodes,omitempty"`
+	Selectors []NodeSelector `json:"selectors,omitempty"`
+	Selector  string         `json:"selector,omitempty"` // A selector expression.
+}
+
+// Empty reports whether t targets no nodes at all.
+func (t NodeTarget) Empty() bool {
+	return len(t.Nodes) == 0 && len(t.Selectors) == 0 && t.Selector == ""
+}
+
 type ShowImagesPayload struct {
 	FitPolicy          FitPolicy      `json:"fitPolicy,omitempty"`
 	MustFitOrientation bool           `json:"mustFitOrientation"`
 	NodeSelectors      []NodeSelector `json:"nodeSelectors,omitempty"`
 	Images             []ImageData    `json:"images,omitempty"`
+
+	// Selector is a selector expression nodes must match, as well as any
+	// NodeSelectors.
+	Selector string `json:"selector,omitempty"`
+
+	// Force shows images immediately, ignoring quiet hours and refresh
+	// budgets.
+	Force bool `json:"force,omitempty"`
+
+	// Wall names a wall to spread a single image across, in place of
+	// choosing nodes by selector and orientation.
+	Wall string `json:"wall,omitempty"`
+
+	// Nodes, if given, names the node to show each of Images on, in order.
+	// Images given a node skip the selectors and the orientation allocator;
+	// those given "" are placed as usual among the nodes left over.
+	Nodes []string `json:"nodes,omitempty"`
+
+	// Assign names the strategy for choosing which node shows each image
+	// placed as usual; see assign.Strategies. Unset means best fit.
+	Assign string `json:"assign,omitempty"`
+
+	// Seed seeds the random strategy, so that the same images land on the
+	// same nodes each time. Unset picks a seed.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// DryRun plans where images would go and returns the plan, without
+	// saving images or showing anything.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// TTL, if set, shows the images as alerts: after TTL each node goes
+	// back to what it showed before, and until then schedules and playlists
+	// wait and nothing of lower priority replaces them.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Priority ranks the images against alerts. Showing over an alert, and
+	// so ending it, takes at least its priority; anything lower is refused.
+	// Schedules and playlists wait for the alert to end.
+	Priority int `json:"priority,omitempty"`
 }
 
+// NodeSelector is one step of a selector list. Each step's match is combined
+// with the result of the steps before it by its Logic; the first step's
+// Logic is ignored. Selector expressions can say more, and are preferred.
 type NodeSelector struct {
 	Logic LogicExpr   `json:"logic"`
 	Key   SelectorKey `json:"key"`
-	// Test  SelectorTest `json:"test"`
-	Value string `json:"value"`
+	Value string      `json:"value"`
 }
 
-// type SelectorTest string
-
-// const (
-// 	EqualsTest   SelectorTest = "equals"
-// 	ContainsTest SelectorTest = "contains"
-// )
-
 type SelectorKey string
 
 const (
@@ -100,7 +578,7 @@ const (
 	NameSelKey         SelectorKey = "name"
 	NameEqualsSelKey   SelectorKey = "nameEquals"
 	NameContainsSelKey SelectorKey = "nameContains"
-	HasLabelSelKey     SelectorKey = "hasLabel"
+	HasLabelSelKey     SelectorKey = "hasLabel" // Value is a label key, or "key=value".
 )
 
 type LogicExpr string
@@ -135,10 +613,25 @@ type Response struct {
 }
 
 type ResponsePayload struct {
-	GetImageResponse  *GetImageResponsePayload  `json:"getImageResponse,omitempty"`
-	IdentifyResponse  *IdentifyResponsePayload  `json:"identifyResponse,omitempty"`
-	ListNodesResponse *ListNodesResponsePayload `json:"listNodesResponse,omitempty"`
-	ListFilesResponse *ListFilesResponsePayload `json:"listFilesResponse,omitempty"`
+	GetImageResponse   *GetImageResponsePayload   `json:"getImageResponse,omitempty"`
+	IdentifyResponse   *IdentifyResponsePayload   `json:"identifyResponse,omitempty"`
+	ListNodesResponse  *ListNodesResponsePayload  `json:"listNodesResponse,omitempty"`
+	NodeStatusResponse *NodeStatusResponsePayload `json:"nodeStatusResponse,omitempty"`
+	ListFilesResponse  *ListFilesResponsePayload  `json:"listFilesResponse,omitempty"`
+	GetTraceResponse   *GetTraceResponsePayload   `json:"getTraceResponse,omitempty"`
+
+	ListPlaylistsResponse *ListPlaylistsResponsePayload `json:"listPlaylistsResponse,omitempty"`
+
+	ListSchedulesResponse   *ListSchedulesResponsePayload `json:"listSchedulesResponse,omitempty"`
+	SchedulePreviewResponse *ScheduleResolution           `json:"schedulePreviewResponse,omitempty"`
+
+	ListWallsResponse *ListWallsResponsePayload `json:"listWallsResponse,omitempty"`
+
+	ShowImagesResponse *ShowImagesResponsePayload `json:"showImagesResponse,omitempty"`
+
+	ListScenesResponse *ListScenesResponsePayload `json:"listScenesResponse,omitempty"`
+
+	HistoryResponse *HistoryResponsePayload `json:"historyResponse,omitempty"`
 }
 
 type GetImageResponsePayload struct {
@@ -152,13 +645,140 @@ type IdentifyResponsePayload struct {
 }
 
 type ListNodesResponsePayload struct {
-	Nodes map[string]NodeStatus `json:"nodes,omitempty"`
+	Nodes   map[string]NodeStatus   `json:"nodes,omitempty"`
+	Clients map[string]ClientStatus `json:"clients,omitempty"`
+}
+
+// NodeStatusResponsePayload is a node's status. For a node that isn't
+// connected, only its name and what it was last showing are known.
+type NodeStatusResponsePayload struct {
+	Connected bool       `json:"connected"`
+	Status    NodeStatus `json:"status"`
 }
 
 type ListFilesResponsePayload struct {
 	FileMap map[string][]FileInfo `json:"files,omitempty"`
 }
 
+type ListPlaylistsResponsePayload struct {
+	Playlists []PlaylistStatus `json:"playlists,omitempty"`
+}
+
+// PlaylistStatus is a playlist along with where the scheduler is in it.
+type PlaylistStatus struct {
+	Playlist Playlist   `json:"playlist"`
+	Current  string     `json:"current,omitempty"`  // Image last shown.
+	Next     string     `json:"next,omitempty"`     // Image shown next.
+	NextTime *time.Time `json:"nextTime,omitempty"` // Unset while paused.
+}
+
+type ListWallsResponsePayload struct {
+	Walls []Wall `json:"walls,omitempty"`
+}
+
+type ListScenesResponsePayload struct {
+	Scenes []Scene `json:"scenes,omitempty"`
+}
+
+// HistoryResponsePayload is a node's display history, oldest first.
+type HistoryResponsePayload struct {
+	Node    string         `json:"node"`
+	Entries []HistoryEntry `json:"entries,omitempty"`
+
+	// Current is the Seq of the entry being shown. Back and Forward are how
+	// many entries can be stepped through each way.
+	Current int `json:"current,omitempty"`
+	Back    int `json:"back"`
+	Forward int `json:"forward"`
+}
+
+// HistoryEntry is an image a node was shown. Move is set if it was shown
+// by stepping back or forward through the history.
+type HistoryEntry struct {
+	Seq int `json:"seq"`
+	ShownImage
+	Move HistoryMove `json:"move,omitempty"`
+}
+
+type HistoryMove string
+
+const (
+	HistoryBack    HistoryMove = "back"
+	HistoryForward HistoryMove = "forward"
+)
+
+type ShowImagesResponsePayload struct {
+	Results []ShowResult `json:"results,omitempty"`
+}
+
+// ShowResult is what became of one image of a show images request.
+type ShowResult struct {
+	Image  string     `json:"image"`
+	Node   string     `json:"node,omitempty"` // Unset if Unplaced.
+	Status ShowStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+
+	// Set in dry run plans: how the node would render the image, and why
+	// it would be deferred, if it would.
+	RotationDeg *int      `json:"rotationDeg,omitempty"`
+	FitPolicy   FitPolicy `json:"fitPolicy,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+type ShowStatus string
+
+const (
+	ShowShown    ShowStatus = "shown"
+	ShowDeferred ShowStatus = "deferred" // Held back by quiet hours or refresh budget.
+	ShowFailed   ShowStatus = "failed"
+	ShowUnplaced ShowStatus = "unplaced" // No eligible node was left for it.
+	ShowPlanned  ShowStatus = "planned"  // Would be shown, in a dry run.
+)
+
+type ListSchedulesResponsePayload struct {
+	Schedules []Schedule `json:"schedules,omitempty"`
+}
+
+// ScheduleResolution is what a node is scheduled to show at a point in time.
+// Schedule and Rule are unset when no schedule applies and the node falls
+// back to an assigned playlist, and everything is unset when nothing does.
+type ScheduleResolution struct {
+	Node     string        `json:"node"`
+	Time     time.Time     `json:"time"`
+	Schedule string        `json:"schedule,omitempty"`
+	Rule     *ScheduleRule `json:"rule,omitempty"`
+	Playlist string        `json:"playlist,omitempty"`
+	Image    string        `json:"image,omitempty"` // For playlists, the item showing now.
+	Blank    bool          `json:"blank,omitempty"`
+}
+
+type GetTraceResponsePayload struct {
+	Spans []Span `json:"spans,omitempty"`
+}
+
+// Span records the timing of one command/response exchange within a trace.
+type Span struct {
+	TraceID  string   `json:"traceID"`
+	SpanID   string   `json:"spanID"`
+	ParentID string   `json:"parentID,omitempty"`
+	Op       Op       `json:"op"`
+	Kind     SpanKind `json:"kind"`
+	Peer     string   `json:"peer,omitempty"`
+	Error    string   `json:"error,omitempty"`
+
+	SubmitTime  *time.Time `json:"submitTime,omitempty"`  // Command sent.
+	ArriveTime  *time.Time `json:"arriveTime,omitempty"`  // Command received.
+	RespondTime *time.Time `json:"respondTime,omitempty"` // Response sent.
+	DoneTime    *time.Time `json:"doneTime,omitempty"`    // Response received.
+}
+
+type SpanKind string
+
+const (
+	HandledSpan SpanKind = "handled" // Recorded by the receiver of the command.
+	SentSpan    SpanKind = "sent"    // Recorded by the sender of the command.
+)
+
 type FileInfo struct {
 	Name    string      `json:"name"`
 	Size    int64       `json:"size"`
@@ -170,18 +790,104 @@ type FileInfo struct {
 type Role string
 
 const (
-	NodeRole   = "node"
-	ClientRole = "client"
+	NodeRole   Role = "node"
+	ClientRole Role = "client"
+)
+
+// EventType classifies an Event.
+type EventType string
+
+const (
+	ConnectedEvent     EventType = "connected"
+	DisconnectedEvent  EventType = "disconnected"
+	RegisteredEvent    EventType = "registered"
+	ImageStoredEvent   EventType = "imageStored"
+	ImageShownEvent    EventType = "imageShown"
+	ImageDeferredEvent EventType = "imageDeferred" // Held back by quiet hours or a refresh budget.
+	ConfigChangedEvent EventType = "configChanged"
 )
 
+// EventTypes lists every known event type.
+var EventTypes = []EventType{
+	ConnectedEvent,
+	DisconnectedEvent,
+	RegisteredEvent,
+	ImageStoredEvent,
+	ImageShownEvent,
+	ImageDeferredEvent,
+	ConfigChangedEvent,
+}
+
+// Event is a change in the state of the server or one of its conns.
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Role       Role      `json:"role,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Node       string    `json:"node,omitempty"`
+	Image      string    `json:"image,omitempty"`
+	TraceID    string    `json:"traceID,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+type ClientStatus struct {
+	RemoteAddr  string    `json:"remoteAddr"`
+	ConnectTime time.Time `json:"connectTime"`
+}
+
 type NodeStatus struct {
 	UpdateTime time.Time `json:"updateTime,omitempty"`
 	Identity   Identity  `json:"identity,omitempty"`
+
+	// Showing is the image the server last displayed on the node, if any.
+	Showing *ShownImage `json:"showing,omitempty"`
+
+	// Alert is set while Showing is an alert.
+	Alert *Alert `json:"alert,omitempty"`
+
+	NodeMode
+}
+
+// NodeMode takes a node out of automatic assignment. Schedules, playlists
+// and shows that choose nodes by selector or strategy skip cordoned and
+// locked nodes. Cordoned nodes can still be shown images by name, say to
+// check a frame that was remounted; locked nodes keep what they are showing
+// until unlocked.
+type NodeMode struct {
+	Cordoned bool `json:"cordoned,omitempty"`
+	Locked   bool `json:"locked,omitempty"`
+}
+
+// Excluded reports whether the node is skipped by automatic assignment.
+func (m NodeMode) Excluded() bool {
+	return m.Cordoned || m.Locked
+}
+
+// Alert is an image shown on a node for a while, after which the node goes
+// back to Underlying: what it showed before, or what was sent to it since.
+type Alert struct {
+	Priority   int         `json:"priority"`
+	Until      time.Time   `json:"until"`
+	Underlying *ShownImage `json:"underlying,omitempty"`
+}
+
+// ShownImage is an image on a node's display and how it was rendered.
+type ShownImage struct {
+	Name        string    `json:"name"`
+	Hash        string    `json:"hash"`
+	FitPolicy   FitPolicy `json:"fitPolicy,omitempty"`
+	Saturation  float64   `json:"saturation"`
+	RotationDeg int       `json:"rotationDeg"`
+	ShownTime   time.Time `json:"shownTime"`
+
+	// ShownBy is who asked for the image: a client, an API, or the
+	// schedule or playlist that chose it.
+	ShownBy string `json:"shownBy,omitempty"`
 }
 
 type Identity struct {
 	Name           string       `json:"name"`
-	Labels         []string     `json:"labels,omitempty"`
+	Labels         Labels       `json:"labels,omitempty"`
 	Orientation    Orientation  `json:"orientation"`
 	Role           Role         `json:"role"`
 	Username       string       `json:"username"`
@@ -190,6 +896,9 @@ type Identity struct {
 	PID            int          `json:"pid"`
 	Display        *DisplayInfo `json:"display,omitempty"`
 	DisplayIDError string       `json:"displayIDError,omitempty"`
+
+	QuietHours    *QuietHours    `json:"quietHours,omitempty"`
+	RefreshBudget *RefreshBudget `json:"refreshBudget,omitempty"`
 }
 
 type Orientation string
@@ -202,6 +911,21 @@ const (
 	DefaultOrientation             = ButtonsL
 )
 
+// Rotation returns how far, in degrees, images are rotated to display
+// upright at this orientation.
+func (o Orientation) Rotation() int {
+	switch o {
+	case ButtonsD:
+		return 270
+	case ButtonsR:
+		return 180
+	case ButtonsU:
+		return 90
+	}
+
+	return 0
+}
+
 type DisplayInfo struct {
 	DisplayResponding bool          `json:"displayResponding"`
 	Colors            int           `json:"colorCount"`
@@ -0,0 +1,740 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/redgoat650/barnacle-net/internal/assign"
+	"github.com/redgoat650/barnacle-net/internal/schedule"
+	"github.com/redgoat650/barnacle-net/internal/selector"
+)
+
+// Validate checks that a command carries the payload its op requires and
+// that the payload is structurally sound. It does not check that referenced
+// nodes or files exist.
+func (c *Command) Validate() error {
+	p := c.Payload
+
+	switch c.Op {
+	case IdentifyCmd, ListFilesCmd:
+		return nil
+	case ListNodesCmd:
+		if p == nil || p.ListNodesPayload == nil {
+			return nil
+		}
+		return validateSelector(p.ListNodesPayload.Selector)
+	case NodeStatusCmd:
+		if p == nil || p.NodeStatusPayload == nil {
+			return errors.New("missing node status payload")
+		}
+		return validateName("node", p.NodeStatusPayload.Name)
+	case NodeModeCmd:
+		if p == nil || p.NodeModePayload == nil {
+			return errors.New("missing node mode payload")
+		}
+		if p.NodeModePayload.Cordoned == nil && p.NodeModePayload.Locked == nil {
+			return errors.New("no node mode given")
+		}
+		return validateName("node", p.NodeModePayload.Node)
+	case ConfigSetCmd:
+		if p == nil || p.ConfigSetPayload == nil {
+			return errors.New("missing config set payload")
+		}
+		return p.ConfigSetPayload.Validate()
+	case SetImageCmd:
+		if p == nil || p.SetImagePayload == nil {
+			return errors.New("missing set image payload")
+		}
+		return p.SetImagePayload.Validate()
+	case PrepareImageCmd:
+		if p == nil || p.PrepareImagePayload == nil {
+			return errors.New("missing prepare image payload")
+		}
+		if err := ValidateFileName(p.PrepareImagePayload.Reveal); err != nil {
+			return fmt.Errorf("invalid reveal ID: %s", err)
+		}
+		return p.PrepareImagePayload.Image.Validate()
+	case CommitImageCmd:
+		if p == nil || p.CommitImagePayload == nil {
+			return errors.New("missing commit image payload")
+		}
+		if err := ValidateFileName(p.CommitImagePayload.Reveal); err != nil {
+			return fmt.Errorf("invalid reveal ID: %s", err)
+		}
+		return nil
+	case GetImageCmd:
+		if p == nil || p.GetImagePayload == nil {
+			return errors.New("missing get image payload")
+		}
+		return ValidateFileName(p.GetImagePayload.Name)
+	case RegisterCmd:
+		if p == nil || p.RegisterPayload == nil {
+			return errors.New("missing register payload")
+		}
+		return p.RegisterPayload.Identity.Validate()
+	case ShowImagesCmd:
+		if p == nil || p.ShowImagesPayload == nil {
+			return errors.New("missing show images payload")
+		}
+		return p.ShowImagesPayload.Validate()
+	case GetTraceCmd:
+		if p == nil || p.GetTracePayload == nil || p.GetTracePayload.TraceID == "" {
+			return errors.New("missing trace ID")
+		}
+		return nil
+	case WatchEventsCmd:
+		if p == nil || p.WatchEventsPayload == nil {
+			return nil
+		}
+		return p.WatchEventsPayload.Validate()
+	case PlaylistCreateCmd:
+		if p == nil || p.PlaylistCreatePayload == nil {
+			return errors.New("missing playlist create payload")
+		}
+		return p.PlaylistCreatePayload.Playlist.Validate()
+	case PlaylistAssignCmd:
+		if p == nil || p.PlaylistAssignPayload == nil {
+			return errors.New("missing playlist assign payload")
+		}
+		if err := validateName("playlist", p.PlaylistAssignPayload.Name); err != nil {
+			return err
+		}
+		return p.PlaylistAssignPayload.Target.Validate()
+	case PlaylistPauseCmd:
+		if p == nil || p.PlaylistPausePayload == nil {
+			return errors.New("missing playlist pause payload")
+		}
+		return validateName("playlist", p.PlaylistPausePayload.Name)
+	case PlaylistNextCmd:
+		if p == nil || p.PlaylistNextPayload == nil {
+			return errors.New("missing playlist next payload")
+		}
+		return validateName("playlist", p.PlaylistNextPayload.Name)
+	case ListPlaylistsCmd, ListSchedulesCmd, ListWallsCmd, ListScenesCmd:
+		return nil
+	case WallSetCmd:
+		if p == nil || p.WallSetPayload == nil {
+			return errors.New("missing wall set payload")
+		}
+		return p.WallSetPayload.Wall.Validate()
+	case WallDeleteCmd:
+		if p == nil || p.WallDeletePayload == nil {
+			return errors.New("missing wall delete payload")
+		}
+		return validateName("wall", p.WallDeletePayload.Name)
+	case SceneSetCmd:
+		if p == nil || p.SceneSetPayload == nil {
+			return errors.New("missing scene set payload")
+		}
+		return p.SceneSetPayload.Scene.Validate()
+	case SceneSaveCmd:
+		if p == nil || p.SceneSavePayload == nil {
+			return errors.New("missing scene save payload")
+		}
+		if err := validateName("scene", p.SceneSavePayload.Name); err != nil {
+			return err
+		}
+		return p.SceneSavePayload.Target.Validate()
+	case SceneApplyCmd:
+		if p == nil || p.SceneApplyPayload == nil {
+			return errors.New("missing scene apply payload")
+		}
+		return validateName("scene", p.SceneApplyPayload.Name)
+	case SceneDeleteCmd:
+		if p == nil || p.SceneDeletePayload == nil {
+			return errors.New("missing scene delete payload")
+		}
+		return validateName("scene", p.SceneDeletePayload.Name)
+	case HistoryCmd:
+		if p == nil || p.HistoryPayload == nil {
+			return errors.New("missing history payload")
+		}
+		return validateName("node", p.HistoryPayload.Node)
+	case HistoryBackCmd, HistoryForwardCmd:
+		if p == nil || p.HistoryMovePayload == nil {
+			return errors.New("missing history move payload")
+		}
+		return validateName("node", p.HistoryMovePayload.Node)
+	case ScheduleSetCmd:
+		if p == nil || p.ScheduleSetPayload == nil {
+			return errors.New("missing schedule set payload")
+		}
+		return p.ScheduleSetPayload.Schedule.Validate()
+	case ScheduleDeleteCmd:
+		if p == nil || p.ScheduleDeletePayload == nil {
+			return errors.New("missing schedule delete payload")
+		}
+		return validateName("schedule", p.ScheduleDeletePayload.Name)
+	case SchedulePreviewCmd:
+		if p == nil || p.SchedulePreviewPayload == nil {
+			return errors.New("missing schedule preview payload")
+		}
+		if p.SchedulePreviewPayload.Node == "" {
+			return errors.New("schedule preview is missing a node")
+		}
+		return nil
+	case EventCmd:
+		if p == nil || p.EventPayload == nil {
+			return errors.New("missing event payload")
+		}
+		return p.EventPayload.Event.Type.Validate()
+	}
+
+	return fmt.Errorf("unrecognized command: %s", c.Op)
+}
+
+// Validate checks that a response carries the payload its command's op
+// returns, and that the payload is structurally sound. A failed response
+// need only say why, though it may carry a partial payload.
+func (r *Response) Validate() error {
+	if r.Command == nil {
+		return errors.New("missing command")
+	}
+
+	p := r.Payload
+
+	if !r.Success {
+		if r.Error == "" {
+			return errors.New("failed response is missing its error")
+		}
+		if p == nil {
+			return nil
+		}
+	}
+
+	switch r.Command.Op {
+	case IdentifyCmd:
+		if p == nil || p.IdentifyResponse == nil {
+			return errors.New("missing identify response payload")
+		}
+		return p.IdentifyResponse.Identity.Validate()
+	case GetImageCmd:
+		if p == nil || p.GetImageResponse == nil {
+			return errors.New("missing get image response payload")
+		}
+		if p.GetImageResponse.Hash == "" {
+			return errors.New("image is missing its hash")
+		}
+		return ValidateFileName(p.GetImageResponse.Name)
+	case ListNodesCmd:
+		if p == nil || p.ListNodesResponse == nil {
+			return errors.New("missing list nodes response payload")
+		}
+		return nil
+	case NodeStatusCmd:
+		if p == nil || p.NodeStatusResponse == nil {
+			return errors.New("missing node status response payload")
+		}
+		return validateName("node", p.NodeStatusResponse.Status.Identity.Name)
+	case ListFilesCmd:
+		if p == nil || p.ListFilesResponse == nil {
+			return errors.New("missing list files response payload")
+		}
+		return nil
+	case GetTraceCmd:
+		if p == nil || p.GetTraceResponse == nil {
+			return errors.New("missing get trace response payload")
+		}
+		return nil
+	case ShowImagesCmd, SceneApplyCmd, HistoryBackCmd, HistoryForwardCmd:
+		if p == nil || p.ShowImagesResponse == nil {
+			return errors.New("missing show images response payload")
+		}
+		for _, res := range p.ShowImagesResponse.Results {
+			if err := res.Status.Validate(); err != nil {
+				return fmt.Errorf("image %s: %s", res.Image, err)
+			}
+		}
+		return nil
+	case ListPlaylistsCmd:
+		if p == nil || p.ListPlaylistsResponse == nil {
+			return errors.New("missing list playlists response payload")
+		}
+		return nil
+	case ListSchedulesCmd:
+		if p == nil || p.ListSchedulesResponse == nil {
+			return errors.New("missing list schedules response payload")
+		}
+		return nil
+	case SchedulePreviewCmd:
+		if p == nil || p.SchedulePreviewResponse == nil {
+			return errors.New("missing schedule preview response payload")
+		}
+		return validateName("node", p.SchedulePreviewResponse.Node)
+	case ListWallsCmd:
+		if p == nil || p.ListWallsResponse == nil {
+			return errors.New("missing list walls response payload")
+		}
+		return nil
+	case ListScenesCmd:
+		if p == nil || p.ListScenesResponse == nil {
+			return errors.New("missing list scenes response payload")
+		}
+		return nil
+	case HistoryCmd:
+		if p == nil || p.HistoryResponse == nil {
+			return errors.New("missing history response payload")
+		}
+		return validateName("node", p.HistoryResponse.Node)
+	}
+
+	if p != nil {
+		return fmt.Errorf("unexpected payload in %s response", r.Command.Op)
+	}
+
+	return nil
+}
+
+func (p *ConfigSetPayload) Validate() error {
+	if len(p.Configs) == 0 {
+		return errors.New("no configs given")
+	}
+
+	for name, cfg := range p.Configs {
+		if name == "" {
+			return errors.New("config given for node without a name")
+		}
+
+		if cfg.Orientation != nil {
+			if err := Orientation(*cfg.Orientation).Validate(); err != nil {
+				return fmt.Errorf("node %s: %s", name, err)
+			}
+		}
+
+		if err := cfg.Labels.Validate(); err != nil {
+			return fmt.Errorf("node %s: %s", name, err)
+		}
+
+		if !cfg.QuietHours.Empty() {
+			if err := cfg.QuietHours.Validate(); err != nil {
+				return fmt.Errorf("node %s: %s", name, err)
+			}
+		}
+
+		if cfg.RefreshBudget != nil {
+			if err := cfg.RefreshBudget.Validate(); err != nil {
+				return fmt.Errorf("node %s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (q *QuietHours) Validate() error {
+	if _, err := schedule.ParseWindow(nil, q.Start, q.End); err != nil {
+		return fmt.Errorf("invalid quiet hours: %s", err)
+	}
+
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid quiet hours: unknown timezone %q", q.Timezone)
+	}
+
+	return nil
+}
+
+func (b *RefreshBudget) Validate() error {
+	if b.PerHour < 0 || b.PerDay < 0 {
+		return errors.New("refresh budget must not be negative")
+	}
+
+	return nil
+}
+
+func (p *SetImagePayload) Validate() error {
+	if err := ValidateFileName(p.Name); err != nil {
+		return err
+	}
+
+	if p.Saturation == nil {
+		return errors.New("saturation is required")
+	}
+
+	if *p.Saturation < 0 || *p.Saturation > 1 {
+		return fmt.Errorf("saturation %.2f out of range [0, 1]", *p.Saturation)
+	}
+
+	return p.FitPolicy.Validate()
+}
+
+func (p *ShowImagesPayload) Validate() error {
+	if len(p.Images) == 0 {
+		return errors.New("no images given")
+	}
+
+	for _, img := range p.Images {
+		// Images without data refer to one already stored on the server.
+		if err := ValidateFileName(img.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, sel := range p.NodeSelectors {
+		if err := sel.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateSelector(p.Selector); err != nil {
+		return err
+	}
+
+	if p.Wall != "" {
+		if err := validateName("wall", p.Wall); err != nil {
+			return err
+		}
+
+		if len(p.Images) != 1 {
+			return fmt.Errorf("a wall shows one image, got %d", len(p.Images))
+		}
+
+		if len(p.Nodes) > 0 {
+			return errors.New("nodes cannot be given for a wall")
+		}
+	}
+
+	if p.Assign != "" {
+		if err := assign.Strategy(p.Assign).Validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.TTL < 0 {
+		return fmt.Errorf("negative ttl %s", p.TTL)
+	}
+
+	if p.Seed != nil && assign.Strategy(p.Assign) != assign.RandomStrategy {
+		return fmt.Errorf("a seed is only used by the %s strategy", assign.RandomStrategy)
+	}
+
+	if len(p.Nodes) > 0 && len(p.Nodes) != len(p.Images) {
+		return fmt.Errorf("got %d nodes for %d images", len(p.Nodes), len(p.Images))
+	}
+
+	seen := make(map[string]bool)
+	for _, node := range p.Nodes {
+		if node == "" {
+			continue
+		}
+
+		if err := validateName("node", node); err != nil {
+			return err
+		}
+
+		if seen[node] {
+			return fmt.Errorf("node %s given more than one image", node)
+		}
+		seen[node] = true
+	}
+
+	return p.FitPolicy.Validate()
+}
+
+func (p *WatchEventsPayload) Validate() error {
+	for _, t := range p.Types {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t EventType) Validate() error {
+	if slices.Contains(EventTypes, t) {
+		return nil
+	}
+
+	return fmt.Errorf("unrecognized event type %q", t)
+}
+
+func (p Playlist) Validate() error {
+	if err := validateName("playlist", p.Name); err != nil {
+		return err
+	}
+
+	if len(p.Items) == 0 {
+		return fmt.Errorf("playlist %s has no items", p.Name)
+	}
+
+	if p.Dwell < 0 {
+		return fmt.Errorf("playlist %s has a negative dwell time", p.Name)
+	}
+
+	for i, item := range p.Items {
+		if err := ValidateFileName(item.Image); err != nil {
+			return fmt.Errorf("playlist %s item %d: %s", p.Name, i, err)
+		}
+
+		if d := p.ItemDwell(i); d < MinPlaylistDwell {
+			return fmt.Errorf("playlist %s item %d: dwell time %s is shorter than %s", p.Name, i, d, MinPlaylistDwell)
+		}
+	}
+
+	if err := p.FitPolicy.Validate(); err != nil {
+		return err
+	}
+
+	return p.Target.Validate()
+}
+
+// validateName rejects names that can't be given on the command line as a
+// single argument.
+func validateName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name is empty", kind)
+	}
+
+	if strings.ContainsFunc(name, unicode.IsSpace) {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+
+	return nil
+}
+
+func (s Schedule) Validate() error {
+	if err := validateName("schedule", s.Name); err != nil {
+		return err
+	}
+
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("schedule %s: unknown timezone %q", s.Name, s.Timezone)
+	}
+
+	if len(s.Rules) == 0 {
+		return fmt.Errorf("schedule %s has no rules", s.Name)
+	}
+
+	for i, r := range s.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("schedule %s rule %d: %s", s.Name, i, err)
+		}
+	}
+
+	return s.Target.Validate()
+}
+
+func (w Wall) Validate() error {
+	if err := validateName("wall", w.Name); err != nil {
+		return err
+	}
+
+	if len(w.Members) == 0 {
+		return fmt.Errorf("wall %s has no members", w.Name)
+	}
+
+	seen := make(map[string]bool)
+	for i, m := range w.Members {
+		switch {
+		case m.Node == "":
+			return fmt.Errorf("wall %s member %d has no node", w.Name, i)
+		case seen[m.Node]:
+			return fmt.Errorf("wall %s has node %s more than once", w.Name, m.Node)
+		case m.Width <= 0 || m.Height <= 0:
+			return fmt.Errorf("wall %s member %s must have a positive size", w.Name, m.Node)
+		case m.Bezel < 0 || 2*m.Bezel >= min(m.Width, m.Height):
+			return fmt.Errorf("wall %s member %s has a bezel that leaves no display", w.Name, m.Node)
+		}
+
+		seen[m.Node] = true
+	}
+
+	return nil
+}
+
+func (s Scene) Validate() error {
+	if err := validateName("scene", s.Name); err != nil {
+		return err
+	}
+
+	if len(s.Images) == 0 {
+		return fmt.Errorf("scene %s has no images", s.Name)
+	}
+
+	for i, img := range s.Images {
+		if err := img.Validate(); err != nil {
+			return fmt.Errorf("scene %s image %d: %s", s.Name, i, err)
+		}
+	}
+
+	return nil
+}
+
+func (i SceneImage) Validate() error {
+	if i.Target.Empty() {
+		return errors.New("no target nodes")
+	}
+
+	if err := i.Target.Validate(); err != nil {
+		return err
+	}
+
+	if err := ValidateFileName(i.Image); err != nil {
+		return err
+	}
+
+	if i.Saturation != nil && (*i.Saturation < 0 || *i.Saturation > 1) {
+		return fmt.Errorf("saturation %.2f out of range [0, 1]", *i.Saturation)
+	}
+
+	return i.FitPolicy.Validate()
+}
+
+func (r ScheduleRule) Validate() error {
+	if r.Cron != "" {
+		if _, err := schedule.ParseCron(r.Cron); err != nil {
+			return err
+		}
+	}
+
+	if w := r.Window; w != nil {
+		if _, err := schedule.ParseWindow(w.Days, w.Start, w.End); err != nil {
+			return err
+		}
+	}
+
+	set := 0
+	for _, b := range []bool{r.Playlist != "", r.Image != "", r.Blank} {
+		if b {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return errors.New("exactly one of playlist, image and blank must be set")
+	}
+
+	if r.Image != "" {
+		if err := ValidateFileName(r.Image); err != nil {
+			return err
+		}
+	}
+
+	return r.FitPolicy.Validate()
+}
+
+func (t NodeTarget) Validate() error {
+	for _, n := range t.Nodes {
+		if n == "" {
+			return errors.New("empty node name in target")
+		}
+	}
+
+	for _, sel := range t.Selectors {
+		if err := sel.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return validateSelector(t.Selector)
+}
+
+// validateSelector checks that a selector expression, if given, parses.
+func validateSelector(expr string) error {
+	if expr == "" {
+		return nil
+	}
+
+	_, err := selector.Parse(expr)
+	return err
+}
+
+func (s NodeSelector) Validate() error {
+	switch s.Logic {
+	case "", LogicAnd, LogicOr:
+	default:
+		return fmt.Errorf("unrecognized selector logic %q", s.Logic)
+	}
+
+	switch s.Key {
+	case MatchAnySelKey, MatchNoneSelKey, NameSelKey, NameEqualsSelKey, NameContainsSelKey, HasLabelSelKey:
+	default:
+		return fmt.Errorf("unrecognized selector key %q", s.Key)
+	}
+
+	return nil
+}
+
+func (s ShowStatus) Validate() error {
+	switch s {
+	case ShowShown, ShowDeferred, ShowFailed, ShowUnplaced, ShowPlanned:
+		return nil
+	}
+
+	return fmt.Errorf("unrecognized show status %q", s)
+}
+
+func (f FitPolicy) Validate() error {
+	switch f {
+	case "", MustMatchOrientation, CropToFit, PadToFit:
+		return nil
+	}
+
+	return fmt.Errorf("unrecognized fit policy %q", f)
+}
+
+func (id Identity) Validate() error {
+	switch id.Role {
+	case NodeRole, ClientRole:
+	default:
+		return fmt.Errorf("unrecognized role %q", id.Role)
+	}
+
+	if id.Orientation != "" {
+		if err := id.Orientation.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return id.Labels.Validate()
+}
+
+// Validate checks that label keys and values can be written in selector
+// expressions: keys are non-empty, and both use only letters, digits and
+// "-_./".
+func (l Labels) Validate() error {
+	for k, v := range l {
+		if k == "" {
+			return errors.New("label key is empty")
+		}
+
+		for _, r := range k + v {
+			if !isLabelRune(r) {
+				return fmt.Errorf("invalid character %q in label %s=%s", r, k, v)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isLabelRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./", r)
+}
+
+func (o Orientation) Validate() error {
+	switch o {
+	case ButtonsL, ButtonsU, ButtonsR, ButtonsD:
+		return nil
+	}
+
+	return fmt.Errorf("unrecognized orientation %q", o)
+}
+
+// ValidateFileName rejects names that are empty or would escape the image
+// directory they are joined to.
+func ValidateFileName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("file name is empty")
+	case name != filepath.Base(name), strings.ContainsAny(name, `/\`), name == ".", name == "..":
+		return fmt.Errorf("invalid file name %q", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,383 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are histogram buckets, in seconds, suited to command latencies
+// ranging from local round trips to full e-ink refreshes.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Registry holds metrics and renders them in the Prometheus text exposition
+// format.
+type Registry struct {
+	mu      *sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		mu: new(sync.Mutex),
+	}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// Write renders every registered metric to w.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler serves the registry for scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// series holds one value per label combination, keyed by the joined label
+// values.
+type series[T any] struct {
+	mu     *sync.Mutex
+	values map[string]T
+	labels map[string][]string
+	new    func() T
+}
+
+func newSeries[T any](newFn func() T) *series[T] {
+	return &series[T]{
+		mu:     new(sync.Mutex),
+		values: make(map[string]T),
+		labels: make(map[string][]string),
+		new:    newFn,
+	}
+}
+
+func (s *series[T]) get(labelValues []string) T {
+	key := strings.Join(labelValues, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	if !ok {
+		v = s.new()
+		s.values[key] = v
+		s.labels[key] = append([]string(nil), labelValues...)
+	}
+
+	return v
+}
+
+// each calls fn for every series in a stable order.
+func (s *series[T]) each(fn func(labelValues []string, v T)) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s.mu.Lock()
+		v, lv := s.values[k], s.labels[k]
+		s.mu.Unlock()
+
+		fn(lv, v)
+	}
+}
+
+type value struct {
+	mu *sync.Mutex
+	v  float64
+}
+
+func newValue() *value {
+	return &value{mu: new(sync.Mutex)}
+}
+
+func (v *value) add(f float64) {
+	v.mu.Lock()
+	v.v += f
+	v.mu.Unlock()
+}
+
+func (v *value) set(f float64) {
+	v.mu.Lock()
+	v.v = f
+	v.mu.Unlock()
+}
+
+func (v *value) load() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v *value
+}
+
+func (c Counter) Inc() {
+	c.v.add(1)
+}
+
+func (c Counter) Add(f float64) {
+	if f < 0 {
+		return
+	}
+	c.v.add(f)
+}
+
+type CounterVec struct {
+	desc
+	s *series[*value]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc: desc{name: name, help: help, typ: "counter", labels: labels},
+		s:    newSeries(newValue),
+	}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) With(labelValues ...string) Counter {
+	return Counter{v: c.s.get(labelValues)}
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w)
+	c.s.each(func(lv []string, v *value) {
+		writeSample(w, c.name, c.labels, lv, nil, v.load())
+	})
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	v *value
+}
+
+func (g Gauge) Set(f float64) {
+	g.v.set(f)
+}
+
+func (g Gauge) Add(f float64) {
+	g.v.add(f)
+}
+
+type GaugeVec struct {
+	desc
+	s *series[*value]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc: desc{name: name, help: help, typ: "gauge", labels: labels},
+		s:    newSeries(newValue),
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) With(labelValues ...string) Gauge {
+	return Gauge{v: g.s.get(labelValues)}
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w)
+	g.s.each(func(lv []string, v *value) {
+		writeSample(w, g.name, g.labels, lv, nil, v.load())
+	})
+}
+
+// Sample is one labelled value reported by a GaugeFunc.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type gaugeFunc struct {
+	desc
+	fn func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are computed by fn at scrape
+// time.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(&gaugeFunc{
+		desc: desc{name: name, help: help, typ: "gauge", labels: labels},
+		fn:   fn,
+	})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	g.writeHeader(w)
+	for _, sm := range g.fn() {
+		writeSample(w, g.name, g.labels, sm.LabelValues, nil, sm.Value)
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	h *histogram
+}
+
+func (h Histogram) Observe(f float64) {
+	h.h.observe(f)
+}
+
+type histogram struct {
+	mu      *sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(f float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if f <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += f
+	h.count++
+}
+
+type HistogramVec struct {
+	desc
+	buckets []float64
+	s       *series[*histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+	}
+	h.s = newSeries(func() *histogram {
+		return &histogram{
+			mu:      new(sync.Mutex),
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+	})
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(labelValues ...string) Histogram {
+	return Histogram{h: h.s.get(labelValues)}
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+	h.s.each(func(lv []string, hist *histogram) {
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		sum, count := hist.sum, hist.count
+		hist.mu.Unlock()
+
+		for i, b := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, lv, []string{"le", formatFloat(b)}, float64(counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, lv, []string{"le", "+Inf"}, float64(count))
+		writeSample(w, h.name+"_sum", h.labels, lv, nil, sum)
+		writeSample(w, h.name+"_count", h.labels, lv, nil, float64(count))
+	})
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues, extra []string, v float64) {
+	var pairs []string
+	for i, l := range labels {
+		lv := ""
+		if i < len(labelValues) {
+			lv = labelValues[i]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escapeLabel(lv)))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+		return
+	}
+
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(v))
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value as the text format requires: only
+// backslashes, double quotes and newlines, leaving anything else as is.
+func escapeLabel(s string) string {
+	s = strings.ToValidUTF8(s, "?")
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func escapeHelp(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
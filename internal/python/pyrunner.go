@@ -3,12 +3,13 @@ package python
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"sync"
 
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/redgoat650/barnacle-net/internal/message"
 )
 
@@ -31,6 +32,21 @@ func NewImagePYRunner(scriptDir string) *PyRunner {
 }
 
 func (p *PyRunner) RunImagePY(filename string, rotationDeg int, saturation *float64, fitPolicy message.FitPolicy) error {
+	return p.runImagePY(filename, "", rotationDeg, saturation, fitPolicy)
+}
+
+// PrepareImagePY rotates and fits an image to the display as RunImagePY
+// would, but saves the result to outFile instead of showing it. Showing
+// outFile later with no rotation only has to refresh the panel.
+func (p *PyRunner) PrepareImagePY(filename, outFile string, rotationDeg int, saturation *float64, fitPolicy message.FitPolicy) error {
+	if outFile == "" {
+		return errors.New("invalid output file name")
+	}
+
+	return p.runImagePY(filename, outFile, rotationDeg, saturation, fitPolicy)
+}
+
+func (p *PyRunner) runImagePY(filename, outFile string, rotationDeg int, saturation *float64, fitPolicy message.FitPolicy) error {
 	if filename == "" {
 		return errors.New("invalid file name")
 	}
@@ -50,19 +66,21 @@ func (p *PyRunner) RunImagePY(filename string, rotationDeg int, saturation *floa
 
 	cmd.Args = append(cmd.Args, string(fitPolicy))
 
-	log.Printf("Executing %q", cmd.String())
+	if outFile != "" {
+		cmd.Args = append(cmd.Args, outFile)
+	}
+
+	slog.Debug("executing script", "cmd", cmd.String())
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	b, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Println("image.py execution ended with error", err)
-		log.Println("OUTPUT:", string(b))
+		slog.Error("image.py execution ended with error", logging.Err(err), "output", string(b))
 		return err
 	}
 
-	log.Println("image.py execution complete")
-	log.Print(string(b))
+	slog.Debug("image.py execution complete", "output", string(b))
 
 	return nil
 }
@@ -72,18 +90,17 @@ func (p *PyRunner) RunIdentifyPY() ([]byte, error) {
 
 	cmd := exec.Command(pythonBin, idPyPath)
 
-	log.Printf("Executing %q", cmd.String())
+	slog.Debug("executing script", "cmd", cmd.String())
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	b, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Println("identify.py execution ended with error", err)
+		slog.Warn("identify.py execution ended with error", logging.Err(err), "output", string(b))
 		return b, err
 	}
 
-	log.Println("identify.py execution complete")
-	log.Print(string(b))
+	slog.Debug("identify.py execution complete", "output", string(b))
 
 	return b, nil
 }
@@ -0,0 +1,98 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const clockLayout = "15:04"
+
+// Window is a daily span of wall clock time, optionally limited to certain
+// days of the week. A window that ends at or before its start runs past
+// midnight into the next day.
+type Window struct {
+	days       [7]bool
+	start, end time.Duration // Offsets from midnight.
+}
+
+// ParseWindow parses a window from "HH:MM" start and end times and a list of
+// weekday names. No days means every day.
+func ParseWindow(days []string, start, end string) (*Window, error) {
+	w := new(Window)
+
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+
+	if w.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+
+	if len(days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+
+	for _, d := range days {
+		wd, err := ParseWeekday(d)
+		if err != nil {
+			return nil, err
+		}
+
+		w.days[wd] = true
+	}
+
+	return w, nil
+}
+
+// Contains reports whether t falls inside the window, evaluated in t's
+// location.
+func (w *Window) Contains(t time.Time) bool {
+	h, m, s := t.Clock()
+	tod := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+
+	wd := t.Weekday()
+	if w.start < w.end {
+		return w.days[wd] && tod >= w.start && tod < w.end
+	}
+
+	// The window wraps past midnight, so the early hours belong to the
+	// previous day's window.
+	yesterday := (wd + 6) % 7
+	return (w.days[wd] && tod >= w.start) || (w.days[yesterday] && tod < w.end)
+}
+
+// Closes returns when the window containing t closes.
+func (w *Window) Closes(t time.Time) time.Time {
+	h, m := int(w.end/time.Hour), int(w.end%time.Hour/time.Minute)
+
+	y, mon, d := t.Date()
+	end := time.Date(y, mon, d, h, m, 0, 0, t.Location())
+	if !end.After(t) {
+		end = time.Date(y, mon, d+1, h, m, 0, 0, t.Location())
+	}
+
+	return end
+}
+
+// ParseWeekday parses a weekday name such as "mon" or "Monday".
+func ParseWeekday(s string) (time.Weekday, error) {
+	l := strings.ToLower(s)
+	for i := range weekdayNames {
+		if len(l) >= 3 && strings.HasPrefix(strings.ToLower(time.Weekday(i).String()), l) {
+			return time.Weekday(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid weekday %q", s)
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
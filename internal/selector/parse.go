@@ -0,0 +1,366 @@
+package selector
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError reports where and why an expression failed to parse.
+type ParseError struct {
+	Expr   string
+	Column int // 1-based, in runes.
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid selector %q at column %d: %s", e.Expr, e.Column, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string // Unquoted, for strings.
+	pos  int    // Byte offset into the expression.
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`()!&|=~:",`, r)
+}
+
+// Parse compiles a selector expression.
+func Parse(expr string) (Expr, error) {
+	p := &parser{expr: expr}
+
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), "empty selector")
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, p.errorf(t, "unmatched \")\"")
+		}
+		return nil, p.errorf(t, "expected \"&&\" or \"||\" before %s", t.describe())
+	}
+
+	return e, nil
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	next   int
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &ParseError{
+		Expr:   p.expr,
+		Column: p.column(t),
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) column(t token) int {
+	return utf8.RuneCountInString(p.expr[:t.pos]) + 1
+}
+
+func (p *parser) lex() error {
+	s := p.expr
+	i := 0
+
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '(':
+			p.tokens = append(p.tokens, token{tokLParen, "(", i})
+		case r == ')':
+			p.tokens = append(p.tokens, token{tokRParen, ")", i})
+		case r == ',':
+			p.tokens = append(p.tokens, token{tokComma, ",", i})
+		case r == '=' || r == '~' || r == ':':
+			p.tokens = append(p.tokens, token{tokOp, string(r), i})
+		case r == '!':
+			if next := s[i+1:]; strings.HasPrefix(next, "=") || strings.HasPrefix(next, "~") {
+				p.tokens = append(p.tokens, token{tokOp, s[i : i+2], i})
+				size = 2
+				break
+			}
+			p.tokens = append(p.tokens, token{tokNot, "!", i})
+		case strings.HasPrefix(s[i:], "&&"):
+			p.tokens = append(p.tokens, token{tokAnd, "&&", i})
+			size = 2
+		case strings.HasPrefix(s[i:], "||"):
+			p.tokens = append(p.tokens, token{tokOr, "||", i})
+			size = 2
+		case r == '&' || r == '|':
+			return p.errorf(token{pos: i}, "use %q instead of %q", strings.Repeat(string(r), 2), r)
+		case r == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return p.errorf(token{pos: i}, "unterminated quoted value")
+			}
+
+			v, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return p.errorf(token{pos: i}, "invalid quoted value: %s", err)
+			}
+
+			p.tokens = append(p.tokens, token{tokString, v, i})
+			size = end + 1 - i
+		default:
+			end := i
+			for end < len(s) {
+				r, n := utf8.DecodeRuneInString(s[end:])
+				if !isWordRune(r) {
+					break
+				}
+				end += n
+			}
+
+			p.tokens = append(p.tokens, token{tokWord, s[i:end], i})
+			size = end - i
+		}
+
+		i += size
+	}
+
+	p.tokens = append(p.tokens, token{tokEOF, "", len(s)})
+
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	var ret Or
+	for {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, e)
+
+		if p.peek().kind != tokOr {
+			break
+		}
+		p.take()
+	}
+
+	if len(ret) == 1 {
+		return ret[0], nil
+	}
+
+	return ret, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	var ret And
+	for {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, e)
+
+		if p.peek().kind != tokAnd {
+			break
+		}
+		p.take()
+	}
+
+	if len(ret) == 1 {
+		return ret[0], nil
+	}
+
+	return ret, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek().kind == tokNot {
+		p.take()
+
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return Not{X: e}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.take()
+
+	switch t.kind {
+	case tokLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if c := p.take(); c.kind != tokRParen {
+			return nil, p.errorf(c, "expected \")\" to close \"(\" at column %d, found %s", p.column(t), c.describe())
+		}
+
+		return e, nil
+	case tokWord:
+		return p.parseTerm(t)
+	}
+
+	return nil, p.errorf(t, "expected a term such as label:kitchen, found %s", t.describe())
+}
+
+func (p *parser) parseTerm(field token) (Expr, error) {
+	op := p.peek()
+
+	// The word after a field, if it's a word operator.
+	var opWord string
+	switch {
+	case op.kind == tokWord:
+		opWord = op.text
+	case op.kind == tokNot && p.tokens[p.next+1].kind == tokWord:
+		opWord = "!" + p.tokens[p.next+1].text
+	}
+
+	isOp := op.kind == tokOp || slices.Contains([]string{"in", "notin", "exists", "!exists"}, opWord)
+
+	switch {
+	case !isOp && field.text == "any":
+		return Const(true), nil
+	case !isOp && field.text == "none":
+		return Const(false), nil
+	case !validField(field.text) && !isOp:
+		return nil, p.errorf(field, "expected a term such as label:%s, found %s", quote(field.text), field.describe())
+	case !validField(field.text):
+		return nil, p.errorf(field, "unknown field %q, want one of %s", field.text, strings.Join(fields, ", "))
+	case !isOp:
+		return nil, p.errorf(op, "expected an operator after %q, found %s", field.text, op.describe())
+	}
+
+	switch opWord {
+	case "exists", "!exists":
+		if op.kind == tokNot {
+			p.take()
+		}
+		p.take()
+
+		return Exists{Field: field.text, Not: opWord == "!exists"}, nil
+	case "in", "notin":
+		p.take()
+
+		vs, err := p.parseList(op)
+		if err != nil {
+			return nil, err
+		}
+
+		return In{Field: field.text, Values: vs, Not: opWord == "notin"}, nil
+	}
+
+	p.take()
+
+	v := p.take()
+	if v.kind != tokWord && v.kind != tokString {
+		return nil, p.errorf(v, "expected a value after %q, found %s", op.text, v.describe())
+	}
+
+	c := Compare{
+		Field: field.text,
+		Op:    Op(op.text),
+		Value: v.text,
+	}
+
+	if c.Op == ":" {
+		c.Op = Equals
+	}
+
+	return c, nil
+}
+
+// parseList parses the parenthesized, comma separated values following an
+// "in" or "notin" operator.
+func (p *parser) parseList(op token) ([]string, error) {
+	if t := p.take(); t.kind != tokLParen {
+		return nil, p.errorf(t, "expected \"(\" to start the values after %q, found %s", op.text, t.describe())
+	}
+
+	var ret []string
+	for {
+		v := p.take()
+		if v.kind != tokWord && v.kind != tokString {
+			return nil, p.errorf(v, "expected a value in the list after %q, found %s", op.text, v.describe())
+		}
+
+		ret = append(ret, v.text)
+
+		switch t := p.take(); t.kind {
+		case tokComma:
+			continue
+		case tokRParen:
+			return ret, nil
+		default:
+			return nil, p.errorf(t, "expected \",\" or \")\" in the list after %q, found %s", op.text, t.describe())
+		}
+	}
+}
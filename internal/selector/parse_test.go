@@ -0,0 +1,271 @@
+package selector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// node is a Node with the given values for each field.
+type node map[string][]string
+
+func (n node) Values(field string) []string {
+	return n[field]
+}
+
+func eq(field, value string) Compare {
+	return Compare{Field: field, Op: Equals, Value: value}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Expr
+		str  string // What want formats as.
+	}{
+		{
+			expr: "name:a",
+			want: eq("name", "a"),
+			str:  "name=a",
+		},
+		{
+			expr: "name!=a && name~b && name!~c",
+			want: And{
+				Compare{Field: "name", Op: NotEquals, Value: "a"},
+				Compare{Field: "name", Op: Contains, Value: "b"},
+				Compare{Field: "name", Op: NotContains, Value: "c"},
+			},
+			str: "name!=a && name~b && name!~c",
+		},
+		{
+			expr: "name:a || name:b && name:c",
+			want: Or{eq("name", "a"), And{eq("name", "b"), eq("name", "c")}},
+			str:  "name=a || name=b && name=c",
+		},
+		{
+			expr: "name:a && name:b || name:c",
+			want: Or{And{eq("name", "a"), eq("name", "b")}, eq("name", "c")},
+			str:  "name=a && name=b || name=c",
+		},
+		{
+			expr: "!name:a && name:b",
+			want: And{Not{X: eq("name", "a")}, eq("name", "b")},
+			str:  "!name=a && name=b",
+		},
+		{
+			expr: "!name:a || name:b",
+			want: Or{Not{X: eq("name", "a")}, eq("name", "b")},
+			str:  "!name=a || name=b",
+		},
+		{
+			expr: "!!name:a",
+			want: Not{X: Not{X: eq("name", "a")}},
+			str:  "!!name=a",
+		},
+		{
+			expr: "(name:a || name:b) && name:c",
+			want: And{Or{eq("name", "a"), eq("name", "b")}, eq("name", "c")},
+			str:  "(name=a || name=b) && name=c",
+		},
+		{
+			expr: "!(name:a && name:b)",
+			want: Not{X: And{eq("name", "a"), eq("name", "b")}},
+			str:  "!(name=a && name=b)",
+		},
+		{
+			expr: "((name:a))",
+			want: eq("name", "a"),
+			str:  "name=a",
+		},
+		{
+			expr: `label:"living room"`,
+			want: eq("label", "living room"),
+			str:  `label="living room"`,
+		},
+		{
+			expr: `name:"a \"b\" \\ c"`,
+			want: eq("name", `a "b" \ c`),
+			str:  `name="a \"b\" \\ c"`,
+		},
+		{
+			expr: `name:"a&&b"`,
+			want: eq("name", "a&&b"),
+			str:  `name="a&&b"`,
+		},
+		{
+			expr: `name:""`,
+			want: eq("name", ""),
+			str:  `name=""`,
+		},
+		{
+			expr: "any || none",
+			want: Or{Const(true), Const(false)},
+			str:  "any || none",
+		},
+		{
+			expr: `label.room in (kitchen, "living room")`,
+			want: In{Field: "label.room", Values: []string{"kitchen", "living room"}},
+			str:  `label.room in (kitchen, "living room")`,
+		},
+		{
+			expr: "label.room notin(hall)",
+			want: In{Field: "label.room", Values: []string{"hall"}, Not: true},
+			str:  "label.room notin (hall)",
+		},
+		{
+			expr: "label.test exists",
+			want: Exists{Field: "label.test"},
+			str:  "label.test exists",
+		},
+		{
+			expr: "label.test !exists && name:a",
+			want: And{Exists{Field: "label.test", Not: true}, eq("name", "a")},
+			str:  "label.test !exists && name=a",
+		},
+		{
+			// A "!" before a term negates it, but a "!" after a field is
+			// part of "!exists".
+			expr: "!label.test exists",
+			want: Not{X: Exists{Field: "label.test"}},
+			str:  "!label.test exists",
+		},
+		{
+			expr: "!label.test !exists",
+			want: Not{X: Exists{Field: "label.test", Not: true}},
+			str:  "!label.test !exists",
+		},
+		{
+			expr: "label in (a) || label notin (b) && label exists",
+			want: Or{
+				In{Field: "label", Values: []string{"a"}},
+				And{In{Field: "label", Values: []string{"b"}, Not: true}, Exists{Field: "label"}},
+			},
+			str: "label in (a) || label notin (b) && label exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("parsing: %s", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+
+			if s := got.String(); s != tt.str {
+				t.Errorf("got string %s, want %s", s, tt.str)
+			}
+
+			again, err := Parse(got.String())
+			if err != nil {
+				t.Fatalf("parsing %s back: %s", got, err)
+			}
+
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("%s parsed back to %#v, want %#v", got, again, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		column int
+		msg    string // Contained in the error message.
+	}{
+		{`label:"kitchen`, 7, "unterminated quoted value"},
+		{"name:a & name:b", 8, `use "&&"`},
+		{"name:a | name:b", 8, `use "||"`},
+		{"name:a)", 7, `unmatched ")"`},
+		{"(name:a", 8, `expected ")" to close "(" at column 1`},
+		{"name:a && room:kitchen", 11, `unknown field "room"`},
+		{"kitchen", 1, "expected a term such as label:kitchen"},
+		{"name:a name:b", 8, `expected "&&" or "||"`},
+		{"name:", 6, "expected a value"},
+		{"name:a &&", 10, "found end of input"},
+		{"", 1, "empty selector"},
+		{"label.room in ()", 16, `expected a value in the list after "in", found ")"`},
+		{"label.room in (a,)", 18, `expected a value in the list after "in", found ")"`},
+		{"label.room notin (a b)", 21, `expected "," or ")"`},
+		{"label.room in a", 15, `expected "(" to start the values`},
+		{"room exists", 1, `unknown field "room"`},
+		{"label. exists", 1, `unknown field "label."`},
+		{"label.test !", 12, `expected an operator after "label.test", found "!"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("got error %v, want a parse error", err)
+			}
+
+			if pe.Column != tt.column || !strings.Contains(pe.Msg, tt.msg) {
+				t.Errorf("got %q at column %d, want %q at column %d", pe.Msg, pe.Column, tt.msg, tt.column)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	n := node{
+		NameField:        {"n1"},
+		LabelField:       {"kitchen", "test"},
+		OrientationField: {"portrait"},
+		"label.room":     {"kitchen"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"name:n1", true},
+		{"name:n", false},
+		{"name~n", true},
+		{"name!~n", false},
+		{"label:test", true},
+		{"label!=hall", true},
+		{"name:x || name:n1 && label:hall", false},
+		{"(name:x || name:n1) && label:kitchen", true},
+		{"!label:test || name:n1", true},
+		{"!(label:test || name:x)", false},
+		{"label.room:kitchen && orientation:portrait", true},
+		{"any", true},
+		{"none || !any", false},
+		{"label.room in (hall, kitchen)", true},
+		{"label.room notin (hall, kitchen)", false},
+		{"label.room exists", true},
+		{"label.room !exists", false},
+		{"!label.room !exists", true},
+
+		// label.floor isn't set on the node.
+		{"label.floor:2", false},
+		{"label.floor!=2", true},
+		{"label.floor~2", false},
+		{"label.floor!~2", true},
+		{"label.floor in (2)", false},
+		{"label.floor notin (2)", true},
+		{"label.floor exists", false},
+		{"label.floor !exists", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("parsing: %s", err)
+			}
+
+			if got := e.Match(n); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
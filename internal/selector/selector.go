@@ -0,0 +1,239 @@
+// Package selector parses and evaluates the expressions used to pick which
+// nodes a command applies to, such as
+//
+//	label:kitchen && !name~test || orientation=portrait
+//	label.room in (kitchen, hall) && label.floor!=2 && label.test !exists
+//
+// A term tests a field of the node: name, orientation, label (the node's
+// label keys) or label.KEY (the value of the label with that key). "=" (or
+// ":") matches if any of the field's values equals the value given, "~" if
+// any contains it, "in (a, b)" if any equals one of a list, and "exists" if
+// the field has a value at all. "!=", "!~", "notin" and "!exists" negate
+// those. Terms combine with "!", "&&" and "||", binding in that order, and
+// may be grouped with parentheses. The bare words "any" and "none" match
+// every node and no node. Values containing spaces or operator characters
+// may be double quoted.
+package selector
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Fields a term may test.
+const (
+	NameField        = "name"
+	LabelField       = "label"
+	OrientationField = "orientation" // portrait or landscape, or as configured.
+
+	// LabelKeyPrefix starts fields naming a single label by key.
+	LabelKeyPrefix = LabelField + "."
+)
+
+var fields = []string{NameField, LabelField, OrientationField, LabelKeyPrefix + "KEY"}
+
+func validField(f string) bool {
+	return f == NameField || f == LabelField || f == OrientationField ||
+		(strings.HasPrefix(f, LabelKeyPrefix) && len(f) > len(LabelKeyPrefix))
+}
+
+type Op string
+
+const (
+	Equals      Op = "="
+	NotEquals   Op = "!="
+	Contains    Op = "~"
+	NotContains Op = "!~"
+)
+
+// Node is something a selector is matched against.
+type Node interface {
+	// Values returns the values of a field of the node, such as each of its
+	// labels.
+	Values(field string) []string
+}
+
+// Expr is a compiled selector.
+type Expr interface {
+	Match(n Node) bool
+
+	// String formats the expression so that it parses back to the same
+	// tree.
+	String() string
+}
+
+// And matches nodes matched by all of its expressions.
+type And []Expr
+
+// Or matches nodes matched by any of its expressions.
+type Or []Expr
+
+// Not matches nodes that X does not.
+type Not struct {
+	X Expr
+}
+
+// Compare tests a field of a node against a value.
+type Compare struct {
+	Field string
+	Op    Op
+	Value string
+}
+
+// In matches nodes with a value of Field in Values, or without one if Not
+// is set.
+type In struct {
+	Field  string
+	Values []string
+	Not    bool
+}
+
+// Exists matches nodes with any value for Field, or with none if Not is
+// set.
+type Exists struct {
+	Field string
+	Not   bool
+}
+
+// Const matches every node if true and none if false.
+type Const bool
+
+func (e And) Match(n Node) bool {
+	for _, x := range e {
+		if !x.Match(n) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e Or) Match(n Node) bool {
+	for _, x := range e {
+		if x.Match(n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e Not) Match(n Node) bool {
+	return !e.X.Match(n)
+}
+
+func (e Compare) Match(n Node) bool {
+	test := func(v string) bool { return v == e.Value }
+	if e.Op == Contains || e.Op == NotContains {
+		test = func(v string) bool { return strings.Contains(v, e.Value) }
+	}
+
+	found := false
+	for _, v := range n.Values(e.Field) {
+		if test(v) {
+			found = true
+			break
+		}
+	}
+
+	if e.Op == NotEquals || e.Op == NotContains {
+		return !found
+	}
+
+	return found
+}
+
+func (e In) Match(n Node) bool {
+	for _, v := range n.Values(e.Field) {
+		if slices.Contains(e.Values, v) {
+			return !e.Not
+		}
+	}
+
+	return e.Not
+}
+
+func (e Exists) Match(n Node) bool {
+	return (len(n.Values(e.Field)) > 0) != e.Not
+}
+
+func (e Const) Match(Node) bool {
+	return bool(e)
+}
+
+func (e And) String() string {
+	return join(e, " && ", func(x Expr) bool {
+		_, ok := x.(Or)
+		return ok
+	})
+}
+
+func (e Or) String() string {
+	return join(e, " || ", func(Expr) bool { return false })
+}
+
+func (e Not) String() string {
+	switch e.X.(type) {
+	case And, Or:
+		return "!(" + e.X.String() + ")"
+	}
+
+	return "!" + e.X.String()
+}
+
+func (e Compare) String() string {
+	return e.Field + string(e.Op) + quote(e.Value)
+}
+
+func (e In) String() string {
+	op := " in "
+	if e.Not {
+		op = " notin "
+	}
+
+	vs := make([]string, len(e.Values))
+	for i, v := range e.Values {
+		vs[i] = quote(v)
+	}
+
+	return e.Field + op + "(" + strings.Join(vs, ", ") + ")"
+}
+
+func (e Exists) String() string {
+	if e.Not {
+		return e.Field + " !exists"
+	}
+
+	return e.Field + " exists"
+}
+
+func (e Const) String() string {
+	if e {
+		return "any"
+	}
+
+	return "none"
+}
+
+func join(xs []Expr, sep string, needParens func(Expr) bool) string {
+	parts := make([]string, len(xs))
+	for i, x := range xs {
+		parts[i] = x.String()
+		if needParens(x) {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
+
+// quote double quotes a value if it wouldn't otherwise read back as a
+// single word.
+func quote(v string) string {
+	if v == "" || strings.ContainsFunc(v, func(r rune) bool { return !isWordRune(r) }) {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	alertsFile = "alerts.json"
+)
+
+// alertGate holds back what schedules and playlists would show over an
+// alert on a node until the alert's TTL ends, then puts back what the node
+// should be showing: what it showed before the alert, or the last image
+// held back since. Alerts are persisted to the state dir, so they end even
+// across a restart.
+type alertGate struct {
+	s   *Server
+	dir string
+
+	mu     *sync.Mutex
+	alerts map[string]*message.Alert // By node name.
+	timers map[string]*time.Timer
+}
+
+func newAlertGate(s *Server, stateDir string) (*alertGate, error) {
+	g := &alertGate{
+		s:      s,
+		dir:    stateDir,
+		mu:     new(sync.Mutex),
+		alerts: make(map[string]*message.Alert),
+		timers: make(map[string]*time.Timer),
+	}
+
+	if err := loadState(stateDir, alertsFile, &g.alerts); err != nil {
+		return nil, err
+	}
+
+	for name, a := range g.alerts {
+		g.armLocked(name, a.Until)
+	}
+
+	return g, nil
+}
+
+// admit reports whether the target may be shown over any alert on its
+// node. Scheduled targets are held back to show once the alert ends; other
+// targets of lower priority are refused.
+func (g *alertGate) admit(t revealTarget) (bool, error) {
+	name := t.conn.peerName()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.alerts[name]
+	if !ok {
+		return true, nil
+	}
+
+	if held, err := holds(name, a, t); !held || err != nil {
+		return !held, err
+	}
+
+	a.Underlying = &message.ShownImage{
+		Name:       t.imgData.Name,
+		Hash:       t.imgData.Hash,
+		FitPolicy:  t.fit,
+		Saturation: t.saturationOrDefault(),
+		ShownBy:    t.by,
+	}
+
+	if err := g.saveLocked(); err != nil {
+		t.conn.logger().Warn("saving alerts", logging.Err(err))
+	}
+
+	return false, nil
+}
+
+// check returns when the alert holding back the target ends, or the zero
+// time if there is none, without holding anything back. It returns an error
+// if the target would be refused.
+func (g *alertGate) check(t revealTarget) (time.Time, error) {
+	name := t.conn.peerName()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.alerts[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	if held, err := holds(name, a, t); !held || err != nil {
+		return time.Time{}, err
+	}
+
+	return a.Until, nil
+}
+
+// holds reports whether alert a on node name holds back the target. Anyone
+// may replace an alert of no higher priority than what they show, ending
+// it; schedules and playlists wait for it to end. Other targets of lower
+// priority are refused with an error.
+func holds(name string, a *message.Alert, t revealTarget) (bool, error) {
+	switch {
+	case t.priority > a.Priority, t.priority == a.Priority && !t.scheduled:
+		return false, nil
+	case t.scheduled:
+		return true, nil
+	}
+
+	return true, fmt.Errorf("node %s is showing an alert of priority %d until %s; show with a priority of at least %d to replace it", name, a.Priority, a.Until.Format(time.RFC3339), a.Priority)
+}
+
+// displayed starts an alert once the target is shown, keeping what the node
+// showed before it, or ends the node's alert if the target replaced it.
+func (g *alertGate) displayed(t revealTarget, prev *message.ShownImage) {
+	name := t.conn.peerName()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.alerts[name]
+
+	switch {
+	case t.ttl > 0 && ok:
+		// A new alert replaces the old, but the node still goes back to
+		// what was there before either.
+		a.Priority = t.priority
+		a.Until = time.Now().Add(t.ttl)
+	case t.ttl > 0:
+		a = &message.Alert{
+			Priority:   t.priority,
+			Until:      time.Now().Add(t.ttl),
+			Underlying: prev,
+		}
+		g.alerts[name] = a
+	case ok:
+		delete(g.alerts, name)
+		g.stopLocked(name)
+	default:
+		return
+	}
+
+	if t.ttl > 0 {
+		g.armLocked(name, a.Until)
+	}
+
+	if err := g.saveLocked(); err != nil {
+		t.conn.logger().Warn("saving alerts", logging.Err(err))
+	}
+}
+
+// get returns the alert on a node, if any.
+func (g *alertGate) get(name string) *message.Alert {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.alerts[name]
+	if !ok {
+		return nil
+	}
+
+	ret := *a
+	return &ret
+}
+
+// nodeRegistered ends an alert that ran out while its node was away.
+func (g *alertGate) nodeRegistered(name string) {
+	g.mu.Lock()
+	var until time.Time
+	a, ok := g.alerts[name]
+	if ok {
+		until = a.Until
+	}
+	g.mu.Unlock()
+
+	if ok && !time.Now().Before(until) {
+		go g.expire(name)
+	}
+}
+
+// expire ends a node's alert if it has run out, putting back what the node
+// should be showing. Alerts on nodes that aren't connected end once they
+// reconnect.
+func (g *alertGate) expire(name string) {
+	conn, found := g.s.getConnInfoByName(name)
+	if !found || !conn.displayReady() {
+		return
+	}
+
+	g.mu.Lock()
+	a, ok := g.alerts[name]
+	if !ok || time.Now().Before(a.Until) {
+		g.mu.Unlock()
+		return
+	}
+
+	delete(g.alerts, name)
+	g.stopLocked(name)
+
+	if err := g.saveLocked(); err != nil {
+		conn.logger().Warn("saving alerts", logging.Err(err))
+	}
+	g.mu.Unlock()
+
+	u := a.Underlying
+	if u == nil {
+		conn.logger().Info("alert ended with nothing to put back")
+		return
+	}
+
+	imgData := message.ImageData{Name: u.Name}
+	if err := g.s.resolveImage(&imgData); err != nil {
+		conn.logger().Warn("putting back image after alert", "image", u.Name, logging.Err(err))
+		return
+	}
+
+	if imgData.Hash != u.Hash {
+		conn.logger().Warn("not putting back image after alert since it has changed", "image", u.Name)
+		return
+	}
+
+	// Only the hash is sent on to the node.
+	imgData.Data = nil
+
+	sat := u.Saturation
+
+	_, err := g.s.showOverConn(nil, revealTarget{
+		conn:       conn,
+		imgData:    imgData,
+		fit:        u.FitPolicy,
+		saturation: &sat,
+		by:         u.ShownBy,
+	}, false)
+	if err != nil {
+		conn.logger().Warn("putting back image after alert", "image", u.Name, logging.Err(err))
+	}
+}
+
+// armLocked sets the node's alert to expire at until. mu must be held.
+func (g *alertGate) armLocked(name string, until time.Time) {
+	g.stopLocked(name)
+	g.timers[name] = time.AfterFunc(time.Until(until), func() {
+		g.expire(name)
+	})
+}
+
+// stopLocked stops the node's alert timer, if any. mu must be held.
+func (g *alertGate) stopLocked(name string) {
+	if tm, ok := g.timers[name]; ok {
+		tm.Stop()
+		delete(g.timers, name)
+	}
+}
+
+// saveLocked persists the alerts. mu must be held.
+func (g *alertGate) saveLocked() error {
+	return saveState(g.dir, alertsFile, g.alerts)
+}
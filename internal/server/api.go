@@ -0,0 +1,591 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/hash"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	apiPrefix = "/api/v1"
+
+	// apiImageField is the multipart form field holding uploaded images.
+	apiImageField = "image"
+
+	// apiTraceHeader carries the trace ID of the command run for a request.
+	apiTraceHeader = "X-Barnacle-Trace-Id"
+
+	// apiPeer identifies requests made over the HTTP API in traces.
+	apiPeer = "api"
+
+	multipartMemory = 32 << 20
+
+	// sseKeepAlive is how often an idle event stream is sent a comment, so
+	// that proxies don't time it out.
+	sseKeepAlive = 30 * time.Second
+)
+
+//go:embed openapi.json
+var openAPIDoc []byte
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiShowError is the body of a show that failed for some images: the error,
+// along with what became of each image.
+type apiShowError struct {
+	Error string `json:"error"`
+	*message.ShowImagesResponsePayload
+}
+
+// setupAPIRoutes registers the REST API. Each endpoint builds the same command
+// a websocket client would send and runs it through the same handler.
+func setupAPIRoutes(s *Server) {
+	http.HandleFunc(apiPrefix+"/openapi.json", s.apiOpenAPI)
+	http.HandleFunc(apiPrefix+"/nodes", s.apiNodes)
+	http.HandleFunc(apiPrefix+"/nodes/", s.apiNode)
+	http.HandleFunc(apiPrefix+"/files", s.apiFiles)
+	http.HandleFunc(apiPrefix+"/files/", s.apiFile)
+	http.HandleFunc(apiPrefix+"/show", s.apiShow)
+	http.HandleFunc(apiPrefix+"/events", s.apiEvents)
+}
+
+func (s *Server) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
+
+// apiNodes serves GET /api/v1/nodes[?refresh=true][&clients=true][&selector=EXPR].
+func (s *Server) apiNodes(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	refresh, err := queryBool(r, "refresh")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	clients, err := queryBool(r, "clients")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cmd := &message.Command{
+		Op: message.ListNodesCmd,
+		Payload: &message.CommandPayload{
+			ListNodesPayload: &message.ListNodesPayload{
+				RefreshIdentities: refresh,
+				IncludeClients:    clients,
+				Selector:          r.URL.Query().Get("selector"),
+			},
+		},
+	}
+
+	rp, ok := s.runAPICommand(w, cmd, s.handleListNodes)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rp.ListNodesResponse)
+}
+
+// apiNode serves the resources of a single node under /api/v1/nodes/{name}.
+func (s *Server) apiNode(w http.ResponseWriter, r *http.Request) {
+	name, sub, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, apiPrefix+"/nodes/"), "/")
+	if !ok || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch sub {
+	case "config":
+		s.apiNodeConfig(w, r, name)
+	case "status":
+		s.apiNodeStatus(w, r, name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// apiNodeStatus serves GET /api/v1/nodes/{name}/status.
+func (s *Server) apiNodeStatus(w http.ResponseWriter, r *http.Request, name string) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	if _, found := s.getConnInfoByName(name); !found && s.displays.get(name) == nil {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown node %s", name))
+		return
+	}
+
+	cmd := &message.Command{
+		Op: message.NodeStatusCmd,
+		Payload: &message.CommandPayload{
+			NodeStatusPayload: &message.NodeStatusPayload{
+				Name: name,
+			},
+		},
+	}
+
+	rp, ok := s.runAPICommand(w, cmd, s.handleNodeStatus)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rp.NodeStatusResponse)
+}
+
+// apiNodeConfig serves PUT /api/v1/nodes/{name}/config.
+func (s *Server) apiNodeConfig(w http.ResponseWriter, r *http.Request, name string) {
+	if !allowMethods(w, r, http.MethodPut) {
+		return
+	}
+
+	cfg := message.NodeConfig{}
+	if err := decodeJSONBody(r, &cfg); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("decoding node config: %s", err))
+		return
+	}
+
+	if _, found := s.getConnInfoByName(name); !found {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("could not find connected node with name %s", name))
+		return
+	}
+
+	cmd := &message.Command{
+		Op: message.ConfigSetCmd,
+		Payload: &message.CommandPayload{
+			ConfigSetPayload: &message.ConfigSetPayload{
+				Configs: map[string]message.NodeConfig{
+					name: cfg,
+				},
+			},
+		},
+	}
+
+	_, ok := s.runAPICommand(w, cmd, func(cmd *message.Command) (*message.ResponsePayload, error) {
+		return nil, s.handleConfigSet(cmd)
+	})
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiFiles serves GET /api/v1/files, listing files on the server and every
+// node, and POST /api/v1/files, storing multipart image uploads on the server.
+func (s *Server) apiFiles(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		s.apiUpload(w, r)
+		return
+	}
+
+	cmd := &message.Command{
+		Op: message.ListFilesCmd,
+	}
+
+	rp, ok := s.runAPICommand(w, cmd, s.handleListFiles)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rp.ListFilesResponse)
+}
+
+func (s *Server) apiUpload(w http.ResponseWriter, r *http.Request) {
+	imgs, err := s.readUploads(w, r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, img := range imgs {
+		if _, err := s.validateImage(img); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ret := make([]message.FileInfo, 0, len(imgs))
+	for _, img := range imgs {
+		fi, err := s.storeUpload(img)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		ret = append(ret, fi)
+	}
+
+	writeJSON(w, http.StatusCreated, ret)
+}
+
+// apiFile serves GET /api/v1/files/{name}, returning the raw image stored on
+// the server.
+func (s *Server) apiFile(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	cmd := &message.Command{
+		Op: message.GetImageCmd,
+		Payload: &message.CommandPayload{
+			GetImagePayload: &message.GetImagePayload{
+				Name: strings.TrimPrefix(r.URL.Path, apiPrefix+"/files/"),
+			},
+		},
+	}
+
+	rp, ok := s.runAPICommand(w, cmd, s.handleGetImage)
+	if !ok {
+		return
+	}
+
+	img := rp.GetImageResponse
+
+	w.Header().Set("Content-Type", http.DetectContentType(img.ImageData))
+	w.Header().Set("ETag", strconv.Quote(img.Hash))
+	w.Write(img.ImageData)
+}
+
+// apiShow serves POST /api/v1/show. The body is either a JSON show images
+// payload, whose images may name files already stored on the server instead
+// of carrying data, or a multipart form with images in the "image" field and
+// optional "fit", "mustFitOrientation", "force", "dryRun", "selector",
+// "assign", "seed", "ttl" (such as "10m") and "priority" fields, and a
+// "node" field for each image naming the node to show it on. It answers with
+// what became of each image.
+func (s *Server) apiShow(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	p := &message.ShowImagesPayload{}
+
+	if isMultipart(r) {
+		imgs, err := s.readUploads(w, r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		mustFit, err := strconv.ParseBool(r.FormValue("mustFitOrientation"))
+		if err != nil && r.FormValue("mustFitOrientation") != "" {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid mustFitOrientation: %s", err))
+			return
+		}
+
+		force, err := strconv.ParseBool(r.FormValue("force"))
+		if err != nil && r.FormValue("force") != "" {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid force: %s", err))
+			return
+		}
+
+		dryRun, err := strconv.ParseBool(r.FormValue("dryRun"))
+		if err != nil && r.FormValue("dryRun") != "" {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid dryRun: %s", err))
+			return
+		}
+
+		p.Images = imgs
+		p.FitPolicy = message.FitPolicy(r.FormValue("fit"))
+		p.MustFitOrientation = mustFit
+		p.Force = force
+		p.DryRun = dryRun
+		if v := r.FormValue("seed"); v != "" {
+			seed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid seed: %s", err))
+				return
+			}
+
+			p.Seed = &seed
+		}
+
+		if v := r.FormValue("ttl"); v != "" {
+			ttl, err := time.ParseDuration(v)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl: %s", err))
+				return
+			}
+
+			p.TTL = ttl
+		}
+
+		if v := r.FormValue("priority"); v != "" {
+			priority, err := strconv.Atoi(v)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid priority: %s", err))
+				return
+			}
+
+			p.Priority = priority
+		}
+
+		p.Selector = r.FormValue("selector")
+		p.Nodes = r.Form["node"]
+		p.Assign = r.FormValue("assign")
+	} else {
+		r.Body = s.limitBody(w, r, message.ShowImagesCmd)
+		if err := decodeJSONBody(r, p); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("decoding show request: %s", err))
+			return
+		}
+	}
+
+	cmd := &message.Command{
+		Op: message.ShowImagesCmd,
+		Payload: &message.CommandPayload{
+			ShowImagesPayload: p,
+		},
+	}
+
+	rp, err := s.runLocalCommand(cmd, apiPeer, func(cmd *message.Command) (*message.ResponsePayload, error) {
+		return s.handleShowImages(cmd, apiPeer)
+	})
+
+	w.Header().Set(apiTraceHeader, cmd.TraceID)
+
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, rp.ShowImagesResponse)
+	case rp != nil && rp.ShowImagesResponse != nil && len(rp.ShowImagesResponse.Results) > 0:
+		// Some images may still have been shown; say which.
+		writeJSON(w, http.StatusMultiStatus, apiShowError{
+			Error:                     err.Error(),
+			ShowImagesResponsePayload: rp.ShowImagesResponse,
+		})
+	default:
+		writeCommandError(w, err)
+	}
+}
+
+// apiEvents serves GET /api/v1/events[?type=...][&node=...] as a stream of
+// Server-Sent Events, named by event type. Both filters may be repeated.
+func (s *Server) apiEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	q := r.URL.Query()
+
+	filter := message.WatchEventsPayload{
+		Nodes: q["node"],
+	}
+
+	for _, t := range q["type"] {
+		filter.Types = append(filter.Types, message.EventType(t))
+	}
+
+	if err := filter.Validate(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	events, cancel := s.events.subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e := <-events:
+			if !filter.Matches(e) {
+				continue
+			}
+
+			b, err := json.Marshal(e)
+			if err != nil {
+				slog.Warn("encoding event", logging.Err(err))
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+
+		case <-s.ctx.Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// runAPICommand runs cmd as a local command. Failures are written to w, in
+// which case ok is false.
+func (s *Server) runAPICommand(w http.ResponseWriter, cmd *message.Command, handle localHandler) (rp *message.ResponsePayload, ok bool) {
+	rp, err := s.runLocalCommand(cmd, apiPeer, handle)
+
+	w.Header().Set(apiTraceHeader, cmd.TraceID)
+
+	if err != nil {
+		writeCommandError(w, err)
+		return nil, false
+	}
+
+	return rp, true
+}
+
+// writeCommandError writes the error a local command failed with.
+func writeCommandError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.As(err, new(*invalidCommandError)) {
+		status = http.StatusBadRequest
+	}
+
+	writeAPIError(w, status, err)
+}
+
+// readUploads reads the images in the multipart form of r.
+func (s *Server) readUploads(w http.ResponseWriter, r *http.Request) ([]message.ImageData, error) {
+	if !isMultipart(r) {
+		return nil, errors.New("expected a multipart/form-data request")
+	}
+
+	r.Body = s.limitBody(w, r, message.ShowImagesCmd)
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		return nil, fmt.Errorf("parsing multipart form: %s", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	fhs := r.MultipartForm.File[apiImageField]
+	if len(fhs) == 0 {
+		return nil, fmt.Errorf("no images given in the %q form field", apiImageField)
+	}
+
+	var ret []message.ImageData
+	for _, fh := range fhs {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("opening upload %s: %s", fh.Filename, err)
+		}
+
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading upload %s: %s", fh.Filename, err)
+		}
+
+		h, err := hash.HashBytes(b)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, message.ImageData{
+			Name:   fh.Filename,
+			Origin: apiPeer,
+			Hash:   h,
+			Data:   b,
+		})
+	}
+
+	return ret, nil
+}
+
+// limitBody applies the websocket message limit for op to the request body.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request, op message.Op) io.ReadCloser {
+	if lim := s.transportOpts.Limits.ForOp(op); lim > 0 {
+		return http.MaxBytesReader(w, r.Body, lim)
+	}
+
+	return r.Body
+}
+
+func isMultipart(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "multipart/form-data"
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+
+	return false
+}
+
+func queryBool(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s query parameter %q", key, v)
+	}
+
+	return b, nil
+}
+
+func decodeJSONBody(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("writing API response", logging.Err(err))
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
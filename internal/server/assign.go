@@ -0,0 +1,72 @@
+package server
+
+import (
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/assign"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+// assigner returns the assigner for a show images request's strategy.
+func (s *Server) assigner(p *message.ShowImagesPayload) assign.Assigner {
+	var ret assign.Assigner
+
+	switch assign.Strategy(p.Assign) {
+	case assign.RoundRobinStrategy:
+		ret = s.roundRobin
+	case assign.LeastRecentStrategy:
+		ret = assign.LeastRecent{}
+	case assign.RandomStrategy:
+		seed := time.Now().UnixNano()
+		if p.Seed != nil {
+			seed = *p.Seed
+		}
+
+		ret = assign.Random{Seed: seed}
+	case assign.StickyStrategy:
+		ret = s.sticky
+	default:
+		ret = assign.BestFit{}
+	}
+
+	if p.MustFitOrientation {
+		ret = assign.MatchOrientation(ret)
+	}
+
+	return ret
+}
+
+// assignNodes describes the conns ready to display for an assigner, and
+// returns the conns in the same order.
+func assignNodes(conns []*connInfo) ([]assign.Node, []*connInfo) {
+	var (
+		nodes []assign.Node
+		ready []*connInfo
+	)
+
+	for _, c := range conns {
+		if !c.displayReady() {
+			c.logger().Info("ignoring node, not ready")
+			continue
+		}
+
+		c.mu.Lock()
+		n := assign.Node{
+			Name:     c.nodeStatus.Identity.Name,
+			Portrait: isPortrait(c.nodeStatus.Identity),
+		}
+
+		if c.nodeStatus.Showing != nil {
+			n.LastUpdate = c.nodeStatus.Showing.ShownTime
+		}
+		c.mu.Unlock()
+
+		// Unknown resolutions leave the assigner to go by orientation.
+		n.Width, n.Height, _ = c.hungResolution()
+
+		nodes = append(nodes, n)
+		ready = append(ready, c)
+	}
+
+	return nodes, ready
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	displaysFile = "displays.json"
+)
+
+// displayStore remembers what each node was last shown, persisted to the
+// state dir. An e-paper display keeps its image while its node is away, so
+// this outlives the node's conn and the server.
+type displayStore struct {
+	dir string
+
+	mu      *sync.Mutex
+	showing map[string]message.ShownImage // By node name.
+}
+
+func newDisplayStore(stateDir string) (*displayStore, error) {
+	ds := &displayStore{
+		dir:     stateDir,
+		mu:      new(sync.Mutex),
+		showing: make(map[string]message.ShownImage),
+	}
+
+	if err := loadState(stateDir, displaysFile, &ds.showing); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+func (ds *displayStore) set(node string, shown message.ShownImage) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.showing[node] = shown
+
+	return saveState(ds.dir, displaysFile, ds.showing)
+}
+
+// get returns what the node was last shown, or nil if nothing is known.
+func (ds *displayStore) get(node string) *message.ShownImage {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	shown, ok := ds.showing[node]
+	if !ok {
+		return nil
+	}
+
+	return &shown
+}
+
+// all returns what every node was last shown.
+func (ds *displayStore) all() map[string]message.ShownImage {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ret := make(map[string]message.ShownImage, len(ds.showing))
+	for node, shown := range ds.showing {
+		ret[node] = shown
+	}
+
+	return ret
+}
+
+// handleNodeStatus returns a node's status, or what it was last shown if it
+// isn't connected.
+func (s *Server) handleNodeStatus(cmd *message.Command) (*message.ResponsePayload, error) {
+	p := cmd.Payload
+
+	if p == nil || p.NodeStatusPayload == nil {
+		return nil, errors.New("invalid node status payload")
+	}
+
+	name := p.NodeStatusPayload.Name
+
+	resp := &message.NodeStatusResponsePayload{
+		Status: message.NodeStatus{
+			Identity: message.Identity{Name: name},
+		},
+	}
+
+	if conn, found := s.getConnInfoByName(name); found {
+		conn.mu.Lock()
+		if conn.nodeStatus != nil {
+			resp.Connected = true
+			resp.Status = *conn.nodeStatus
+		}
+		conn.mu.Unlock()
+	}
+
+	if !resp.Connected {
+		resp.Status.Showing = s.displays.get(name)
+		if resp.Status.Showing == nil {
+			return nil, fmt.Errorf("unknown node %s", name)
+		}
+	}
+
+	resp.Status.Alert = s.alerts.get(name)
+	resp.Status.NodeMode = s.modes.get(name)
+
+	return &message.ResponsePayload{
+		NodeStatusResponse: resp,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	eventBufferSize = 64
+)
+
+// eventBus fans server events out to subscribers. Subscribers that fall
+// behind miss events rather than block the server.
+type eventBus struct {
+	mu   *sync.Mutex
+	subs map[chan message.Event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		mu:   new(sync.Mutex),
+		subs: make(map[chan message.Event]struct{}),
+	}
+}
+
+// subscribe returns a channel of events and a func that ends the
+// subscription and closes the channel.
+func (b *eventBus) subscribe() (<-chan message.Event, func()) {
+	ch := make(chan message.Event, eventBufferSize)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBus) publish(e message.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// handleWatchEvents subscribes a client conn to events matching the filters
+// in cmd, replacing any earlier subscription. Events are pushed to the conn as
+// EventCmd commands until it closes.
+func (s *Server) handleWatchEvents(cmd *message.Command, c *connInfo) error {
+	filter := message.WatchEventsPayload{}
+	if p := cmd.Payload; p != nil && p.WatchEventsPayload != nil {
+		filter = *p.WatchEventsPayload
+	}
+
+	events, cancel := s.events.subscribe()
+
+	c.mu.Lock()
+	if c.unwatch != nil {
+		c.unwatch()
+	}
+	c.unwatch = cancel
+	c.mu.Unlock()
+
+	go s.forwardEvents(c, events, cancel, filter)
+
+	return nil
+}
+
+func (s *Server) forwardEvents(c *connInfo, events <-chan message.Event, cancel func(), filter message.WatchEventsPayload) {
+	defer cancel()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// Replaced by a newer subscription.
+				return
+			}
+
+			if !filter.Matches(e) {
+				continue
+			}
+
+			ec := &message.Command{
+				Op: message.EventCmd,
+				Payload: &message.CommandPayload{
+					EventPayload: &message.EventPayload{
+						Event: e,
+					},
+				},
+			}
+
+			if _, err := c.t.SendCommand(ec); err != nil {
+				c.logger().Debug("stopped forwarding events", logging.Err(err))
+				return
+			}
+
+		case <-c.done:
+			return
+
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
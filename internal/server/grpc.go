@@ -0,0 +1,427 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+
+	"github.com/redgoat650/barnacle-net/internal/barnaclepb"
+	"github.com/redgoat650/barnacle-net/internal/hash"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// grpcPeer identifies requests made over the gRPC API in traces.
+	grpcPeer = "grpc"
+
+	// grpcTraceHeader carries the trace ID of the command run for a call.
+	grpcTraceHeader = "x-barnacle-trace-id"
+)
+
+// grpcServer implements the gRPC control API on top of the same handlers
+// used for websocket clients.
+type grpcServer struct {
+	barnaclepb.UnimplementedBarnacleServer
+
+	s *Server
+}
+
+// serveGRPC serves the gRPC control API on addr until the listener fails.
+func (s *Server) serveGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening for gRPC on %s: %s", addr, err)
+	}
+
+	opts := []grpc.ServerOption{}
+	if lim := s.transportOpts.Limits.ForOp(message.ShowImagesCmd); lim > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(lim)))
+	}
+
+	gs := grpc.NewServer(opts...)
+	barnaclepb.RegisterBarnacleServer(gs, &grpcServer{s: s})
+	reflection.Register(gs)
+
+	slog.Info("serving gRPC", "addr", addr)
+
+	return gs.Serve(lis)
+}
+
+// run runs cmd as a local command and converts failures to gRPC statuses.
+func (g *grpcServer) run(ctx context.Context, cmd *message.Command, handle localHandler) (*message.ResponsePayload, error) {
+	rp, err := g.s.runLocalCommand(cmd, grpcPeer, handle)
+
+	grpc.SetHeader(ctx, metadata.Pairs(grpcTraceHeader, cmd.TraceID))
+
+	if err != nil {
+		if errors.As(err, new(*invalidCommandError)) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return rp, nil
+}
+
+func (g *grpcServer) ListNodes(ctx context.Context, req *barnaclepb.ListNodesRequest) (*barnaclepb.ListNodesResponse, error) {
+	cmd := &message.Command{
+		Op: message.ListNodesCmd,
+		Payload: &message.CommandPayload{
+			ListNodesPayload: &message.ListNodesPayload{
+				RefreshIdentities: req.GetRefreshIdentities(),
+				IncludeClients:    req.GetIncludeClients(),
+				Selector:          req.GetSelector(),
+			},
+		},
+	}
+
+	rp, err := g.run(ctx, cmd, g.s.handleListNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &barnaclepb.ListNodesResponse{}
+
+	for remoteAddr, ns := range rp.ListNodesResponse.Nodes {
+		node := &barnaclepb.Node{
+			RemoteAddr: remoteAddr,
+			UpdateTime: timestamppb.New(ns.UpdateTime),
+			Identity:   identityToPB(ns.Identity),
+		}
+
+		if si := ns.Showing; si != nil {
+			node.Showing = &barnaclepb.ShownImage{
+				Name:        si.Name,
+				Hash:        si.Hash,
+				FitPolicy:   string(si.FitPolicy),
+				Saturation:  si.Saturation,
+				RotationDeg: int32(si.RotationDeg),
+				ShownTime:   timestamppb.New(si.ShownTime),
+				ShownBy:     si.ShownBy,
+			}
+		}
+
+		ret.Nodes = append(ret.Nodes, node)
+	}
+
+	for remoteAddr, cs := range rp.ListNodesResponse.Clients {
+		ret.Clients = append(ret.Clients, &barnaclepb.Client{
+			RemoteAddr:  remoteAddr,
+			ConnectTime: timestamppb.New(cs.ConnectTime),
+		})
+	}
+
+	sort.Slice(ret.Nodes, func(i, j int) bool { return ret.Nodes[i].Identity.GetName() < ret.Nodes[j].Identity.GetName() })
+	sort.Slice(ret.Clients, func(i, j int) bool { return ret.Clients[i].RemoteAddr < ret.Clients[j].RemoteAddr })
+
+	return ret, nil
+}
+
+func (g *grpcServer) ListFiles(ctx context.Context, req *barnaclepb.ListFilesRequest) (*barnaclepb.ListFilesResponse, error) {
+	cmd := &message.Command{
+		Op: message.ListFilesCmd,
+	}
+
+	rp, err := g.run(ctx, cmd, g.s.handleListFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &barnaclepb.ListFilesResponse{
+		Files: make(map[string]*barnaclepb.FileList),
+	}
+
+	for owner, files := range rp.ListFilesResponse.FileMap {
+		fl := &barnaclepb.FileList{}
+		for _, fi := range files {
+			fl.Files = append(fl.Files, fileInfoToPB(fi))
+		}
+
+		ret.Files[owner] = fl
+	}
+
+	return ret, nil
+}
+
+func (g *grpcServer) ShowImages(ctx context.Context, req *barnaclepb.ShowImagesRequest) (*barnaclepb.ShowImagesResponse, error) {
+	p := &message.ShowImagesPayload{
+		FitPolicy:          message.FitPolicy(req.GetFitPolicy()),
+		MustFitOrientation: req.GetMustFitOrientation(),
+		Force:              req.GetForce(),
+		Wall:               req.GetWall(),
+		Selector:           req.GetSelector(),
+		Nodes:              req.GetNodes(),
+		Assign:             req.GetAssign(),
+		Seed:               req.Seed,
+		DryRun:             req.GetDryRun(),
+		TTL:                req.GetTtl().AsDuration(),
+		Priority:           int(req.GetPriority()),
+	}
+
+	for _, sel := range req.GetNodeSelectors() {
+		p.NodeSelectors = append(p.NodeSelectors, message.NodeSelector{
+			Logic: message.LogicExpr(sel.GetLogic()),
+			Key:   message.SelectorKey(sel.GetKey()),
+			Value: sel.GetValue(),
+		})
+	}
+
+	for _, img := range req.GetImages() {
+		p.Images = append(p.Images, message.ImageData{
+			Name:   img.GetName(),
+			Origin: img.GetOrigin(),
+			Hash:   img.GetHash(),
+			Data:   img.GetData(),
+		})
+	}
+
+	cmd := &message.Command{
+		Op: message.ShowImagesCmd,
+		Payload: &message.CommandPayload{
+			ShowImagesPayload: p,
+		},
+	}
+
+	rp, err := g.run(ctx, cmd, func(cmd *message.Command) (*message.ResponsePayload, error) {
+		return g.s.handleShowImages(cmd, grpcPeer)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &barnaclepb.ShowImagesResponse{}
+	if rp != nil && rp.ShowImagesResponse != nil {
+		for _, res := range rp.ShowImagesResponse.Results {
+			pr := &barnaclepb.ShowResult{
+				Image:     res.Image,
+				Node:      res.Node,
+				Status:    string(res.Status),
+				Error:     res.Error,
+				FitPolicy: string(res.FitPolicy),
+				Reason:    res.Reason,
+			}
+
+			if res.RotationDeg != nil {
+				rot := int32(*res.RotationDeg)
+				pr.RotationDeg = &rot
+			}
+
+			ret.Results = append(ret.Results, pr)
+		}
+	}
+
+	return ret, nil
+}
+
+func (g *grpcServer) ConfigSet(ctx context.Context, req *barnaclepb.ConfigSetRequest) (*barnaclepb.ConfigSetResponse, error) {
+	configs := make(map[string]message.NodeConfig)
+
+	for name, cfg := range req.GetConfigs() {
+		if _, found := g.s.getConnInfoByName(name); !found {
+			return nil, status.Errorf(codes.NotFound, "could not find connected node with name %s", name)
+		}
+
+		nc := message.NodeConfig{
+			Labels:      cfg.GetLabels(),
+			Orientation: cfg.Orientation,
+		}
+
+		if q := cfg.GetQuietHours(); q != nil {
+			nc.QuietHours = &message.QuietHours{
+				Start:    q.GetStart(),
+				End:      q.GetEnd(),
+				Timezone: q.GetTimezone(),
+			}
+		}
+
+		if b := cfg.GetRefreshBudget(); b != nil {
+			nc.RefreshBudget = &message.RefreshBudget{
+				PerHour: int(b.GetPerHour()),
+				PerDay:  int(b.GetPerDay()),
+			}
+		}
+
+		configs[name] = nc
+	}
+
+	cmd := &message.Command{
+		Op: message.ConfigSetCmd,
+		Payload: &message.CommandPayload{
+			ConfigSetPayload: &message.ConfigSetPayload{
+				Configs: configs,
+			},
+		},
+	}
+
+	_, err := g.run(ctx, cmd, func(cmd *message.Command) (*message.ResponsePayload, error) {
+		return nil, g.s.handleConfigSet(cmd)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &barnaclepb.ConfigSetResponse{}, nil
+}
+
+func (g *grpcServer) WatchEvents(req *barnaclepb.WatchEventsRequest, stream grpc.ServerStreamingServer[barnaclepb.Event]) error {
+	filter := message.WatchEventsPayload{
+		Nodes: req.GetNodes(),
+	}
+
+	for _, t := range req.GetTypes() {
+		filter.Types = append(filter.Types, message.EventType(t))
+	}
+
+	if err := filter.Validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	events, cancel := g.s.events.subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case e := <-events:
+			if !filter.Matches(e) {
+				continue
+			}
+
+			if err := stream.Send(eventToPB(e)); err != nil {
+				return err
+			}
+
+		case <-stream.Context().Done():
+			return nil
+
+		case <-g.s.ctx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		}
+	}
+}
+
+func (g *grpcServer) UploadImage(stream grpc.ClientStreamingServer[barnaclepb.UploadImageRequest, barnaclepb.FileInfo]) error {
+	lim := g.s.transportOpts.Limits.ForOp(message.ShowImagesCmd)
+
+	img := message.ImageData{
+		Origin: grpcPeer,
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if img.Name == "" {
+			img.Name = req.GetName()
+		}
+
+		img.Data = append(img.Data, req.GetData()...)
+
+		if lim > 0 && int64(len(img.Data)) > lim {
+			return status.Errorf(codes.ResourceExhausted, "upload exceeds limit of %d bytes", lim)
+		}
+	}
+
+	if img.Name == "" {
+		return status.Error(codes.InvalidArgument, "upload did not name the image")
+	}
+
+	if _, err := g.s.validateImage(img); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	h, err := hash.HashBytes(img.Data)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	img.Hash = h
+
+	fi, err := g.s.storeUpload(img)
+	if err != nil {
+		slog.Warn("storing gRPC upload", "image", img.Name, logging.Err(err))
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return stream.SendAndClose(fileInfoToPB(fi))
+}
+
+func identityToPB(id message.Identity) *barnaclepb.Identity {
+	ret := &barnaclepb.Identity{
+		Name:           id.Name,
+		Labels:         id.Labels,
+		Orientation:    string(id.Orientation),
+		Role:           string(id.Role),
+		Username:       id.Username,
+		Hostname:       id.Hostname,
+		NumCpu:         int32(id.NumCPU),
+		Pid:            int32(id.PID),
+		DisplayIdError: id.DisplayIDError,
+	}
+
+	if d := id.Display; d != nil {
+		ret.Display = &barnaclepb.Display{
+			Responding:      d.DisplayResponding,
+			Colors:          int32(d.Colors),
+			Width:           int32(d.Width),
+			Height:          int32(d.Height),
+			RefreshEstimate: durationpb.New(d.RefreshEstimate),
+		}
+	}
+
+	if q := id.QuietHours; q != nil {
+		ret.QuietHours = &barnaclepb.QuietHours{
+			Start:    q.Start,
+			End:      q.End,
+			Timezone: q.Timezone,
+		}
+	}
+
+	if b := id.RefreshBudget; b != nil {
+		ret.RefreshBudget = &barnaclepb.RefreshBudget{
+			PerHour: int32(b.PerHour),
+			PerDay:  int32(b.PerDay),
+		}
+	}
+
+	return ret
+}
+
+func fileInfoToPB(fi message.FileInfo) *barnaclepb.FileInfo {
+	return &barnaclepb.FileInfo{
+		Name:    fi.Name,
+		Size:    fi.Size,
+		Mode:    uint32(fi.Mode),
+		ModTime: timestamppb.New(fi.ModTime),
+		Hash:    fi.Hash,
+	}
+}
+
+func eventToPB(e message.Event) *barnaclepb.Event {
+	return &barnaclepb.Event{
+		Type:       string(e.Type),
+		Time:       timestamppb.New(e.Time),
+		Role:       string(e.Role),
+		RemoteAddr: e.RemoteAddr,
+		Node:       e.Node,
+		Image:      e.Image,
+		TraceId:    e.TraceID,
+		Detail:     e.Detail,
+	}
+}
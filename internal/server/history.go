@@ -0,0 +1,248 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	historyFile = "history.json"
+
+	// historyLimit is how many entries are kept for each node.
+	historyLimit = 100
+)
+
+// nodeHistory is what a node has been shown, and where it is in that
+// history for stepping back and forward. Entries are numbered from 1 so
+// that 0 means none.
+type nodeHistory struct {
+	Entries []message.HistoryEntry `json:"entries"`
+	NextSeq int                    `json:"nextSeq"`
+	Current int                    `json:"current,omitempty"`
+
+	// Seqs of the entries to step back and forward to, nearest last.
+	Back    []int `json:"back,omitempty"`
+	Forward []int `json:"forward,omitempty"`
+}
+
+// historyStore holds the display history of every node, persisted to the
+// state dir.
+type historyStore struct {
+	dir string
+
+	mu    *sync.Mutex
+	nodes map[string]*nodeHistory
+}
+
+func newHistoryStore(stateDir string) (*historyStore, error) {
+	hs := &historyStore{
+		dir:   stateDir,
+		mu:    new(sync.Mutex),
+		nodes: make(map[string]*nodeHistory),
+	}
+
+	if err := loadState(stateDir, historyFile, &hs.nodes); err != nil {
+		return nil, err
+	}
+
+	return hs, nil
+}
+
+// record adds an image shown on a node to its history. If it was shown by
+// stepping back or forward to entry from, the node's place in its history
+// moves; otherwise, as in a browser, there is nothing left to step forward
+// to.
+func (hs *historyStore) record(node string, shown message.ShownImage, move message.HistoryMove, from int) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	h, ok := hs.nodes[node]
+	if !ok {
+		h = &nodeHistory{}
+		hs.nodes[node] = h
+	}
+
+	switch {
+	case move == message.HistoryBack && last(h.Back) == from:
+		h.Back = h.Back[:len(h.Back)-1]
+		h.Forward = appendSeq(h.Forward, h.Current)
+	case move == message.HistoryForward && last(h.Forward) == from:
+		h.Forward = h.Forward[:len(h.Forward)-1]
+		h.Back = appendSeq(h.Back, h.Current)
+	default:
+		// Someone else showed an image since the step was planned.
+		move = ""
+		h.Back = appendSeq(h.Back, h.Current)
+		h.Forward = nil
+	}
+
+	h.NextSeq++
+	h.Current = h.NextSeq
+	h.Entries = append(h.Entries, message.HistoryEntry{
+		Seq:        h.Current,
+		ShownImage: shown,
+		Move:       move,
+	})
+
+	h.trim()
+
+	return saveState(hs.dir, historyFile, hs.nodes)
+}
+
+// peek returns the entry a node would step back or forward to.
+func (hs *historyStore) peek(node string, move message.HistoryMove) (message.HistoryEntry, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	h, ok := hs.nodes[node]
+	if !ok {
+		return message.HistoryEntry{}, fmt.Errorf("no history for node %s", node)
+	}
+
+	seqs, dir := h.Back, "earlier"
+	if move == message.HistoryForward {
+		seqs, dir = h.Forward, "later"
+	}
+
+	if seq := last(seqs); seq > 0 {
+		for _, e := range h.Entries {
+			if e.Seq == seq {
+				return e, nil
+			}
+		}
+	}
+
+	return message.HistoryEntry{}, fmt.Errorf("node %s has no %s image in its history", node, dir)
+}
+
+func (hs *historyStore) get(node string) (message.HistoryResponsePayload, bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	h, ok := hs.nodes[node]
+	if !ok {
+		return message.HistoryResponsePayload{}, false
+	}
+
+	return message.HistoryResponsePayload{
+		Node:    node,
+		Entries: append([]message.HistoryEntry(nil), h.Entries...),
+		Current: h.Current,
+		Back:    len(h.Back),
+		Forward: len(h.Forward),
+	}, true
+}
+
+// trim forgets the oldest entries beyond historyLimit.
+func (h *nodeHistory) trim() {
+	if len(h.Entries) <= historyLimit {
+		return
+	}
+
+	h.Entries = h.Entries[len(h.Entries)-historyLimit:]
+	oldest := h.Entries[0].Seq
+
+	keep := func(seqs []int) []int {
+		var ret []int
+		for _, seq := range seqs {
+			if seq >= oldest {
+				ret = append(ret, seq)
+			}
+		}
+
+		return ret
+	}
+
+	h.Back, h.Forward = keep(h.Back), keep(h.Forward)
+}
+
+// last returns the last seq of seqs, or 0 if there are none.
+func last(seqs []int) int {
+	if len(seqs) == 0 {
+		return 0
+	}
+
+	return seqs[len(seqs)-1]
+}
+
+// appendSeq appends seq to seqs unless it is 0.
+func appendSeq(seqs []int, seq int) []int {
+	if seq == 0 {
+		return seqs
+	}
+
+	return append(seqs, seq)
+}
+
+func (s *Server) handleHistory(cmd *message.Command) (*message.ResponsePayload, error) {
+	p := cmd.Payload
+
+	if p == nil || p.HistoryPayload == nil {
+		return nil, errors.New("invalid history payload")
+	}
+
+	node := p.HistoryPayload.Node
+
+	hist, ok := s.history.get(node)
+	if !ok {
+		return nil, fmt.Errorf("no history for node %s", node)
+	}
+
+	return &message.ResponsePayload{
+		HistoryResponse: &hist,
+	}, nil
+}
+
+// handleHistoryMove shows a node, on behalf of by, the image before or after
+// the one it is showing in its history, rendered as it was then.
+func (s *Server) handleHistoryMove(cmd *message.Command, by string, move message.HistoryMove) (*message.ResponsePayload, error) {
+	p := cmd.Payload
+
+	if p == nil || p.HistoryMovePayload == nil {
+		return nil, errors.New("invalid history move payload")
+	}
+
+	movePayload := p.HistoryMovePayload
+
+	conn, found := s.getConnInfoByName(movePayload.Node)
+	switch {
+	case !found:
+		return nil, fmt.Errorf("node %s is not connected", movePayload.Node)
+	case !conn.displayReady():
+		return nil, fmt.Errorf("node %s is not ready to display", movePayload.Node)
+	}
+
+	e, err := s.history.peek(movePayload.Node, move)
+	if err != nil {
+		return nil, err
+	}
+
+	imgData := message.ImageData{Name: e.Name}
+	if err := s.resolveImage(&imgData); err != nil {
+		return nil, err
+	}
+
+	if imgData.Hash != e.Hash {
+		return nil, fmt.Errorf("image %s has changed since it was shown", e.Name)
+	}
+
+	// Only the hash is sent on to the node.
+	imgData.Data = nil
+
+	sat := e.Saturation
+
+	results, err := s.reveal(cmd, []revealTarget{{
+		conn:       conn,
+		imgData:    imgData,
+		fit:        e.FitPolicy,
+		saturation: &sat,
+		by:         by,
+		move:       move,
+		from:       e.Seq,
+	}}, movePayload.Force, false)
+
+	return showResponse(results), err
+}
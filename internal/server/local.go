@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/trace"
+)
+
+// localHandler handles a command that did not arrive over a websocket.
+type localHandler func(cmd *message.Command) (*message.ResponsePayload, error)
+
+// invalidCommandError is returned by runLocalCommand when the command fails
+// validation, as opposed to failing while it is handled.
+type invalidCommandError struct {
+	op  message.Op
+	err error
+}
+
+func (e *invalidCommandError) Error() string {
+	return fmt.Sprintf("invalid %s request: %s", e.op, e.err)
+}
+
+// runLocalCommand validates cmd and passes it to handle as though it had
+// arrived from a websocket client, so that commands issued through the HTTP
+// and gRPC APIs are traced and measured like any other. peer identifies the
+// API in traces.
+func (s *Server) runLocalCommand(cmd *message.Command, peer string, handle localHandler) (*message.ResponsePayload, error) {
+	tNow := time.Now()
+	cmd.SubmitTime = &tNow
+	cmd.ArriveTime = &tNow
+	cmd.TraceID = trace.NewID()
+	cmd.SpanID = trace.NewID()
+
+	l := logging.WithCommand(slog.With(slog.String(logging.RoleKey, peer)), cmd)
+
+	if err := cmd.Validate(); err != nil {
+		l.Debug("rejecting invalid request", logging.Err(err))
+		return nil, &invalidCommandError{op: cmd.Op, err: err}
+	}
+
+	rp, err := handle(cmd)
+	s.recordLocalSpan(cmd, peer, err)
+
+	l.Debug("handled request", logging.Err(err))
+
+	return rp, err
+}
+
+// recordLocalSpan records the span a websocket transport would have recorded
+// for cmd.
+func (s *Server) recordLocalSpan(cmd *message.Command, peer string, err error) {
+	tNow := time.Now()
+
+	sp := message.Span{
+		TraceID:     cmd.TraceID,
+		SpanID:      cmd.SpanID,
+		Op:          cmd.Op,
+		Kind:        message.HandledSpan,
+		Peer:        peer,
+		SubmitTime:  cmd.SubmitTime,
+		ArriveTime:  cmd.ArriveTime,
+		RespondTime: &tNow,
+	}
+
+	if err != nil {
+		sp.Error = err.Error()
+	}
+
+	s.metrics.observeSpan(sp)
+
+	if s.tracer != nil {
+		s.tracer.Record(sp)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/metrics"
+)
+
+// serverMetrics are exposed for scraping on /metrics.
+type serverMetrics struct {
+	reg *metrics.Registry
+
+	commands       *metrics.CounterVec
+	commandLatency *metrics.HistogramVec
+	refresh        *metrics.HistogramVec
+	transferBytes  *metrics.CounterVec
+}
+
+func newServerMetrics(s *Server) *serverMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &serverMetrics{
+		reg: reg,
+		commands: reg.NewCounterVec("barnacle_commands_total",
+			"Commands handled or sent by the server, by op and result.",
+			"op", "kind", "result"),
+		commandLatency: reg.NewHistogramVec("barnacle_command_latency_seconds",
+			"Time from a command arriving to its response being sent (handled), or from submission to the response arriving (sent).",
+			metrics.DefBuckets, "op", "kind"),
+		refresh: reg.NewHistogramVec("barnacle_display_refresh_seconds",
+			"Time taken by a node to successfully display an image.",
+			metrics.DefBuckets, "node"),
+		transferBytes: reg.NewCounterVec("barnacle_transfer_bytes_total",
+			"Image bytes received by the server (in) and served from its image store (out).",
+			"direction", "op"),
+	}
+
+	reg.NewGaugeFunc("barnacle_connected",
+		"Connected websocket peers by role.",
+		[]string{"role"}, s.connectedSamples)
+
+	reg.NewGaugeFunc("barnacle_inflight_commands",
+		"Commands sent to a peer that are awaiting a response.",
+		[]string{"role", "peer"}, func() []metrics.Sample {
+			return s.transportSamples(func(c *connInfo) int { return c.t.Inflight() })
+		})
+
+	reg.NewGaugeFunc("barnacle_incoming_queue_depth",
+		"Commands received from a peer that are waiting to be handled.",
+		[]string{"role", "peer"}, func() []metrics.Sample {
+			return s.transportSamples(func(c *connInfo) int { return c.t.QueueDepth() })
+		})
+
+	reg.NewGaugeFunc("barnacle_image_store_bytes",
+		"Total size of images stored on the server.",
+		nil, func() []metrics.Sample {
+			size, _ := s.imageStoreSize()
+			return []metrics.Sample{{Value: float64(size)}}
+		})
+
+	reg.NewGaugeFunc("barnacle_image_store_files",
+		"Number of images stored on the server.",
+		nil, func() []metrics.Sample {
+			_, n := s.imageStoreSize()
+			return []metrics.Sample{{Value: float64(n)}}
+		})
+
+	return m
+}
+
+// observeSpan derives command counts and latencies from a transport span.
+// Both ends of each measured interval are taken from the server's clock.
+func (m *serverMetrics) observeSpan(sp message.Span) {
+	result := "success"
+	if sp.Error != "" {
+		result = "error"
+	}
+
+	m.commands.With(string(sp.Op), string(sp.Kind), result).Inc()
+
+	start, end := sp.ArriveTime, sp.RespondTime
+	if sp.Kind == message.SentSpan {
+		start, end = sp.SubmitTime, sp.DoneTime
+	}
+
+	if start != nil && end != nil {
+		m.commandLatency.With(string(sp.Op), string(sp.Kind)).Observe(end.Sub(*start).Seconds())
+	}
+}
+
+func (s *Server) connectedSamples() []metrics.Sample {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	return []metrics.Sample{
+		{LabelValues: []string{string(message.NodeRole)}, Value: float64(len(s.conns))},
+		{LabelValues: []string{string(message.ClientRole)}, Value: float64(len(s.clients))},
+	}
+}
+
+func (s *Server) transportSamples(get func(c *connInfo) int) []metrics.Sample {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	var ret []metrics.Sample
+	for _, registry := range []map[string]*connInfo{s.conns, s.clients} {
+		for _, c := range registry {
+			ret = append(ret, metrics.Sample{
+				LabelValues: []string{string(c.role), c.peerName()},
+				Value:       float64(get(c)),
+			})
+		}
+	}
+
+	return ret
+}
+
+func (s *Server) imageStoreSize() (size int64, n int) {
+	filepath.WalkDir(s.imgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		size += info.Size()
+		n++
+
+		return nil
+	})
+
+	return size, n
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	modesFile = "modes.json"
+)
+
+// modeStore holds which nodes are cordoned or locked, persisted to the
+// state dir so that a node taken down for repair stays out of automatic
+// assignment when it reconnects.
+type modeStore struct {
+	dir string
+
+	mu    *sync.Mutex
+	modes map[string]message.NodeMode // By node name.
+}
+
+func newModeStore(stateDir string) (*modeStore, error) {
+	ms := &modeStore{
+		dir:   stateDir,
+		mu:    new(sync.Mutex),
+		modes: make(map[string]message.NodeMode),
+	}
+
+	if err := loadState(stateDir, modesFile, &ms.modes); err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// set updates a node's mode, leaving unset fields alone, and returns the
+// new mode.
+func (ms *modeStore) set(node string, cordoned, locked *bool) (message.NodeMode, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	m := ms.modes[node]
+	if cordoned != nil {
+		m.Cordoned = *cordoned
+	}
+	if locked != nil {
+		m.Locked = *locked
+	}
+
+	if m.Excluded() {
+		ms.modes[node] = m
+	} else {
+		delete(ms.modes, node)
+	}
+
+	return m, saveState(ms.dir, modesFile, ms.modes)
+}
+
+func (ms *modeStore) get(node string) message.NodeMode {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.modes[node]
+}
+
+// excluded reports whether automatic assignment skips the conn's node.
+func (ms *modeStore) excluded(conn *connInfo) bool {
+	return ms.get(conn.peerName()).Excluded()
+}
+
+// checkLocked returns an error if the node is locked.
+func (ms *modeStore) checkLocked(node string) error {
+	if ms.get(node).Locked {
+		return fmt.Errorf("node %s is locked", node)
+	}
+
+	return nil
+}
+
+func (s *Server) handleNodeMode(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.NodeModePayload == nil {
+		return errors.New("invalid node mode payload")
+	}
+
+	modePayload := p.NodeModePayload
+
+	if _, found := s.getConnInfoByName(modePayload.Node); !found && s.displays.get(modePayload.Node) == nil {
+		return fmt.Errorf("unknown node %s", modePayload.Node)
+	}
+
+	m, err := s.modes.set(modePayload.Node, modePayload.Cordoned, modePayload.Locked)
+	if err != nil {
+		return err
+	}
+
+	// Catch the node up on its schedule once it is back.
+	if !m.Excluded() {
+		s.scheduler.nodeRegistered(modePayload.Node)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+// playlistState is a playlist and the scheduler's progress through it, as
+// persisted to the state dir.
+type playlistState struct {
+	Playlist message.Playlist `json:"playlist"`
+
+	// Order lists item indexes in the order they are shown; shuffled
+	// playlists are reshuffled each time they wrap around.
+	Order    []int     `json:"order"`
+	Position int       `json:"position"` // Index into Order of the next item.
+	Current  string    `json:"current,omitempty"`
+	NextTime time.Time `json:"nextTime"`
+}
+
+// cycling reports whether a playlist should be moving through its items:
+// it is unpaused and either assigned to nodes or used by a schedule.
+func (ps *playlistState) cycling(referenced map[string]bool) bool {
+	if ps.Playlist.Paused || len(ps.Playlist.Items) == 0 {
+		return false
+	}
+
+	return !ps.Playlist.Target.Empty() || referenced[ps.Playlist.Name]
+}
+
+// referencedPlaylists returns the names of playlists used by schedule rules.
+// mu must be held.
+func (sch *scheduler) referencedPlaylists() map[string]bool {
+	ret := make(map[string]bool)
+	for _, sc := range sch.schedules {
+		for _, r := range sc.Rules {
+			if r.Playlist != "" {
+				ret[r.Playlist] = true
+			}
+		}
+	}
+
+	return ret
+}
+
+// advanceDue moves every cycling playlist whose next item is due on to it.
+func (sch *scheduler) advanceDue(now time.Time) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	referenced := sch.referencedPlaylists()
+
+	advanced := false
+	for _, ps := range sch.playlists {
+		if !ps.cycling(referenced) || ps.NextTime.After(now) {
+			continue
+		}
+
+		i := ps.advance()
+		ps.NextTime = now.Add(ps.Playlist.ItemDwell(i))
+		advanced = true
+	}
+
+	if advanced {
+		if err := saveState(sch.dir, playlistsFile, sch.playlists); err != nil {
+			slog.Warn("saving playlists", logging.Err(err))
+		}
+	}
+}
+
+// advance moves to the next item and returns its index.
+func (ps *playlistState) advance() int {
+	if len(ps.Order) != len(ps.Playlist.Items) || ps.Position >= len(ps.Order) {
+		ps.reorder()
+	}
+
+	i := ps.Order[ps.Position]
+	ps.Current = ps.Playlist.Items[i].Image
+
+	ps.Position++
+	if ps.Position == len(ps.Order) {
+		ps.reorder()
+	}
+
+	return i
+}
+
+func (ps *playlistState) reorder() {
+	ps.Position = 0
+	ps.Order = make([]int, len(ps.Playlist.Items))
+	for i := range ps.Order {
+		ps.Order[i] = i
+	}
+
+	if ps.Playlist.Shuffle {
+		rand.Shuffle(len(ps.Order), func(i, j int) {
+			ps.Order[i], ps.Order[j] = ps.Order[j], ps.Order[i]
+		})
+	}
+}
+
+func (sch *scheduler) create(p message.Playlist) error {
+	for _, item := range p.Items {
+		if _, err := os.Stat(sch.s.imgFilePath(item.Image)); err != nil {
+			return fmt.Errorf("image %s is not stored on the server", item.Image)
+		}
+	}
+
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	ps := &playlistState{
+		Playlist: p,
+		NextTime: time.Now(),
+	}
+	ps.reorder()
+
+	sch.playlists[p.Name] = ps
+
+	defer sch.poke()
+	return saveState(sch.dir, playlistsFile, sch.playlists)
+}
+
+// update applies fn to the named playlist, persists the result and wakes the
+// scheduler.
+func (sch *scheduler) update(name string, fn func(ps *playlistState)) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	ps, ok := sch.playlists[name]
+	if !ok {
+		return fmt.Errorf("no playlist named %s", name)
+	}
+
+	fn(ps)
+
+	defer sch.poke()
+	return saveState(sch.dir, playlistsFile, sch.playlists)
+}
+
+func (sch *scheduler) list() []message.PlaylistStatus {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	var ret []message.PlaylistStatus
+	referenced := sch.referencedPlaylists()
+	for _, ps := range sch.playlists {
+		st := message.PlaylistStatus{
+			Playlist: ps.Playlist,
+			Current:  ps.Current,
+		}
+
+		if ps.cycling(referenced) {
+			nextTime := ps.NextTime
+			st.NextTime = &nextTime
+			if ps.Position < len(ps.Order) {
+				st.Next = ps.Playlist.Items[ps.Order[ps.Position]].Image
+			}
+		}
+
+		ret = append(ret, st)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Playlist.Name < ret[j].Playlist.Name })
+
+	return ret
+}
+
+func (s *Server) handlePlaylistCreate(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.PlaylistCreatePayload == nil {
+		return errors.New("invalid playlist create payload")
+	}
+
+	return s.scheduler.create(p.PlaylistCreatePayload.Playlist)
+}
+
+func (s *Server) handlePlaylistAssign(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.PlaylistAssignPayload == nil {
+		return errors.New("invalid playlist assign payload")
+	}
+
+	return s.scheduler.update(p.PlaylistAssignPayload.Name, func(ps *playlistState) {
+		ps.Playlist.Target = p.PlaylistAssignPayload.Target
+		ps.NextTime = time.Now()
+	})
+}
+
+func (s *Server) handlePlaylistPause(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.PlaylistPausePayload == nil {
+		return errors.New("invalid playlist pause payload")
+	}
+
+	return s.scheduler.update(p.PlaylistPausePayload.Name, func(ps *playlistState) {
+		if ps.Playlist.Paused && !p.PlaylistPausePayload.Paused {
+			// Show the next item as soon as the playlist resumes.
+			ps.NextTime = time.Now()
+		}
+
+		ps.Playlist.Paused = p.PlaylistPausePayload.Paused
+	})
+}
+
+func (s *Server) handlePlaylistNext(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.PlaylistNextPayload == nil {
+		return errors.New("invalid playlist next payload")
+	}
+
+	return s.scheduler.update(p.PlaylistNextPayload.Name, func(ps *playlistState) {
+		ps.NextTime = time.Now()
+	})
+}
+
+func (s *Server) handleListPlaylists(cmd *message.Command) (*message.ResponsePayload, error) {
+	return &message.ResponsePayload{
+		ListPlaylistsResponse: &message.ListPlaylistsResponsePayload{
+			Playlists: s.scheduler.list(),
+		},
+	}, nil
+}
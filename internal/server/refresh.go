@@ -0,0 +1,310 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/schedule"
+)
+
+const (
+	refreshesFile = "refreshes.json"
+)
+
+// refreshGate holds back display refreshes that fall in a node's quiet hours
+// or would exceed its refresh budget, and shows the latest held back image
+// once they are allowed again. Refresh history is kept by node name and
+// persisted to the state dir, so it survives reconnects and restarts.
+type refreshGate struct {
+	s   *Server
+	dir string
+
+	mu    *sync.Mutex
+	nodes map[string]*nodeRefreshes
+}
+
+type nodeRefreshes struct {
+	Times    []time.Time      `json:"times,omitempty"` // Refreshes within the last day, oldest first.
+	Deferred *deferredDisplay `json:"deferred,omitempty"`
+
+	timer *time.Timer
+}
+
+// deferredDisplay is the image held back for a node, shown once the node
+// may refresh if it hasn't changed since.
+type deferredDisplay struct {
+	message.ShownImage
+
+	Scheduled bool                `json:"scheduled,omitempty"`
+	Move      message.HistoryMove `json:"move,omitempty"`
+	From      int                 `json:"from,omitempty"`
+	TTL       time.Duration       `json:"ttl,omitempty"`
+	Priority  int                 `json:"priority,omitempty"`
+}
+
+func newRefreshGate(s *Server, stateDir string) (*refreshGate, error) {
+	g := &refreshGate{
+		s:     s,
+		dir:   stateDir,
+		mu:    new(sync.Mutex),
+		nodes: make(map[string]*nodeRefreshes),
+	}
+
+	// Deferred displays are released as their nodes register.
+	if err := loadState(stateDir, refreshesFile, &g.nodes); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// admit reports whether t's display may be refreshed with its image now,
+// and counts the refresh if so. Otherwise the image replaces any display
+// already held back for the node, to be shown when allowed. Forced
+// refreshes are always admitted.
+func (g *refreshGate) admit(t revealTarget, force bool, traceID string) bool {
+	conn, imgData := t.conn, t.imgData
+	name := conn.peerName()
+
+	conn.mu.Lock()
+	var id message.Identity
+	if conn.nodeStatus != nil {
+		id = conn.nodeStatus.Identity
+	}
+	conn.mu.Unlock()
+
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	nr, ok := g.nodes[name]
+	if !ok {
+		nr = new(nodeRefreshes)
+		g.nodes[name] = nr
+	}
+
+	nr.prune(now)
+
+	until, reason := holdUntil(id, nr.Times, now)
+	if force || until.IsZero() {
+		// Anything held back is stale now that newer content is showing.
+		nr.Deferred = nil
+		if nr.timer != nil {
+			nr.timer.Stop()
+		}
+
+		nr.Times = append(nr.Times, now)
+
+		if err := g.saveLocked(); err != nil {
+			conn.logger().Warn("saving refreshes", logging.Err(err))
+		}
+
+		return true
+	}
+
+	nr.Deferred = &deferredDisplay{
+		ShownImage: message.ShownImage{
+			Name:       imgData.Name,
+			Hash:       imgData.Hash,
+			FitPolicy:  t.fit,
+			Saturation: t.saturationOrDefault(),
+			ShownBy:    t.by,
+		},
+		Scheduled: t.scheduled,
+		Move:      t.move,
+		From:      t.from,
+		TTL:       t.ttl,
+		Priority:  t.priority,
+	}
+
+	if err := g.saveLocked(); err != nil {
+		conn.logger().Warn("saving refreshes", logging.Err(err))
+	}
+
+	if nr.timer != nil {
+		nr.timer.Stop()
+	}
+	nr.timer = time.AfterFunc(until.Sub(now), func() { g.release(name) })
+
+	conn.logger().Info("deferring display", "image", imgData.Name, "reason", reason, "until", until)
+
+	g.s.events.publish(message.Event{
+		Type:       message.ImageDeferredEvent,
+		Role:       conn.role,
+		RemoteAddr: conn.remoteAddr,
+		Node:       name,
+		Image:      imgData.Name,
+		TraceID:    traceID,
+		Detail:     fmt.Sprintf("%s until %s", reason, until.Format(time.RFC3339)),
+	})
+
+	return false
+}
+
+// check returns when conn's display may next be refreshed, and why, or the
+// zero time if it may be refreshed now, without counting a refresh.
+func (g *refreshGate) check(conn *connInfo) (time.Time, string) {
+	name := conn.peerName()
+
+	conn.mu.Lock()
+	var id message.Identity
+	if conn.nodeStatus != nil {
+		id = conn.nodeStatus.Identity
+	}
+	conn.mu.Unlock()
+
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var times []time.Time
+	if nr, ok := g.nodes[name]; ok {
+		times = nr.Times
+	}
+
+	return holdUntil(id, times, now)
+}
+
+// release shows the display held back for a node, unless its image has
+// changed since. If the node isn't connected, it is kept until the node
+// registers again.
+func (g *refreshGate) release(name string) {
+	conn, found := g.s.getConnInfoByName(name)
+	if !found || !conn.displayReady() {
+		return
+	}
+
+	g.mu.Lock()
+	nr, ok := g.nodes[name]
+	if !ok || nr.Deferred == nil {
+		g.mu.Unlock()
+		return
+	}
+
+	d := nr.Deferred
+	nr.Deferred = nil
+
+	if err := g.saveLocked(); err != nil {
+		conn.logger().Warn("saving refreshes", logging.Err(err))
+	}
+	g.mu.Unlock()
+
+	imgData := message.ImageData{Name: d.Name}
+	if err := g.s.resolveImage(&imgData); err != nil {
+		conn.logger().Warn("showing deferred image", "image", d.Name, logging.Err(err))
+		return
+	}
+
+	if imgData.Hash != d.Hash {
+		conn.logger().Warn("not showing deferred image since it has changed", "image", d.Name)
+		return
+	}
+
+	// Only the hash is sent on to the node.
+	imgData.Data = nil
+
+	sat := d.Saturation
+
+	_, err := g.s.showOverConn(nil, revealTarget{
+		conn:       conn,
+		imgData:    imgData,
+		fit:        d.FitPolicy,
+		saturation: &sat,
+		by:         d.ShownBy,
+		scheduled:  d.Scheduled,
+		move:       d.Move,
+		from:       d.From,
+		ttl:        d.TTL,
+		priority:   d.Priority,
+	}, false)
+	if err != nil {
+		conn.logger().Warn("showing deferred image", "image", d.Name, logging.Err(err))
+	}
+}
+
+// nodeRegistered shows the display held back for a node while it was away.
+// If it is still held back, it is deferred again until allowed.
+func (g *refreshGate) nodeRegistered(name string) {
+	g.mu.Lock()
+	nr, ok := g.nodes[name]
+	pending := ok && nr.Deferred != nil
+	g.mu.Unlock()
+
+	if pending {
+		go g.release(name)
+	}
+}
+
+// prune forgets refreshes more than a day old.
+func (nr *nodeRefreshes) prune(now time.Time) {
+	i := 0
+	for i < len(nr.Times) && now.Sub(nr.Times[i]) >= 24*time.Hour {
+		i++
+	}
+
+	nr.Times = nr.Times[i:]
+}
+
+// saveLocked persists the refreshes. mu must be held.
+func (g *refreshGate) saveLocked() error {
+	return saveState(g.dir, refreshesFile, g.nodes)
+}
+
+// holdUntil returns when a node with the given identity and recent refreshes
+// may next refresh, and why, or the zero time if it may refresh now.
+func holdUntil(id message.Identity, times []time.Time, now time.Time) (time.Time, string) {
+	var (
+		until  time.Time
+		reason string
+	)
+
+	hold := func(t time.Time, why string) {
+		if t.After(until) {
+			until, reason = t, why
+		}
+	}
+
+	if q := id.QuietHours; !q.Empty() {
+		w, err := schedule.ParseWindow(nil, q.Start, q.End)
+		loc, locErr := time.LoadLocation(q.Timezone)
+		if err == nil && locErr == nil {
+			if t := now.In(loc); w.Contains(t) {
+				hold(w.Closes(t), "quiet hours")
+			}
+		}
+	}
+
+	if b := id.RefreshBudget; !b.Empty() {
+		for _, lim := range []struct {
+			max    int
+			period time.Duration
+			name   string
+		}{
+			{b.PerHour, time.Hour, "hourly refresh budget"},
+			{b.PerDay, 24 * time.Hour, "daily refresh budget"},
+		} {
+			if lim.max <= 0 {
+				continue
+			}
+
+			// times is oldest first, so the refreshes within the period
+			// are a suffix of it.
+			recent := times
+			for len(recent) > 0 && now.Sub(recent[0]) >= lim.period {
+				recent = recent[1:]
+			}
+
+			if len(recent) >= lim.max {
+				// Wait for enough of them to age out of the period.
+				hold(recent[len(recent)-lim.max].Add(lim.period), lim.name)
+			}
+		}
+	}
+
+	return until, reason
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/trace"
+)
+
+const (
+	// revealLead is the least time allowed between sending a reveal's
+	// commits and the moment the nodes show it.
+	revealLead = 2 * time.Second
+
+	prepareTimeout = 60 * time.Second
+	commitTimeout  = 60 * time.Second
+
+	// defaultSaturation is used for images shown without one.
+	defaultSaturation = 0.5
+)
+
+// revealTarget is an image to show on a node as part of a reveal.
+type revealTarget struct {
+	conn       *connInfo
+	imgData    message.ImageData
+	fit        message.FitPolicy
+	saturation *float64 // Unset for the default.
+
+	// Who asked for the image, recorded once it is shown.
+	by string
+
+	// Set if a schedule or playlist chose the image, rather than anyone
+	// asking for it.
+	scheduled bool
+
+	// Set if the image is a step back or forward to entry from of the
+	// node's history.
+	move message.HistoryMove
+	from int
+
+	// Set for alerts, which the node shows for ttl before going back.
+	ttl      time.Duration
+	priority int
+}
+
+// saturationOrDefault returns the saturation the target's image is rendered
+// with.
+func (t revealTarget) saturationOrDefault() float64 {
+	if t.saturation != nil {
+		return *t.saturation
+	}
+
+	return defaultSaturation
+}
+
+// setImagePayload returns what a node needs to render the target's image.
+func (t revealTarget) setImagePayload() message.SetImagePayload {
+	sat := t.saturationOrDefault()
+
+	return message.SetImagePayload{
+		Name:       t.imgData.Name,
+		Hash:       t.imgData.Hash,
+		Saturation: &sat,
+		FitPolicy:  t.fit,
+	}
+}
+
+// preparedTarget is a target whose node has its image rendered and ready.
+type preparedTarget struct {
+	revealTarget
+
+	index   int           // Of the target in the reveal.
+	offset  time.Duration // How far the node's clock is ahead of ours.
+	rtt     time.Duration
+	traceID string
+}
+
+// reveal shows images on several nodes at the same moment, so that a group
+// of displays changes together rather than as each download finishes.
+//
+// Every node first downloads and renders its image without showing it. Once
+// all have answered, the server picks a time far enough ahead for a commit
+// to reach each of them, and tells each node when that is by its own clock.
+// Nodes that fail to prepare are reported and left out of the reveal, or, if
+// all is set, nothing is revealed at all. Displays held back by an alert or
+// the refresh gate aren't prepared, and are only deferred, as with
+// displayOverConn, once the reveal goes ahead; nothing is recorded for a
+// reveal that doesn't. A single target is simply displayed.
+//
+// It returns what became of each target, in order, along with the errors of
+// those that failed.
+func (s *Server) reveal(parent *message.Command, targets []revealTarget, force, all bool) ([]message.ShowResult, error) {
+	var (
+		mu      = new(sync.Mutex)
+		wg      = new(sync.WaitGroup)
+		errs    []error
+		ready   []preparedTarget
+		results = make([]message.ShowResult, len(targets))
+	)
+
+	for i, t := range targets {
+		results[i] = message.ShowResult{
+			Image:  t.imgData.Name,
+			Node:   t.conn.peerName(),
+			Status: message.ShowDeferred,
+		}
+	}
+
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		results[i].Status = message.ShowFailed
+		results[i].Error = err.Error()
+		errs = append(errs, fmt.Errorf("node %s: %s", results[i].Node, err))
+	}
+
+	if len(targets) == 1 {
+		t := targets[0]
+
+		shown, err := s.showOverConn(parent, t, force)
+		if err != nil {
+			fail(0, err)
+		} else if shown {
+			results[0].Status = message.ShowShown
+		}
+
+		return results, errors.Join(errs...)
+	}
+
+	id := trace.NewID()
+
+	var held []int
+
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t revealTarget) {
+			defer wg.Done()
+
+			hold, err := s.held(t, force)
+			if err != nil {
+				fail(i, err)
+				return
+			}
+
+			if hold {
+				mu.Lock()
+				held = append(held, i)
+				mu.Unlock()
+				return
+			}
+
+			p, err := s.prepareOverConn(parent, id, t)
+			if err != nil {
+				fail(i, err)
+				return
+			}
+
+			p.index = i
+
+			mu.Lock()
+			ready = append(ready, p)
+			mu.Unlock()
+		}(i, t)
+	}
+	wg.Wait()
+
+	if all && len(errs) > 0 {
+		for _, p := range ready {
+			results[p.index].Status = message.ShowFailed
+			results[p.index].Error = "not shown since another node failed to prepare"
+		}
+
+		return results, errors.Join(errs...)
+	}
+
+	// Now that the reveal is going ahead, hold back what is held back. Any
+	// that are no longer held back are shown on their own.
+	for _, i := range held {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			shown, err := s.showOverConn(parent, targets[i], force)
+			if err != nil {
+				fail(i, err)
+				return
+			}
+
+			if shown {
+				mu.Lock()
+				results[i].Status = message.ShowShown
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Count the refreshes about to happen, leaving out any held back since
+	// they were prepared.
+	admitted := ready[:0]
+	for _, p := range ready {
+		if ok, err := s.admit(p.revealTarget, force, p.traceID); err != nil {
+			fail(p.index, err)
+		} else if ok {
+			admitted = append(admitted, p)
+		}
+	}
+	ready = admitted
+
+	if len(ready) == 0 {
+		return results, errors.Join(errs...)
+	}
+
+	// A commit takes about half a round trip to arrive; allow a whole one
+	// for the slowest node.
+	lead := revealLead
+	for _, p := range ready {
+		lead = max(lead, p.rtt)
+	}
+
+	at := time.Now().Add(lead)
+
+	for _, p := range ready {
+		wg.Add(1)
+		go func(p preparedTarget) {
+			defer wg.Done()
+
+			if err := s.commitOverConn(parent, id, p, at); err != nil {
+				fail(p.index, err)
+				return
+			}
+
+			mu.Lock()
+			results[p.index].Status = message.ShowShown
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+// plan reports what reveal would do with targets, without contacting any
+// node or counting refreshes.
+func (s *Server) plan(targets []revealTarget, force bool) []message.ShowResult {
+	results := make([]message.ShowResult, len(targets))
+
+	for i, t := range targets {
+		rot := t.conn.rotation()
+
+		results[i] = message.ShowResult{
+			Image:       t.imgData.Name,
+			Node:        t.conn.peerName(),
+			Status:      message.ShowPlanned,
+			RotationDeg: &rot,
+			FitPolicy:   t.fit,
+		}
+
+		if err := s.modes.checkLocked(t.conn.peerName()); err != nil {
+			results[i].Status = message.ShowFailed
+			results[i].Error = err.Error()
+			continue
+		}
+
+		until, err := s.alerts.check(t)
+		if err != nil {
+			results[i].Status = message.ShowFailed
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if !until.IsZero() {
+			results[i].Status = message.ShowDeferred
+			results[i].Reason = fmt.Sprintf("alert until %s", until.Format(time.RFC3339))
+			continue
+		}
+
+		if force {
+			continue
+		}
+
+		if until, reason := s.refreshes.check(t.conn); !until.IsZero() {
+			results[i].Status = message.ShowDeferred
+			results[i].Reason = fmt.Sprintf("%s until %s", reason, until.Format(time.RFC3339))
+		}
+	}
+
+	return results
+}
+
+// held reports whether the target's display would be held back by an alert
+// or, unless forced, the refresh gate, without holding it back or counting a
+// refresh. It returns an error if the target would be refused.
+func (s *Server) held(t revealTarget, force bool) (bool, error) {
+	if err := s.modes.checkLocked(t.conn.peerName()); err != nil {
+		return false, err
+	}
+
+	until, err := s.alerts.check(t)
+	if err != nil || !until.IsZero() {
+		return err == nil, err
+	}
+
+	if force {
+		return false, nil
+	}
+
+	until, _ = s.refreshes.check(t.conn)
+	return !until.IsZero(), nil
+}
+
+// admit reports whether the target's display may be refreshed now, and
+// counts the refresh if so. Otherwise it is held back to be shown when
+// allowed, or refused with an error.
+func (s *Server) admit(t revealTarget, force bool, traceID string) (bool, error) {
+	if err := s.modes.checkLocked(t.conn.peerName()); err != nil {
+		return false, err
+	}
+
+	if ok, err := s.alerts.admit(t); !ok {
+		return false, err
+	}
+
+	return s.refreshes.admit(t, force, traceID), nil
+}
+
+// prepareOverConn asks a node to get its image ready for reveal id, and
+// estimates the node's clock offset from the exchange.
+func (s *Server) prepareOverConn(parent *message.Command, id string, t revealTarget) (preparedTarget, error) {
+	c := parent.Derive(message.PrepareImageCmd, &message.CommandPayload{
+		PrepareImagePayload: &message.PrepareImagePayload{
+			Reveal: id,
+			Image:  t.setImagePayload(),
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), prepareTimeout)
+	defer cancel()
+
+	resp, err := t.conn.t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return preparedTarget{}, err
+	}
+
+	if !resp.Success {
+		return preparedTarget{}, fmt.Errorf("failed to prepare image: %s", resp.Error)
+	}
+
+	offset, rtt, ok := clockOffset(resp)
+	if !ok {
+		t.conn.logger().Warn("unable to estimate clock offset; assuming none", "reveal", id)
+	}
+
+	t.conn.logger().Debug("prepared image for reveal", "reveal", id, "image", t.imgData.Name, "clockOffset", offset, "rtt", rtt)
+
+	return preparedTarget{
+		revealTarget: t,
+		offset:       offset,
+		rtt:          rtt,
+		traceID:      c.TraceID,
+	}, nil
+}
+
+// commitOverConn tells a node to show its prepared image at the given
+// server time and waits for the display to refresh.
+func (s *Server) commitOverConn(parent *message.Command, id string, p preparedTarget, at time.Time) error {
+	c := parent.Derive(message.CommitImageCmd, &message.CommandPayload{
+		CommitImagePayload: &message.CommitImagePayload{
+			Reveal: id,
+			At:     at.Add(p.offset),
+		},
+	})
+
+	ctx, cancel := context.WithDeadline(context.Background(), at.Add(commitTimeout))
+	defer cancel()
+
+	resp, err := p.conn.t.SendCommandWaitResponse(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("failed to display image: %s", resp.Error)
+	}
+
+	s.displayed(p.revealTarget, p.traceID, time.Since(at))
+
+	return nil
+}
+
+// clockOffset estimates how far the clock of the node answering resp is
+// ahead of the server's, from when the command and response were each sent
+// and received, in the manner of NTP. It also returns the round trip time
+// less the node's handling time. It reports false if a timestamp is missing.
+func clockOffset(resp *message.Response) (time.Duration, time.Duration, bool) {
+	c := resp.Command
+	if c == nil || c.SubmitTime == nil || c.ArriveTime == nil || resp.SubmitTime == nil || resp.ArriveTime == nil {
+		return 0, 0, false
+	}
+
+	sent, arrived := *c.SubmitTime, *c.ArriveTime
+	answered, returned := *resp.SubmitTime, *resp.ArriveTime
+
+	offset := (arrived.Sub(sent) + answered.Sub(returned)) / 2
+	rtt := returned.Sub(sent) - answered.Sub(arrived)
+
+	return offset, rtt, true
+}
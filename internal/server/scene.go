@@ -0,0 +1,287 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	scenesFile = "scenes.json"
+)
+
+// sceneStore holds saved scenes, persisted to the state dir.
+type sceneStore struct {
+	dir string
+
+	mu     *sync.Mutex
+	scenes map[string]*message.Scene
+}
+
+func newSceneStore(stateDir string) (*sceneStore, error) {
+	ss := &sceneStore{
+		dir:    stateDir,
+		mu:     new(sync.Mutex),
+		scenes: make(map[string]*message.Scene),
+	}
+
+	if err := loadState(stateDir, scenesFile, &ss.scenes); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+func (ss *sceneStore) set(sc message.Scene) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.scenes[sc.Name] = &sc
+
+	return saveState(ss.dir, scenesFile, ss.scenes)
+}
+
+func (ss *sceneStore) delete(name string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.scenes[name]; !ok {
+		return fmt.Errorf("no scene named %s", name)
+	}
+
+	delete(ss.scenes, name)
+
+	return saveState(ss.dir, scenesFile, ss.scenes)
+}
+
+func (ss *sceneStore) get(name string) (message.Scene, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sc, ok := ss.scenes[name]
+	if !ok {
+		return message.Scene{}, false
+	}
+
+	return *sc, true
+}
+
+func (ss *sceneStore) list() []message.Scene {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var ret []message.Scene
+	for _, sc := range ss.scenes {
+		ret = append(ret, *sc)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+
+	return ret
+}
+
+// connsByNameLocked returns the node conns sorted by name. The caller holds
+// connMu.
+func (s *Server) connsByNameLocked() []*connInfo {
+	ret := make([]*connInfo, 0, len(s.conns))
+	for _, conn := range s.conns {
+		ret = append(ret, conn)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].peerName() < ret[j].peerName() })
+
+	return ret
+}
+
+func (s *Server) handleSceneSet(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.SceneSetPayload == nil {
+		return errors.New("invalid scene set payload")
+	}
+
+	return s.scenes.set(p.SceneSetPayload.Scene)
+}
+
+// handleSceneSave saves what the targeted nodes are showing as a scene, an
+// image for each node.
+func (s *Server) handleSceneSave(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.SceneSavePayload == nil {
+		return errors.New("invalid scene save payload")
+	}
+
+	savePayload := p.SceneSavePayload
+
+	s.connMu.RLock()
+	conns := s.connsByNameLocked()
+	s.connMu.RUnlock()
+
+	sc := message.Scene{
+		Name: savePayload.Name,
+	}
+
+	for _, conn := range conns {
+		if !savePayload.Target.Empty() && !connTargeted(conn, savePayload.Target) {
+			continue
+		}
+
+		conn.mu.Lock()
+		var showing *message.ShownImage
+		if conn.nodeStatus != nil && conn.nodeStatus.Showing != nil {
+			shown := *conn.nodeStatus.Showing
+			showing = &shown
+		}
+		conn.mu.Unlock()
+
+		if showing == nil {
+			continue
+		}
+
+		sc.Images = append(sc.Images, message.SceneImage{
+			Target:     message.NodeTarget{Nodes: []string{conn.peerName()}},
+			Image:      showing.Name,
+			FitPolicy:  showing.FitPolicy,
+			Saturation: &showing.Saturation,
+		})
+	}
+
+	if len(sc.Images) == 0 {
+		return errors.New("no targeted node is showing an image")
+	}
+
+	return s.scenes.set(sc)
+}
+
+// handleSceneApply reveals a scene on its nodes together, on behalf of by.
+// Nothing is shown unless every image exists, every node named is connected
+// and ready, and every node prepares its image.
+func (s *Server) handleSceneApply(cmd *message.Command, by string) (*message.ResponsePayload, error) {
+	p := cmd.Payload
+
+	if p == nil || p.SceneApplyPayload == nil {
+		return nil, errors.New("invalid scene apply payload")
+	}
+
+	applyPayload := p.SceneApplyPayload
+
+	sc, ok := s.scenes.get(applyPayload.Name)
+	if !ok {
+		return nil, fmt.Errorf("no scene named %s", applyPayload.Name)
+	}
+
+	targets, err := s.sceneTargets(sc, by)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.reveal(cmd, targets, applyPayload.Force, true)
+
+	return showResponse(results), err
+}
+
+// sceneTargets returns what each connected node is shown, on behalf of by,
+// when the scene is applied. connMu is only held while they are found, not
+// for the reveal.
+func (s *Server) sceneTargets(sc message.Scene, by string) ([]revealTarget, error) {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	conns := s.connsByNameLocked()
+
+	var (
+		errs    []error
+		targets []revealTarget
+		byNode  = make(map[*connInfo]int) // Index into targets.
+	)
+
+	for _, si := range sc.Images {
+		imgData := message.ImageData{Name: si.Image}
+		if err := s.resolveImage(&imgData); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// Only the hash is sent on to nodes.
+		imgData.Data = nil
+
+		for _, name := range si.Target.Nodes {
+			if s.nodeConnLocked(name) == nil {
+				errs = append(errs, fmt.Errorf("node %s is not connected", name))
+			}
+		}
+
+		for _, conn := range conns {
+			if !connTargeted(conn, si.Target) {
+				continue
+			}
+
+			// Only nodes named in the scene are shown it while cordoned,
+			// and locked nodes not at all.
+			named := slices.Contains(si.Target.Nodes, conn.peerName())
+			if !named && s.modes.excluded(conn) {
+				continue
+			}
+
+			if err := s.modes.checkLocked(conn.peerName()); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if !conn.displayReady() {
+				errs = append(errs, fmt.Errorf("node %s is not ready to display", conn.peerName()))
+				continue
+			}
+
+			t := revealTarget{
+				conn:       conn,
+				imgData:    imgData,
+				fit:        si.FitPolicy,
+				saturation: si.Saturation,
+				by:         fmt.Sprintf("%s with scene %s", by, sc.Name),
+			}
+
+			// Later images override earlier ones.
+			if i, ok := byNode[conn]; ok {
+				targets[i] = t
+				continue
+			}
+
+			byNode[conn] = len(targets)
+			targets = append(targets, t)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("not applying scene %s: %s", sc.Name, errors.Join(errs...))
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("scene %s targets no connected nodes", sc.Name)
+	}
+
+	return targets, nil
+}
+
+func (s *Server) handleSceneDelete(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.SceneDeletePayload == nil {
+		return errors.New("invalid scene delete payload")
+	}
+
+	return s.scenes.delete(p.SceneDeletePayload.Name)
+}
+
+func (s *Server) handleListScenes(cmd *message.Command) (*message.ResponsePayload, error) {
+	return &message.ResponsePayload{
+		ListScenesResponse: &message.ListScenesResponsePayload{
+			Scenes: s.scenes.list(),
+		},
+	}, nil
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/schedule"
+)
+
+// sortedSchedules returns schedules in the order they are tried: highest
+// priority first, then by name. mu must be held.
+func (sch *scheduler) sortedSchedules() []*message.Schedule {
+	ret := make([]*message.Schedule, 0, len(sch.schedules))
+	for _, sc := range sch.schedules {
+		ret = append(ret, sc)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Priority != ret[j].Priority {
+			return ret[i].Priority > ret[j].Priority
+		}
+
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// activeRule returns the index of the first rule of sc active at t, or -1 if
+// none are.
+func activeRule(sc *message.Schedule, t time.Time) int {
+	loc, err := time.LoadLocation(sc.Timezone)
+	if err != nil {
+		return -1
+	}
+
+	t = t.In(loc)
+
+	for i, r := range sc.Rules {
+		if ruleActive(r, t) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ruleActive reports whether r applies at t. A rule with both a cron
+// expression and a window must match both.
+func ruleActive(r message.ScheduleRule, t time.Time) bool {
+	if r.Cron != "" {
+		c, err := schedule.ParseCron(r.Cron)
+		if err != nil || !c.Matches(t) {
+			return false
+		}
+	}
+
+	if w := r.Window; w != nil {
+		win, err := schedule.ParseWindow(w.Days, w.Start, w.End)
+		if err != nil || !win.Contains(t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (sch *scheduler) set(sc message.Schedule) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	for i, r := range sc.Rules {
+		if r.Playlist != "" {
+			if _, ok := sch.playlists[r.Playlist]; !ok {
+				return fmt.Errorf("rule %d: no playlist named %s", i, r.Playlist)
+			}
+		}
+
+		if r.Image != "" {
+			if _, err := os.Stat(sch.s.imgFilePath(r.Image)); err != nil {
+				return fmt.Errorf("rule %d: image %s is not stored on the server", i, r.Image)
+			}
+		}
+
+		if r.Blank {
+			if err := sch.storeBlank(); err != nil {
+				return fmt.Errorf("storing blank image: %s", err)
+			}
+		}
+	}
+
+	sch.schedules[sc.Name] = &sc
+
+	defer sch.poke()
+	return saveState(sch.dir, schedulesFile, sch.schedules)
+}
+
+func (sch *scheduler) delete(name string) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	if _, ok := sch.schedules[name]; !ok {
+		return fmt.Errorf("no schedule named %s", name)
+	}
+
+	delete(sch.schedules, name)
+
+	defer sch.poke()
+	return saveState(sch.dir, schedulesFile, sch.schedules)
+}
+
+func (sch *scheduler) listSchedules() []message.Schedule {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	var ret []message.Schedule
+	for _, sc := range sch.sortedSchedules() {
+		ret = append(ret, *sc)
+	}
+
+	return ret
+}
+
+// preview resolves what the named node would be scheduled to show at t.
+func (sch *scheduler) preview(node string, t time.Time) (*message.ScheduleResolution, error) {
+	for _, conn := range sch.s.registeredConns() {
+		if conn.peerName() != node {
+			continue
+		}
+
+		sch.mu.Lock()
+		defer sch.mu.Unlock()
+
+		res, _ := sch.resolve(conn, t)
+		return &res, nil
+	}
+
+	return nil, fmt.Errorf("no node named %s is connected", node)
+}
+
+func (s *Server) handleScheduleSet(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.ScheduleSetPayload == nil {
+		return errors.New("invalid schedule set payload")
+	}
+
+	return s.scheduler.set(p.ScheduleSetPayload.Schedule)
+}
+
+func (s *Server) handleScheduleDelete(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.ScheduleDeletePayload == nil {
+		return errors.New("invalid schedule delete payload")
+	}
+
+	return s.scheduler.delete(p.ScheduleDeletePayload.Name)
+}
+
+func (s *Server) handleListSchedules(cmd *message.Command) (*message.ResponsePayload, error) {
+	return &message.ResponsePayload{
+		ListSchedulesResponse: &message.ListSchedulesResponsePayload{
+			Schedules: s.scheduler.listSchedules(),
+		},
+	}, nil
+}
+
+func (s *Server) handleSchedulePreview(cmd *message.Command) (*message.ResponsePayload, error) {
+	p := cmd.Payload
+
+	if p == nil || p.SchedulePreviewPayload == nil {
+		return nil, errors.New("invalid schedule preview payload")
+	}
+
+	t := p.SchedulePreviewPayload.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	res, err := s.scheduler.preview(p.SchedulePreviewPayload.Node, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message.ResponsePayload{
+		SchedulePreviewResponse: res,
+	}, nil
+}
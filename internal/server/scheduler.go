@@ -0,0 +1,328 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/imaging"
+	"github.com/redgoat650/barnacle-net/internal/logging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	playlistsFile = "playlists.json"
+	schedulesFile = "schedules.json"
+
+	// blankImageName is stored on the server for schedules that blank nodes.
+	blankImageName = "barnacle-blank.png"
+)
+
+// scheduler cycles playlists and evaluates schedules, keeping each node
+// showing whatever currently applies to it.
+type scheduler struct {
+	s   *Server
+	dir string
+
+	mu        *sync.Mutex
+	playlists map[string]*playlistState
+	schedules map[string]*message.Schedule
+
+	// applied records what was last sent to each node, so a node is only
+	// updated when what applies to it changes and images shown by hand stay
+	// up until then.
+	applied map[string]string
+
+	wake chan struct{}
+}
+
+func newScheduler(s *Server, stateDir string) (*scheduler, error) {
+	sch := &scheduler{
+		s:         s,
+		dir:       stateDir,
+		mu:        new(sync.Mutex),
+		playlists: make(map[string]*playlistState),
+		schedules: make(map[string]*message.Schedule),
+		applied:   make(map[string]string),
+		wake:      make(chan struct{}, 1),
+	}
+
+	if err := loadState(stateDir, playlistsFile, &sch.playlists); err != nil {
+		return nil, err
+	}
+
+	if err := loadState(stateDir, schedulesFile, &sch.schedules); err != nil {
+		return nil, err
+	}
+
+	slog.Info("loaded scheduler state", "playlists", len(sch.playlists), "schedules", len(sch.schedules), "dir", stateDir)
+
+	return sch, nil
+}
+
+// poke wakes the scheduler to re-evaluate what every node should show.
+func (sch *scheduler) poke() {
+	select {
+	case sch.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sch *scheduler) run() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-sch.wake:
+		case <-sch.s.ctx.Done():
+			return
+		}
+
+		now := time.Now()
+		sch.advanceDue(now)
+		sch.reconcile(now)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(sch.untilNext(time.Now()))
+	}
+}
+
+// nodeRegistered brings a newly registered node up to date with whatever is
+// scheduled for it.
+func (sch *scheduler) nodeRegistered(name string) {
+	sch.mu.Lock()
+	delete(sch.applied, name)
+	sch.mu.Unlock()
+
+	sch.poke()
+}
+
+// untilNext returns how long until a playlist is due or, while there are
+// schedules, the next minute starts.
+func (sch *scheduler) untilNext(now time.Time) time.Duration {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	// Nothing to do until something changes.
+	next := time.Hour
+
+	if len(sch.schedules) > 0 {
+		next = now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+	}
+
+	referenced := sch.referencedPlaylists()
+	for _, ps := range sch.playlists {
+		if !ps.cycling(referenced) {
+			continue
+		}
+
+		if d := ps.NextTime.Sub(now); d < next {
+			next = d
+		}
+	}
+
+	return max(next, time.Nanosecond)
+}
+
+// reconcile updates every node whose scheduled content has changed since it
+// was last updated.
+func (sch *scheduler) reconcile(now time.Time) {
+	for _, conn := range sch.s.registeredConns() {
+		if !conn.displayReady() || sch.s.modes.excluded(conn) {
+			continue
+		}
+
+		name := conn.peerName()
+
+		sch.mu.Lock()
+		res, fit := sch.resolve(conn, now)
+
+		image := res.Image
+		if res.Blank {
+			image = blankImageName
+		}
+
+		key := image + "|" + string(fit)
+		if image == "" || sch.applied[name] == key {
+			sch.mu.Unlock()
+			continue
+		}
+
+		sch.applied[name] = key
+		sch.mu.Unlock()
+
+		go func(conn *connInfo) {
+			if err := sch.show(conn, image, fit, resolutionSource(res)); err != nil {
+				conn.logger().Warn("showing scheduled image", "image", image, "schedule", res.Schedule, "playlist", res.Playlist, logging.Err(err))
+
+				// Try again the next time the scheduler wakes.
+				sch.mu.Lock()
+				if sch.applied[name] == key {
+					delete(sch.applied, name)
+				}
+				sch.mu.Unlock()
+			}
+		}(conn)
+	}
+}
+
+// resolve returns what conn should show at t: the first active rule of the
+// highest priority schedule targeting it, otherwise the first playlist
+// assigned to it. mu must be held.
+func (sch *scheduler) resolve(conn *connInfo, t time.Time) (message.ScheduleResolution, message.FitPolicy) {
+	res := message.ScheduleResolution{
+		Node: conn.peerName(),
+		Time: t,
+	}
+
+	for _, sc := range sch.sortedSchedules() {
+		if !connTargeted(conn, sc.Target) {
+			continue
+		}
+
+		i := activeRule(sc, t)
+		if i < 0 {
+			continue
+		}
+
+		r := sc.Rules[i]
+		res.Schedule, res.Rule = sc.Name, &r
+		res.Playlist, res.Image, res.Blank = r.Playlist, r.Image, r.Blank
+
+		fit := r.FitPolicy
+		if ps, ok := sch.playlists[r.Playlist]; ok {
+			res.Image, fit = ps.Current, ps.Playlist.FitPolicy
+		}
+
+		return res, fit
+	}
+
+	names := make([]string, 0, len(sch.playlists))
+	for name := range sch.playlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ps := sch.playlists[name]
+		if ps.Playlist.Target.Empty() || !connTargeted(conn, ps.Playlist.Target) {
+			continue
+		}
+
+		res.Playlist, res.Image = name, ps.Current
+
+		return res, ps.Playlist.FitPolicy
+	}
+
+	return res, ""
+}
+
+// resolutionSource names the schedule or playlist that chose a node's image.
+func resolutionSource(res message.ScheduleResolution) string {
+	if res.Schedule != "" {
+		return "schedule " + res.Schedule
+	}
+
+	return "playlist " + res.Playlist
+}
+
+// show displays a stored image on conn, on behalf of by, unless it is
+// already showing it.
+func (sch *scheduler) show(conn *connInfo, image string, fit message.FitPolicy, by string) error {
+	imgData := message.ImageData{Name: image}
+	if err := sch.s.resolveImage(&imgData); err != nil {
+		return err
+	}
+
+	if conn.showingHash() == imgData.Hash {
+		return nil
+	}
+
+	return sch.s.displayOverConn(nil, imgData, conn, fit, false, by)
+}
+
+// storeBlank saves the image shown on blanked nodes if it isn't stored yet.
+func (sch *scheduler) storeBlank() error {
+	path := sch.s.imgFilePath(blankImageName)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	b, err := imaging.Blank()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0644)
+}
+
+// registeredConns returns every node that has registered with the server.
+func (s *Server) registeredConns() []*connInfo {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	var ret []*connInfo
+	for _, conn := range s.conns {
+		conn.mu.Lock()
+		registered := conn.nodeStatus != nil
+		conn.mu.Unlock()
+
+		if registered {
+			ret = append(ret, conn)
+		}
+	}
+
+	return ret
+}
+
+// connTargeted reports whether t targets conn.
+func connTargeted(conn *connInfo, t message.NodeTarget) bool {
+	name, _ := conn.name.Load().(string)
+	for _, n := range t.Nodes {
+		if n == name {
+			return true
+		}
+	}
+
+	if len(t.Selectors) == 0 && t.Selector == "" {
+		return false
+	}
+
+	sel, err := compileSelectors(t.Selectors, t.Selector)
+	if err != nil {
+		conn.logger().Warn("ignoring invalid target selector", logging.Err(err))
+		return false
+	}
+
+	return connMatchesSelector(conn, sel)
+}
+
+// displayReady reports whether the node has a responding display.
+func (c *connInfo) displayReady() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ns := c.nodeStatus
+	return ns != nil && ns.Identity.Display != nil && ns.Identity.Display.DisplayResponding
+}
+
+// showingHash returns the hash of the image the node is showing, if known.
+func (c *connInfo) showingHash() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.nodeStatus == nil || c.nodeStatus.Showing == nil {
+		return ""
+	}
+
+	return c.nodeStatus.Showing.Hash
+}
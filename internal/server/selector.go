@@ -0,0 +1,109 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/selector"
+)
+
+// compileSelectors builds the selector tree for a selector list and a
+// selector expression, either of which may be empty. Nodes must match both.
+func compileSelectors(nodeSelectors []message.NodeSelector, expr string) (selector.Expr, error) {
+	ret := selector.And{}
+
+	if len(nodeSelectors) > 0 {
+		ret = append(ret, selectorListExpr(nodeSelectors))
+	}
+
+	if expr != "" {
+		e, err := selector.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, e)
+	}
+
+	if len(ret) == 1 {
+		return ret[0], nil
+	}
+
+	// An empty And matches every node.
+	return ret, nil
+}
+
+// selectorListExpr folds a selector list left to right into a tree,
+// starting from the match of its first step.
+func selectorListExpr(nodeSelectors []message.NodeSelector) selector.Expr {
+	ret := selectorStepExpr(nodeSelectors[0])
+
+	for _, sel := range nodeSelectors[1:] {
+		e := selectorStepExpr(sel)
+
+		switch sel.Logic {
+		case message.LogicOr:
+			ret = selector.Or{ret, e}
+		default:
+			ret = selector.And{ret, e}
+		}
+	}
+
+	return ret
+}
+
+func selectorStepExpr(sel message.NodeSelector) selector.Expr {
+	switch sel.Key {
+	case message.MatchAnySelKey:
+		return selector.Const(true)
+	case message.NameSelKey, message.NameEqualsSelKey:
+		return selector.Compare{Field: selector.NameField, Op: selector.Equals, Value: sel.Value}
+	case message.NameContainsSelKey:
+		return selector.Compare{Field: selector.NameField, Op: selector.Contains, Value: sel.Value}
+	case message.HasLabelSelKey:
+		if k, v, ok := strings.Cut(sel.Value, "="); ok {
+			return selector.Compare{Field: selector.LabelKeyPrefix + k, Op: selector.Equals, Value: v}
+		}
+		return selector.Compare{Field: selector.LabelField, Op: selector.Equals, Value: sel.Value}
+	}
+
+	return selector.Const(false)
+}
+
+func connMatchesSelector(conn *connInfo, sel selector.Expr) bool {
+	conn.mu.Lock()
+	var id message.Identity
+	if conn.nodeStatus != nil {
+		id = conn.nodeStatus.Identity
+	}
+	conn.mu.Unlock()
+
+	return sel.Match(identityNode(id))
+}
+
+// identityNode matches selectors against a node's identity.
+type identityNode message.Identity
+
+func (n identityNode) Values(field string) []string {
+	switch field {
+	case selector.NameField:
+		return []string{n.Name}
+	case selector.LabelField:
+		return n.Labels.Keys()
+	case selector.OrientationField:
+		o := "landscape"
+		if isPortrait(message.Identity(n)) {
+			o = "portrait"
+		}
+
+		return []string{o, string(n.Orientation)}
+	}
+
+	if key, ok := strings.CutPrefix(field, selector.LabelKeyPrefix); ok {
+		if v, ok := n.Labels[key]; ok {
+			return []string{v}
+		}
+	}
+
+	return nil
+}
@@ -1,26 +1,29 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"image"
-	_ "image/jpeg"
-	_ "image/png"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/redgoat650/barnacle-net/internal/assign"
+	"github.com/redgoat650/barnacle-net/internal/chaos"
 	"github.com/redgoat650/barnacle-net/internal/config"
 	"github.com/redgoat650/barnacle-net/internal/hash"
+	"github.com/redgoat650/barnacle-net/internal/imaging"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/selector"
+	"github.com/redgoat650/barnacle-net/internal/trace"
 	"github.com/redgoat650/barnacle-net/internal/transport"
 	"github.com/spf13/viper"
 )
@@ -28,21 +31,57 @@ import (
 const (
 	defaultTimeout = 10 * time.Second
 	imgCacheDir    = "barnacle-images"
+
+	// uploadTransfer labels image bytes stored without being shown.
+	uploadTransfer = "upload"
 )
 
 type Server struct {
-	conns  map[string]*connInfo
-	connMu *sync.RWMutex
-	ctx    context.Context
-	cancel context.CancelFunc
-	imgDir string
+	conns   map[string]*connInfo // Nodes, keyed by remote address.
+	clients map[string]*connInfo // CLI clients, keyed by remote address.
+	connMu  *sync.RWMutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	imgDir  string
+
+	transportOpts transport.Options
+	imgLimits     imaging.Limits
+	tracer        *trace.FileRecorder
+	metrics       *serverMetrics
+	events        *eventBus
+	scheduler     *scheduler
+	refreshes     *refreshGate
+	walls         *wallStore
+	scenes        *sceneStore
+	displays      *displayStore
+	history       *historyStore
+	alerts        *alertGate
+	modes         *modeStore
+
+	// Assigners that remember past requests.
+	roundRobin *assign.RoundRobin
+	sticky     *assign.Sticky
+
+	// Faults to inject into every websocket conn; debugging only.
+	chaosPlan *chaos.Plan
 }
 
 type connInfo struct {
-	remoteAddr string
-	t          *transport.Transport
-	nodeStatus *message.NodeStatus
-	mu         *sync.Mutex
+	remoteAddr  string
+	role        message.Role
+	connectTime time.Time
+	t           *transport.Transport
+	nodeStatus  *message.NodeStatus
+	mu          *sync.Mutex
+
+	// Node name once registered; readable without holding mu.
+	name atomic.Value
+
+	// Closed once the conn is shut down.
+	done chan struct{}
+
+	// Ends the conn's event subscription, if it is watching events.
+	unwatch func()
 }
 
 func RunServer(v *viper.Viper) error {
@@ -50,9 +89,99 @@ func RunServer(v *viper.Viper) error {
 	addr := ":" + port
 
 	s := NewServer()
-	setupRoutes(s)
+	s.transportOpts = config.TransportOptions(v)
+	s.imgLimits = config.ImageLimits(v)
+
+	if tracePath := v.GetString(config.TraceFileCfgPath); tracePath != "" {
+		tracer, err := trace.NewFileRecorder(tracePath)
+		if err != nil {
+			return err
+		}
+		defer tracer.Close()
+
+		slog.Info("recording traces", "path", tracePath)
+		s.tracer = tracer
+	}
+
+	if planPath := v.GetString(config.ChaosPlanCfgPath); planPath != "" {
+		plan, err := chaos.LoadPlan(planPath)
+		if err != nil {
+			return err
+		}
+
+		slog.Warn("injecting faults from chaos plan", "plan", planPath)
+		s.chaosPlan = plan
+	}
+
+	stateDir := v.GetString(config.ServerStateDirCfgPath)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("creating state dir: %s", err)
+	}
+
+	sch, err := newScheduler(s, stateDir)
+	if err != nil {
+		return err
+	}
+
+	walls, err := newWallStore(stateDir)
+	if err != nil {
+		return err
+	}
+	s.walls = walls
+
+	scenes, err := newSceneStore(stateDir)
+	if err != nil {
+		return err
+	}
+	s.scenes = scenes
+
+	displays, err := newDisplayStore(stateDir)
+	if err != nil {
+		return err
+	}
+	s.displays = displays
+
+	history, err := newHistoryStore(stateDir)
+	if err != nil {
+		return err
+	}
+	s.history = history
+
+	alerts, err := newAlertGate(s, stateDir)
+	if err != nil {
+		return err
+	}
+	s.alerts = alerts
+
+	refreshes, err := newRefreshGate(s, stateDir)
+	if err != nil {
+		return err
+	}
+	s.refreshes = refreshes
+
+	modes, err := newModeStore(stateDir)
+	if err != nil {
+		return err
+	}
+	s.modes = modes
+
+	for node, shown := range displays.all() {
+		s.sticky.Shown(assign.Image{Name: shown.Name, Hash: shown.Hash}, node)
+	}
+
+	s.scheduler = sch
+	go s.scheduler.run()
 
-	log.Println("Serving at", addr)
+	setupRoutes(s, v.GetString(config.ConnectWebsocketPathCfgPath))
+
+	if grpcPort := v.GetString(config.DeployServerGRPCPortConfigKey); grpcPort != "" {
+		go func() {
+			err := s.serveGRPC(":" + grpcPort)
+			slog.Error("gRPC server stopped", logging.Err(err))
+		}()
+	}
+
+	slog.Info("serving", "addr", addr)
 
 	return http.ListenAndServe(addr, nil)
 }
@@ -67,72 +196,149 @@ func NewServer() *Server {
 		panic(err)
 	}
 
-	return &Server{
-		conns:  make(map[string]*connInfo),
-		connMu: new(sync.RWMutex),
-		ctx:    ctx,
-		cancel: cancel,
-		imgDir: imageDir,
+	s := &Server{
+		conns:   make(map[string]*connInfo),
+		clients: make(map[string]*connInfo),
+		connMu:  new(sync.RWMutex),
+		ctx:     ctx,
+		cancel:  cancel,
+		imgDir:  imageDir,
+		events:  newEventBus(),
+
+		roundRobin: assign.NewRoundRobin(),
+		sticky:     assign.NewSticky(),
 	}
+	s.metrics = newServerMetrics(s)
+
+	return s
 }
 
 func (s *Server) Shutdown() {
 	s.cancel()
 }
 
-func homePage(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "...placeholder")
-}
-
-func makeWSHandler(s *Server) func(w http.ResponseWriter, r *http.Request) {
+// makeWSHandler returns the websocket endpoint for conns of the given role.
+// Nodes and clients are kept in separate registries so that commands meant
+// for nodes are never routed to a client.
+func makeWSHandler(s *Server, role message.Role) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		upgrader.CheckOrigin = func(r *http.Request) bool { return true }
 
 		// Upgrade to a WebSocket connection.
 		ws, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Println(err)
+			slog.Warn("websocket upgrade failed", slog.String(logging.RemoteKey, r.RemoteAddr), logging.Err(err))
 			return
 		}
 
 		// Connection received; log connection event.
 		remoteAddr := ws.RemoteAddr().String()
-		log.Println("client Connected", remoteAddr)
+		slog.Info("connected", slog.String(logging.RoleKey, string(role)), slog.String(logging.RemoteKey, remoteAddr))
 
-		t := transport.NewTransportForConn(ws)
+		var conn transport.Conn = ws
+		if s.chaosPlan != nil {
+			conn = chaos.Wrap(ws, s.chaosPlan)
+		}
+
+		registry := s.conns
+		if role == message.ClientRole {
+			registry = s.clients
+		}
 
-		s.connMu.Lock()
 		c := &connInfo{
-			remoteAddr: remoteAddr,
-			t:          t,
-			mu:         new(sync.Mutex),
+			remoteAddr:  remoteAddr,
+			role:        role,
+			connectTime: time.Now(),
+			mu:          new(sync.Mutex),
+			done:        make(chan struct{}),
 		}
-		s.conns[remoteAddr] = c
+
+		opts := s.transportOpts
+		opts.Logger = c.logger()
+		opts.Recorder = trace.RecorderFunc(func(sp message.Span) {
+			s.metrics.observeSpan(sp)
+
+			if s.tracer != nil {
+				sp.Peer = c.peerName()
+				s.tracer.Record(sp)
+			}
+		})
+
+		c.t = transport.NewTransportForConn(conn, opts)
+
+		s.connMu.Lock()
+		registry[remoteAddr] = c
 		s.connMu.Unlock()
 
+		s.events.publish(message.Event{
+			Type:       message.ConnectedEvent,
+			Role:       role,
+			RemoteAddr: remoteAddr,
+		})
+
 		defer func() {
-			log.Println("shutting down client connection:", remoteAddr)
+			c.logger().Info("shutting down connection")
+			close(c.done)
+
 			s.connMu.Lock()
-			delete(s.conns, remoteAddr)
+			delete(registry, remoteAddr)
 			s.connMu.Unlock()
+
+			name, _ := c.name.Load().(string)
+			s.events.publish(message.Event{
+				Type:       message.DisconnectedEvent,
+				Role:       role,
+				RemoteAddr: remoteAddr,
+				Node:       name,
+			})
 		}()
 
 		s.handleIncomingCommands(c)
 	}
 }
 
+func (c *connInfo) logger() *slog.Logger {
+	l := slog.With(slog.String(logging.RoleKey, string(c.role)), slog.String(logging.RemoteKey, c.remoteAddr))
+	if name, ok := c.name.Load().(string); ok && name != "" {
+		l = l.With(slog.String(logging.NodeKey, name))
+	}
+
+	return l
+}
+
+// peerName identifies the conn by node name once registered.
+func (c *connInfo) peerName() string {
+	if name, ok := c.name.Load().(string); ok && name != "" {
+		return name
+	}
+
+	return string(c.role) + " " + c.remoteAddr
+}
+
+// rotation returns how far the node's display is rotated as hung.
+func (c *connInfo) rotation() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.nodeStatus == nil {
+		return 0
+	}
+
+	return c.nodeStatus.Identity.Orientation.Rotation()
+}
+
 func (s *Server) handleIncomingCommands(c *connInfo) {
 	for {
 		select {
 		case cmd := <-c.t.IncomingCmds():
 			err := s.handleIncomingCommand(cmd, c)
 			if err != nil {
-				log.Println("error handling command:", err)
+				c.logger().Warn("error handling command", logging.Err(err))
 				return
 			}
 
 		case <-s.ctx.Done():
-			log.Println("context canceled:", s.ctx.Err())
+			c.logger().Info("context canceled", logging.Err(s.ctx.Err()))
 			return
 		}
 	}
@@ -148,27 +354,99 @@ func (s *Server) handleIncomingCommand(cmd *message.Command, c *connInfo) error
 		err error
 	)
 
+	if !opAllowed(c.role, cmd.Op) {
+		logging.WithCommand(c.logger(), cmd).Warn("rejecting command not permitted on endpoint")
+		return c.t.SendResponse(nil, fmt.Errorf("%s is not permitted on the %s endpoint", cmd.Op, c.role), cmd)
+	}
+
 	switch cmd.Op {
 	case message.ListNodesCmd:
 		rp, err = s.handleListNodes(cmd)
+	case message.NodeStatusCmd:
+		rp, err = s.handleNodeStatus(cmd)
+	case message.NodeModeCmd:
+		err = s.handleNodeMode(cmd)
 	case message.RegisterCmd:
 		rp, err = s.handleRegister(cmd, c)
 	case message.ShowImagesCmd:
-		err = s.handleShowImages(cmd, c)
+		rp, err = s.handleShowImages(cmd, c.peerName())
 	case message.GetImageCmd:
 		rp, err = s.handleGetImage(cmd)
 	case message.ListFilesCmd:
 		rp, err = s.handleListFiles(cmd)
 	case message.ConfigSetCmd:
 		err = s.handleConfigSet(cmd)
+	case message.GetTraceCmd:
+		rp, err = s.handleGetTrace(cmd)
+	case message.WatchEventsCmd:
+		err = s.handleWatchEvents(cmd, c)
+	case message.PlaylistCreateCmd:
+		err = s.handlePlaylistCreate(cmd)
+	case message.PlaylistAssignCmd:
+		err = s.handlePlaylistAssign(cmd)
+	case message.PlaylistPauseCmd:
+		err = s.handlePlaylistPause(cmd)
+	case message.PlaylistNextCmd:
+		err = s.handlePlaylistNext(cmd)
+	case message.ListPlaylistsCmd:
+		rp, err = s.handleListPlaylists(cmd)
+	case message.ScheduleSetCmd:
+		err = s.handleScheduleSet(cmd)
+	case message.ScheduleDeleteCmd:
+		err = s.handleScheduleDelete(cmd)
+	case message.ListSchedulesCmd:
+		rp, err = s.handleListSchedules(cmd)
+	case message.SchedulePreviewCmd:
+		rp, err = s.handleSchedulePreview(cmd)
+	case message.WallSetCmd:
+		err = s.handleWallSet(cmd)
+	case message.WallDeleteCmd:
+		err = s.handleWallDelete(cmd)
+	case message.ListWallsCmd:
+		rp, err = s.handleListWalls(cmd)
+	case message.SceneSetCmd:
+		err = s.handleSceneSet(cmd)
+	case message.SceneSaveCmd:
+		err = s.handleSceneSave(cmd)
+	case message.SceneApplyCmd:
+		rp, err = s.handleSceneApply(cmd, c.peerName())
+	case message.HistoryCmd:
+		rp, err = s.handleHistory(cmd)
+	case message.HistoryBackCmd:
+		rp, err = s.handleHistoryMove(cmd, c.peerName(), message.HistoryBack)
+	case message.HistoryForwardCmd:
+		rp, err = s.handleHistoryMove(cmd, c.peerName(), message.HistoryForward)
+	case message.SceneDeleteCmd:
+		err = s.handleSceneDelete(cmd)
+	case message.ListScenesCmd:
+		rp, err = s.handleListScenes(cmd)
 	default:
 		err = fmt.Errorf("unrecognized command: %s", cmd.Op)
 	}
 
-	log.Println("handling command", cmd.Op, err)
+	logging.WithCommand(c.logger(), cmd).Debug("handled command", logging.Err(err))
 	return c.t.SendResponse(rp, err, cmd)
 }
 
+// opAllowed reports whether a conn of the given role may send op to the server.
+func opAllowed(role message.Role, op message.Op) bool {
+	switch op {
+	case message.GetImageCmd:
+		return true
+	case message.RegisterCmd:
+		return role == message.NodeRole
+	case message.ListNodesCmd, message.NodeStatusCmd, message.NodeModeCmd, message.ShowImagesCmd, message.ListFilesCmd, message.ConfigSetCmd, message.GetTraceCmd, message.WatchEventsCmd,
+		message.PlaylistCreateCmd, message.PlaylistAssignCmd, message.PlaylistPauseCmd, message.PlaylistNextCmd, message.ListPlaylistsCmd,
+		message.ScheduleSetCmd, message.ScheduleDeleteCmd, message.ListSchedulesCmd, message.SchedulePreviewCmd,
+		message.WallSetCmd, message.WallDeleteCmd, message.ListWallsCmd,
+		message.SceneSetCmd, message.SceneSaveCmd, message.SceneApplyCmd, message.SceneDeleteCmd, message.ListScenesCmd,
+		message.HistoryCmd, message.HistoryBackCmd, message.HistoryForwardCmd:
+		return role == message.ClientRole
+	}
+
+	return false
+}
+
 func (s *Server) handleConfigSet(cmd *message.Command) error {
 	p := cmd.Payload
 
@@ -184,16 +462,13 @@ func (s *Server) handleConfigSet(cmd *message.Command) error {
 			return fmt.Errorf("could not find connected node with name %s", name)
 		}
 
-		c := &message.Command{
-			Op: message.ConfigSetCmd,
-			Payload: &message.CommandPayload{
-				ConfigSetPayload: &message.ConfigSetPayload{
-					Configs: map[string]message.NodeConfig{
-						name: cfg,
-					},
+		c := cmd.Derive(message.ConfigSetCmd, &message.CommandPayload{
+			ConfigSetPayload: &message.ConfigSetPayload{
+				Configs: map[string]message.NodeConfig{
+					name: cfg,
 				},
 			},
-		}
+		})
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -206,6 +481,14 @@ func (s *Server) handleConfigSet(cmd *message.Command) error {
 		if !resp.Success {
 			return fmt.Errorf("unable to set config on node %s: %s", name, resp.Error)
 		}
+
+		s.events.publish(message.Event{
+			Type:       message.ConfigChangedEvent,
+			Role:       conn.role,
+			RemoteAddr: conn.remoteAddr,
+			Node:       name,
+			TraceID:    cmd.TraceID,
+		})
 	}
 
 	return nil
@@ -217,7 +500,7 @@ func (s *Server) getConnInfoByName(name string) (*connInfo, bool) {
 
 	for gotID, chkConn := range s.conns {
 		if chkConn != nil && chkConn.nodeStatus != nil && chkConn.nodeStatus.Identity.Name == name {
-			log.Println("matched node by name", name, gotID)
+			slog.Debug("matched node by name", slog.String(logging.NodeKey, name), slog.String(logging.RemoteKey, gotID))
 			return chkConn, true
 		}
 	}
@@ -226,11 +509,33 @@ func (s *Server) getConnInfoByName(name string) (*connInfo, bool) {
 	return nil, false
 }
 
+func (s *Server) handleGetTrace(cmd *message.Command) (*message.ResponsePayload, error) {
+	p := cmd.Payload
+
+	if p == nil || p.GetTracePayload == nil {
+		return nil, errors.New("invalid get trace payload")
+	}
+
+	if s.tracer == nil {
+		return nil, errors.New("tracing is disabled on the server")
+	}
+
+	spans, err := trace.ReadTrace(s.tracer.Path(), p.GetTracePayload.TraceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message.ResponsePayload{
+		GetTraceResponse: &message.GetTraceResponsePayload{
+			Spans: spans,
+		},
+	}, nil
+}
+
 func (s *Server) handleListFiles(cmd *message.Command) (*message.ResponsePayload, error) {
 	var ret []message.FileInfo
 
 	err := filepath.Walk(s.imgDir, func(path string, info fs.FileInfo, err error) error {
-		fmt.Println("WALKED TO", path)
 		if err != nil {
 			return fmt.Errorf("walk error: %s", err)
 		}
@@ -270,13 +575,11 @@ func (s *Server) handleListFiles(cmd *message.Command) (*message.ResponsePayload
 		defer conn.mu.Unlock()
 
 		if conn.nodeStatus == nil || conn.nodeStatus.Identity.Role != message.NodeRole {
-			log.Printf("node %s is not connected to the filesystem", nodeName)
+			conn.logger().Debug("node is not connected to the filesystem")
 			continue
 		}
 
-		c := &message.Command{
-			Op: message.ListFilesCmd,
-		}
+		c := cmd.Derive(message.ListFilesCmd, nil)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -329,6 +632,8 @@ func (s *Server) handleGetImage(cmd *message.Command) (*message.ResponsePayload,
 		return nil, err
 	}
 
+	s.metrics.transferBytes.With("out", string(cmd.Op)).Add(float64(len(b)))
+
 	return &message.ResponsePayload{
 		GetImageResponse: &message.GetImageResponsePayload{
 			Name:      fileName,
@@ -338,167 +643,245 @@ func (s *Server) handleGetImage(cmd *message.Command) (*message.ResponsePayload,
 	}, nil
 }
 
-func (s *Server) handleShowImages(cmd *message.Command, c *connInfo) error {
+// handleShowImages shows images on nodes on behalf of by.
+func (s *Server) handleShowImages(cmd *message.Command, by string) (*message.ResponsePayload, error) {
 	p := cmd.Payload
 
 	if p == nil || p.ShowImagesPayload == nil {
-		return errors.New("invalid show images payload")
+		return nil, errors.New("invalid show images payload")
 	}
 
 	showImgPayload := p.ShowImagesPayload
 
 	if len(showImgPayload.Images) == 0 {
-		return errors.New("no images received")
+		return nil, errors.New("no images received")
 	}
 
-	for _, imgData := range showImgPayload.Images {
-		err := s.saveImage(imgData)
+	imgCfgs := make([]image.Config, len(showImgPayload.Images))
+	uploaded := make([]bool, len(showImgPayload.Images))
+	for i := range showImgPayload.Images {
+		imgData := &showImgPayload.Images[i]
+
+		uploaded[i] = len(imgData.Data) > 0
+		if err := s.resolveImage(imgData); err != nil {
+			return nil, err
+		}
+
+		cfg, err := s.validateImage(*imgData)
 		if err != nil {
-			return fmt.Errorf("error saving image %s: %s", imgData.Name, err)
+			return nil, err
 		}
+
+		imgCfgs[i] = cfg
 	}
 
-	s.connMu.RLock()
-	defer s.connMu.RUnlock()
+	for i, imgData := range showImgPayload.Images {
+		if !uploaded[i] || showImgPayload.DryRun {
+			continue
+		}
 
-	var filteredConns []*connInfo
+		s.metrics.transferBytes.With("in", string(cmd.Op)).Add(float64(len(imgData.Data)))
 
-	nodeSelectors := showImgPayload.NodeSelectors
-	for _, conn := range s.conns {
-		// Default assume match ANY
-		includeConn := true
-		for _, sel := range nodeSelectors {
-			match := connMatchesSelector(conn, sel)
-
-			switch sel.Logic {
-			case message.LogicAnd:
-				includeConn = includeConn && match
-			case message.LogicOr:
-				includeConn = includeConn || match
-			default:
-				includeConn = includeConn && match
-			}
+		err := s.saveImage(imgData)
+		if err != nil {
+			return nil, fmt.Errorf("error saving image %s: %s", imgData.Name, err)
 		}
+	}
 
-		if includeConn {
-			filteredConns = append(filteredConns, conn)
+	if showImgPayload.Wall != "" {
+		results, err := s.showOnWall(cmd, showImgPayload, by)
+		if showImgPayload.DryRun {
+			// Problems are part of the plan.
+			err = nil
 		}
+
+		return showResponse(results), err
 	}
 
-	if len(filteredConns) == 0 {
-		return errors.New("no nodes are eligible to display")
+	// Don't hold connMu for the reveal, which waits on every node.
+	s.connMu.RLock()
+	conns := s.connsByNameLocked()
+	s.connMu.RUnlock()
+
+	sel, err := compileSelectors(showImgPayload.NodeSelectors, showImgPayload.Selector)
+	if err != nil {
+		return nil, err
 	}
 
-	lnodes, pnodes := filterOrientations(filteredConns)
+	var (
+		errs    []error
+		targets []revealTarget
+		placed  []int // The image index of each target.
+	)
 
-	var errs []error
+	results := make([]message.ShowResult, len(showImgPayload.Images))
+	for i, imgData := range showImgPayload.Images {
+		results[i] = message.ShowResult{
+			Image:  imgData.Name,
+			Status: message.ShowUnplaced,
+		}
+	}
 
-	lastImgIdx := len(showImgPayload.Images) - 1
+	// Images given a node go straight to it.
+	assigned := make(map[string]bool)
+	allocate := 0
+	for i := range showImgPayload.Images {
+		if i >= len(showImgPayload.Nodes) || showImgPayload.Nodes[i] == "" {
+			allocate++
+			continue
+		}
 
-	for i := lastImgIdx; i >= 0; i-- {
-		imgData := showImgPayload.Images[i]
-		b := bytes.NewBuffer(imgData.Data)
+		name := showImgPayload.Nodes[i]
+		assigned[name] = true
+
+		conn := connNamed(conns, name)
+
+		var err error
+		switch {
+		case conn == nil:
+			err = fmt.Errorf("node %s is not connected", name)
+		case !conn.displayReady():
+			err = fmt.Errorf("node %s is not ready to display", name)
+		}
 
-		img, _, err := image.Decode(b)
 		if err != nil {
-			return fmt.Errorf("decoding image data: %s", err)
+			results[i].Node = name
+			results[i].Status = message.ShowFailed
+			results[i].Error = err.Error()
+			errs = append(errs, err)
+			continue
+		}
+
+		conn.logger().Info("displaying image on assigned node", "image", showImgPayload.Images[i].Name)
+
+		targets = append(targets, revealTarget{
+			conn:     conn,
+			imgData:  showImgPayload.Images[i],
+			fit:      showImgPayload.FitPolicy,
+			by:       by,
+			ttl:      showImgPayload.TTL,
+			priority: showImgPayload.Priority,
+		})
+		placed = append(placed, i)
+	}
+
+	var filteredConns []*connInfo
+	for _, conn := range conns {
+		if !assigned[conn.peerName()] && !s.modes.excluded(conn) && connMatchesSelector(conn, sel) {
+			filteredConns = append(filteredConns, conn)
 		}
+	}
 
-		rect := img.Bounds()
+	if allocate > 0 && len(filteredConns) == 0 && len(assigned) == 0 {
+		return nil, errors.New("no nodes are eligible to display")
+	}
 
-		log.Printf("image %s is %dx%d", imgData.Name, rect.Dx(), rect.Dy())
+	nodes, readyConns := assignNodes(filteredConns)
 
-		prefer, backup := &pnodes, &lnodes
-		if rect.Dx() > rect.Dy() {
-			prefer, backup = backup, prefer
+	// Later images take precedence when there are more images than nodes.
+	var (
+		imgs   []assign.Image
+		imgIdx []int
+	)
+
+	for i := len(showImgPayload.Images) - 1; i >= 0; i-- {
+		if i < len(showImgPayload.Nodes) && showImgPayload.Nodes[i] != "" {
+			continue
 		}
 
-		var displayOnNode *connInfo
-		if len(*prefer) > 0 {
-			// Display available in preferred orientation
-			displayOnNode = (*prefer)[0]
-			*prefer = (*prefer)[1:]
+		imgData := showImgPayload.Images[i]
+		imgCfg := imgCfgs[i]
+
+		slog.Debug("sizing image", "image", imgData.Name, "width", imgCfg.Width, "height", imgCfg.Height)
+
+		imgs = append(imgs, assign.Image{
+			Name:   imgData.Name,
+			Hash:   imgData.Hash,
+			Width:  imgCfg.Width,
+			Height: imgCfg.Height,
+		})
+		imgIdx = append(imgIdx, i)
+	}
 
-			log.Printf("displaying image %s in preferred orientation on %s", imgData.Name, displayOnNode.remoteAddr)
+	for k, j := range s.assigner(showImgPayload).Assign(imgs, nodes) {
+		i := imgIdx[k]
+		imgData := showImgPayload.Images[i]
 
-		} else {
+		if j < 0 {
 			if showImgPayload.MustFitOrientation {
-				errs = append(errs, fmt.Errorf("orientation mismatch: no preferred orientation nodes found to display %s", imgData.Name))
-				continue
+				err := fmt.Errorf("orientation mismatch: no preferred orientation nodes found to display %s", imgData.Name)
+				results[i].Error = err.Error()
+				errs = append(errs, err)
 			}
 
-			if len(*backup) == 0 {
-				// No more nodes to display images. We're done.
-				break
-			}
+			continue
+		}
+
+		readyConns[j].logger().Info("displaying assigned image", "image", imgData.Name, "strategy", showImgPayload.Assign)
 
-			displayOnNode = (*backup)[0]
-			*backup = (*backup)[1:]
+		targets = append(targets, revealTarget{
+			conn:     readyConns[j],
+			imgData:  imgData,
+			fit:      showImgPayload.FitPolicy,
+			by:       by,
+			ttl:      showImgPayload.TTL,
+			priority: showImgPayload.Priority,
+		})
+		placed = append(placed, i)
+	}
 
-			log.Printf("displaying image %s in unpreferred orientation on %s", imgData.Name, displayOnNode.remoteAddr)
+	if showImgPayload.DryRun {
+		for j, res := range s.plan(targets, showImgPayload.Force) {
+			results[placed[j]] = res
 		}
 
-		err = s.displayOverConn(imgData, displayOnNode, showImgPayload.FitPolicy)
+		// Problems are part of the plan.
+		return showResponse(results), nil
+	}
+
+	if len(targets) > 0 {
+		res, err := s.reveal(cmd, targets, showImgPayload.Force, false)
 		if err != nil {
 			errs = append(errs, err)
 		}
-	}
 
-	var retErr error
-	for _, err := range errs {
-		if retErr == nil {
-			retErr = err
-			continue
+		for j, i := range placed {
+			results[i] = res[j]
 		}
-
-		retErr = fmt.Errorf("AND %s", err)
 	}
 
-	return retErr
+	return showResponse(results), errors.Join(errs...)
 }
 
-func connMatchesSelector(conn *connInfo, sel message.NodeSelector) bool {
-	switch sel.Key {
-	case message.MatchAnySelKey:
-		return true
-	case message.MatchNoneSelKey:
-		return false
-	case message.NameSelKey, message.NameEqualsSelKey:
-		return sel.Value == conn.nodeStatus.Identity.Name
-	case message.NameContainsSelKey:
-		return strings.Contains(conn.nodeStatus.Identity.Name, sel.Value)
-	case message.HasLabelSelKey:
-		return hasLabel(conn, sel.Value)
+func showResponse(results []message.ShowResult) *message.ResponsePayload {
+	return &message.ResponsePayload{
+		ShowImagesResponse: &message.ShowImagesResponsePayload{
+			Results: results,
+		},
 	}
-
-	return false
 }
 
-func hasLabel(conn *connInfo, label string) bool {
-	for _, connLabel := range conn.nodeStatus.Identity.Labels {
-		if connLabel == label {
-			return true
+// connNamed returns the conn of the named node among conns, or nil.
+func connNamed(conns []*connInfo, name string) *connInfo {
+	for _, conn := range conns {
+		if conn.peerName() == name {
+			return conn
 		}
 	}
-	return false
-}
 
-func filterOrientations(conns []*connInfo) (l, p []*connInfo) {
-	for _, c := range conns {
-		if c.nodeStatus == nil || c.nodeStatus.Identity.Display == nil || !c.nodeStatus.Identity.Display.DisplayResponding {
-			log.Printf("ignoring node %s, not ready", c.remoteAddr)
-			continue
-		}
+	return nil
+}
 
-		if isPortrait(c.nodeStatus.Identity) {
-			p = append(p, c)
-			continue
+// nodeConnLocked returns the conn of the named node, or nil. The caller
+// holds connMu.
+func (s *Server) nodeConnLocked(name string) *connInfo {
+	for _, conn := range s.conns {
+		if conn.peerName() == name {
+			return conn
 		}
-
-		l = append(l, c)
 	}
 
-	return
+	return nil
 }
 
 func isPortrait(identity message.Identity) bool {
@@ -512,43 +895,159 @@ func isPortrait(identity message.Identity) bool {
 	return false
 }
 
-func (s *Server) displayOverConn(imgData message.ImageData, conn *connInfo, fitPolicy message.FitPolicy) error {
-	// connInfo should be already locked
-	t := conn.t
+// displayOverConn shows a stored image chosen by a schedule or playlist on a
+// node on behalf of by. Displays held back by an alert or, unless forced, the
+// node's quiet hours or refresh budget are deferred and nil is returned.
+func (s *Server) displayOverConn(parent *message.Command, imgData message.ImageData, conn *connInfo, fitPolicy message.FitPolicy, force bool, by string) error {
+	_, err := s.showOverConn(parent, revealTarget{conn: conn, imgData: imgData, fit: fitPolicy, by: by, scheduled: true}, force)
+	return err
+}
 
-	sat := float64(0.5)
+// showOverConn is displayOverConn for a target, also reporting whether the
+// image was shown rather than deferred.
+func (s *Server) showOverConn(parent *message.Command, target revealTarget, force bool) (bool, error) {
+	t := target.conn.t
 
-	c := &message.Command{
-		Op: message.SetImageCmd,
-		Payload: &message.CommandPayload{
-			SetImagePayload: &message.SetImagePayload{
-				Name:       imgData.Name,
-				Hash:       imgData.Hash,
-				Saturation: &sat,
-				FitPolicy:  fitPolicy,
-			},
-		},
+	setImg := target.setImagePayload()
+	c := parent.Derive(message.SetImageCmd, &message.CommandPayload{
+		SetImagePayload: &setImg,
+	})
+
+	if ok, err := s.admit(target, force, c.TraceID); !ok {
+		return false, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
+	start := time.Now()
+
 	resp, err := t.SendCommandWaitResponse(ctx, c)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if !resp.Success {
-		return fmt.Errorf("failed to display image: %s", resp.Error)
+		return false, fmt.Errorf("failed to display image: %s", resp.Error)
+	}
+
+	s.displayed(target, c.TraceID, time.Since(start))
+
+	return true, nil
+}
+
+// displayed records that the target's display finished refreshing to its
+// image.
+func (s *Server) displayed(t revealTarget, traceID string, refresh time.Duration) {
+	conn, imgData := t.conn, t.imgData
+
+	s.metrics.refresh.With(conn.peerName()).Observe(refresh.Seconds())
+	s.sticky.Shown(assign.Image{Name: imgData.Name, Hash: imgData.Hash}, conn.peerName())
+
+	shown := message.ShownImage{
+		Name:        imgData.Name,
+		Hash:        imgData.Hash,
+		FitPolicy:   t.fit,
+		Saturation:  t.saturationOrDefault(),
+		RotationDeg: conn.rotation(),
+		ShownTime:   time.Now(),
+		ShownBy:     t.by,
+	}
+
+	conn.mu.Lock()
+	var prev *message.ShownImage
+	if conn.nodeStatus != nil {
+		prev = conn.nodeStatus.Showing
+		conn.nodeStatus.Showing = &shown
+	}
+	conn.mu.Unlock()
+
+	s.alerts.displayed(t, prev)
+
+	if err := s.displays.set(conn.peerName(), shown); err != nil {
+		conn.logger().Warn("saving what node is showing", logging.Err(err))
+	}
+
+	if err := s.history.record(conn.peerName(), shown, t.move, t.from); err != nil {
+		conn.logger().Warn("saving node display history", logging.Err(err))
+	}
+
+	s.events.publish(message.Event{
+		Type:       message.ImageShownEvent,
+		Role:       conn.role,
+		RemoteAddr: conn.remoteAddr,
+		Node:       conn.peerName(),
+		Image:      imgData.Name,
+		TraceID:    traceID,
+	})
+}
+
+// resolveImage loads images sent without data from the server's image store,
+// and fills in the hash of uploaded images that arrive without one.
+func (s *Server) resolveImage(imgData *message.ImageData) error {
+	if len(imgData.Data) > 0 {
+		if imgData.Hash != "" {
+			return nil
+		}
+
+		h, err := hash.HashBytes(imgData.Data)
+		imgData.Hash = h
+		return err
 	}
 
+	b, h, err := hash.ReadHashFile(s.imgFilePath(imgData.Name))
+	if err != nil {
+		return fmt.Errorf("image %s was sent without data and is not stored on the server", imgData.Name)
+	}
+
+	imgData.Data, imgData.Hash = b, h
+
 	return nil
 }
 
+// validateImage checks that image data may be stored and displayed.
+func (s *Server) validateImage(imgData message.ImageData) (image.Config, error) {
+	if err := message.ValidateFileName(imgData.Name); err != nil {
+		return image.Config{}, err
+	}
+
+	cfg, _, err := imaging.Validate(imgData.Data, s.imgLimits)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("invalid image %s: %s", imgData.Name, err)
+	}
+
+	return cfg, nil
+}
+
+// storeUpload saves a validated image uploaded outside of a show request.
+func (s *Server) storeUpload(imgData message.ImageData) (message.FileInfo, error) {
+	if err := s.saveImage(imgData); err != nil {
+		return message.FileInfo{}, fmt.Errorf("error saving image %s: %s", imgData.Name, err)
+	}
+
+	s.metrics.transferBytes.With("in", uploadTransfer).Add(float64(len(imgData.Data)))
+
+	return message.FileInfo{
+		Name:    imgData.Name,
+		Size:    int64(len(imgData.Data)),
+		ModTime: time.Now(),
+		Hash:    imgData.Hash,
+	}, nil
+}
+
 func (s *Server) saveImage(imgData message.ImageData) error {
 	fullPath := s.imgFilePath(imgData.Name)
 
-	return os.WriteFile(fullPath, imgData.Data, 0644)
+	if err := os.WriteFile(fullPath, imgData.Data, 0644); err != nil {
+		return err
+	}
+
+	s.events.publish(message.Event{
+		Type:  message.ImageStoredEvent,
+		Image: imgData.Name,
+	})
+
+	return nil
 }
 
 func (s *Server) imgFilePath(name string) string {
@@ -562,18 +1061,37 @@ func (s *Server) handleRegister(cmd *message.Command, c *connInfo) (*message.Res
 		return nil, errors.New("invalid register payload")
 	}
 
+	if role := p.RegisterPayload.Identity.Role; role != c.role {
+		return nil, fmt.Errorf("cannot register as %s on the %s endpoint", role, c.role)
+	}
+
 	arrTime := time.Now()
 	if cmd.ArriveTime != nil {
 		arrTime = *cmd.ArriveTime
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	name := cmd.Payload.RegisterPayload.Identity.Name
 
+	c.mu.Lock()
 	c.nodeStatus = &message.NodeStatus{
 		UpdateTime: arrTime,
 		Identity:   cmd.Payload.RegisterPayload.Identity,
+		Showing:    s.displays.get(name),
 	}
+	c.name.Store(name)
+	c.mu.Unlock()
+
+	s.events.publish(message.Event{
+		Type:       message.RegisteredEvent,
+		Role:       c.role,
+		RemoteAddr: c.remoteAddr,
+		Node:       name,
+		TraceID:    cmd.TraceID,
+	})
+
+	s.scheduler.nodeRegistered(name)
+	s.alerts.nodeRegistered(name)
+	s.refreshes.nodeRegistered(name)
 
 	return nil, nil
 }
@@ -581,9 +1099,16 @@ func (s *Server) handleRegister(cmd *message.Command, c *connInfo) (*message.Res
 func (s *Server) handleListNodes(cmd *message.Command) (*message.ResponsePayload, error) {
 	p := cmd.Payload
 
-	refreshIDs := false
+	refreshIDs, includeClients := false, false
+	var sel selector.Expr = selector.Const(true)
 	if p != nil && p.ListNodesPayload != nil {
 		refreshIDs = p.ListNodesPayload.RefreshIdentities
+		includeClients = p.ListNodesPayload.IncludeClients
+
+		var err error
+		if sel, err = compileSelectors(nil, p.ListNodesPayload.Selector); err != nil {
+			return nil, err
+		}
 	}
 
 	s.connMu.RLock()
@@ -592,15 +1117,15 @@ func (s *Server) handleListNodes(cmd *message.Command) (*message.ResponsePayload
 	if refreshIDs {
 		for remoteAddr, connInfo := range s.conns {
 			if connInfo == nil || connInfo.nodeStatus == nil || connInfo.nodeStatus.Identity.Role != message.NodeRole {
-				log.Println("skipping refresh for node", remoteAddr)
+				slog.Debug("skipping refresh for node", slog.String(logging.RemoteKey, remoteAddr))
 				continue
 			}
 
-			log.Println("sending id refresh for node", remoteAddr)
+			connInfo.logger().Debug("sending id refresh for node")
 
-			err := s.updateConnIdentity(connInfo)
+			err := s.updateConnIdentity(cmd, connInfo)
 			if err != nil {
-				log.Println("identify failed for", remoteAddr, "error:", err)
+				connInfo.logger().Warn("identify failed", logging.Err(err))
 				continue
 			}
 		}
@@ -608,24 +1133,48 @@ func (s *Server) handleListNodes(cmd *message.Command) (*message.ResponsePayload
 
 	nodeStatusMap := make(map[string]message.NodeStatus)
 	for remoteAddr, connInfo := range s.conns {
+		if !connMatchesSelector(connInfo, sel) {
+			continue
+		}
+
 		connInfo.mu.Lock()
 
-		if ns := connInfo.nodeStatus; ns != nil {
+		ns := connInfo.nodeStatus
+		if ns != nil {
 			nodeStatusMap[remoteAddr] = *ns
 		}
 
 		connInfo.mu.Unlock()
+
+		if ns != nil {
+			status := nodeStatusMap[remoteAddr]
+			status.Alert = s.alerts.get(status.Identity.Name)
+			status.NodeMode = s.modes.get(status.Identity.Name)
+			nodeStatusMap[remoteAddr] = status
+		}
+	}
+
+	var clientStatusMap map[string]message.ClientStatus
+	if includeClients {
+		clientStatusMap = make(map[string]message.ClientStatus)
+		for remoteAddr, connInfo := range s.clients {
+			clientStatusMap[remoteAddr] = message.ClientStatus{
+				RemoteAddr:  connInfo.remoteAddr,
+				ConnectTime: connInfo.connectTime,
+			}
+		}
 	}
 
 	return &message.ResponsePayload{
 		ListNodesResponse: &message.ListNodesResponsePayload{
-			Nodes: nodeStatusMap,
+			Nodes:   nodeStatusMap,
+			Clients: clientStatusMap,
 		},
 	}, nil
 }
 
-func (s *Server) updateConnIdentity(connInfo *connInfo) error {
-	ns, err := s.identifyOverConn(connInfo)
+func (s *Server) updateConnIdentity(parent *message.Command, connInfo *connInfo) error {
+	ns, err := s.identifyOverConn(parent, connInfo)
 	if err != nil {
 		return err
 	}
@@ -633,15 +1182,19 @@ func (s *Server) updateConnIdentity(connInfo *connInfo) error {
 	connInfo.mu.Lock()
 	defer connInfo.mu.Unlock()
 
+	// Identifying doesn't change what the node is showing.
+	if connInfo.nodeStatus != nil {
+		ns.Showing = connInfo.nodeStatus.Showing
+	}
+
 	connInfo.nodeStatus = ns
+	connInfo.name.Store(ns.Identity.Name)
 
 	return nil
 }
 
-func (s *Server) identifyOverConn(connInfo *connInfo) (*message.NodeStatus, error) {
-	c := &message.Command{
-		Op: message.IdentifyCmd,
-	}
+func (s *Server) identifyOverConn(parent *message.Command, connInfo *connInfo) (*message.NodeStatus, error) {
+	c := parent.Derive(message.IdentifyCmd, nil)
 
 	resp, err := connInfo.t.SendCommand(c)
 	if err != nil {
@@ -687,9 +1240,12 @@ func (s *Server) handleIdentifyResponse(resp *message.Response, connInfo *connIn
 	}, nil
 }
 
-func setupRoutes(s *Server) {
+func setupRoutes(s *Server, wsPath string) {
 	http.HandleFunc("/", homePage)
-	http.HandleFunc("/ws", makeWSHandler(s))
+	http.Handle("/metrics", s.metrics.reg.Handler())
+	setupAPIRoutes(s)
+	http.HandleFunc(config.WebsocketPath(wsPath, message.NodeRole), makeWSHandler(s, message.NodeRole))
+	http.HandleFunc(config.WebsocketPath(wsPath, message.ClientRole), makeWSHandler(s, message.ClientRole))
 }
 
 var upgrader = websocket.Upgrader{
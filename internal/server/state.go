@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// loadState decodes a JSON file in the state dir into v, leaving v alone if
+// the file doesn't exist yet.
+func loadState(dir, file string, v any) error {
+	path := filepath.Join(dir, file)
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("reading %s: %s", path, err)
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("decoding %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// saveState atomically replaces a JSON file in the state dir with v.
+func saveState(dir, file string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, file)
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("writing %s: %s", path, err)
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redgoat650/barnacle-net/internal/hash"
+	"github.com/redgoat650/barnacle-net/internal/imaging"
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+const (
+	wallsFile = "walls.json"
+)
+
+// wallStore holds the walls images can be tiled across, persisted to the
+// state dir.
+type wallStore struct {
+	dir string
+
+	mu    *sync.Mutex
+	walls map[string]*message.Wall
+}
+
+func newWallStore(stateDir string) (*wallStore, error) {
+	ws := &wallStore{
+		dir:   stateDir,
+		mu:    new(sync.Mutex),
+		walls: make(map[string]*message.Wall),
+	}
+
+	if err := loadState(stateDir, wallsFile, &ws.walls); err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+func (ws *wallStore) set(w message.Wall) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.walls[w.Name] = &w
+
+	return saveState(ws.dir, wallsFile, ws.walls)
+}
+
+func (ws *wallStore) delete(name string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.walls[name]; !ok {
+		return fmt.Errorf("no wall named %s", name)
+	}
+
+	delete(ws.walls, name)
+
+	return saveState(ws.dir, wallsFile, ws.walls)
+}
+
+func (ws *wallStore) get(name string) (message.Wall, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	w, ok := ws.walls[name]
+	if !ok {
+		return message.Wall{}, false
+	}
+
+	return *w, true
+}
+
+func (ws *wallStore) list() []message.Wall {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	var ret []message.Wall
+	for _, w := range ws.walls {
+		ret = append(ret, *w)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+
+	return ret
+}
+
+// showOnWall slices the payload's image into a tile for each member of its
+// wall, sized to the member's display as it is hung, and reveals them all at
+// once, returning what became of each tile. Members that aren't connected
+// are reported but don't stop the others. Dry runs only plan the tiles.
+func (s *Server) showOnWall(cmd *message.Command, p *message.ShowImagesPayload, by string) ([]message.ShowResult, error) {
+	imgData, fit := p.Images[0], p.FitPolicy
+
+	wall, ok := s.walls.get(p.Wall)
+	if !ok {
+		return nil, fmt.Errorf("no wall named %s", p.Wall)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(imgData.Data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image %s: %s", imgData.Name, err)
+	}
+
+	var (
+		errs    []error
+		results []message.ShowResult
+		conns   []*connInfo
+		specs   []imaging.TileSpec
+		bbox    imaging.Rect
+	)
+
+	fail := func(node string, err error) {
+		errs = append(errs, err)
+		results = append(results, message.ShowResult{
+			Image:  imgData.Name,
+			Node:   node,
+			Status: message.ShowFailed,
+			Error:  err.Error(),
+		})
+	}
+
+	for i, m := range wall.Members {
+		frame := imaging.Rect{X: m.X, Y: m.Y, W: m.Width, H: m.Height}
+		if i == 0 {
+			bbox = frame
+		}
+		bbox = bbox.Union(frame)
+
+		conn, found := s.getConnInfoByName(m.Node)
+		if !found {
+			fail(m.Node, fmt.Errorf("wall member %s is not connected", m.Node))
+			continue
+		}
+
+		w, h, err := conn.hungResolution()
+		if err != nil {
+			fail(m.Node, fmt.Errorf("wall member %s: %s", m.Node, err))
+			continue
+		}
+
+		conns = append(conns, conn)
+		specs = append(specs, imaging.TileSpec{
+			Area: imaging.Rect{
+				X: m.X + m.Bezel,
+				Y: m.Y + m.Bezel,
+				W: m.Width - 2*m.Bezel,
+				H: m.Height - 2*m.Bezel,
+			},
+			Width:  w,
+			Height: h,
+		})
+	}
+
+	base := strings.TrimSuffix(imgData.Name, filepath.Ext(imgData.Name))
+
+	tileName := func(conn *connInfo) string {
+		return fmt.Sprintf("%s.%s.%s.png", base, fileSafe(wall.Name), fileSafe(conn.peerName()))
+	}
+
+	var targets []revealTarget
+
+	if p.DryRun {
+		for _, conn := range conns {
+			targets = append(targets, revealTarget{
+				conn:     conn,
+				imgData:  message.ImageData{Name: tileName(conn)},
+				fit:      message.CropToFit,
+				ttl:      p.TTL,
+				priority: p.Priority,
+			})
+		}
+
+		return append(results, s.plan(targets, p.Force)...), nil
+	}
+
+	for i, img := range imaging.TileWall(src, bbox, fit == message.PadToFit, specs) {
+		tile, err := s.storeTile(tileName(conns[i]), img)
+		if err != nil {
+			return results, err
+		}
+
+		conns[i].logger().Info("displaying wall tile", "wall", wall.Name, "image", tile.Name)
+
+		// Tiles already match the display, so cropping only rounds off any
+		// difference between the measured and actual aspect.
+		targets = append(targets, revealTarget{
+			conn:     conns[i],
+			imgData:  tile,
+			fit:      message.CropToFit,
+			by:       fmt.Sprintf("%s on wall %s", by, wall.Name),
+			ttl:      p.TTL,
+			priority: p.Priority,
+		})
+	}
+
+	if len(targets) > 0 {
+		res, err := s.reveal(cmd, targets, p.Force, false)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		results = append(results, res...)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// fileSafe replaces the path separators in a wall or node name so it can be
+// part of a file name.
+func fileSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// storeTile encodes a tile and saves it to the image store for its node to
+// download.
+func (s *Server) storeTile(name string, img image.Image) (message.ImageData, error) {
+	if err := message.ValidateFileName(name); err != nil {
+		return message.ImageData{}, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return message.ImageData{}, fmt.Errorf("encoding tile %s: %s", name, err)
+	}
+
+	h, err := hash.HashBytes(buf.Bytes())
+	if err != nil {
+		return message.ImageData{}, err
+	}
+
+	tile := message.ImageData{
+		Name: name,
+		Hash: h,
+		Data: buf.Bytes(),
+	}
+
+	if err := s.saveImage(tile); err != nil {
+		return message.ImageData{}, fmt.Errorf("error saving tile %s: %s", name, err)
+	}
+
+	return tile, nil
+}
+
+// hungResolution returns the node's display resolution in pixels as it is
+// hung, so portrait displays are taller than they are wide.
+func (c *connInfo) hungResolution() (int, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.nodeStatus == nil || c.nodeStatus.Identity.Display == nil {
+		return 0, 0, errors.New("display not identified")
+	}
+
+	id := c.nodeStatus.Identity
+
+	w, h := id.Display.Width, id.Display.Height
+	if w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("display reports invalid resolution %dx%d", w, h)
+	}
+
+	if isPortrait(id) == (w > h) {
+		w, h = h, w
+	}
+
+	return w, h, nil
+}
+
+func (s *Server) handleWallSet(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.WallSetPayload == nil {
+		return errors.New("invalid wall set payload")
+	}
+
+	return s.walls.set(p.WallSetPayload.Wall)
+}
+
+func (s *Server) handleWallDelete(cmd *message.Command) error {
+	p := cmd.Payload
+
+	if p == nil || p.WallDeletePayload == nil {
+		return errors.New("invalid wall delete payload")
+	}
+
+	return s.walls.delete(p.WallDeletePayload.Name)
+}
+
+func (s *Server) handleListWalls(cmd *message.Command) (*message.ResponsePayload, error) {
+	return &message.ResponsePayload{
+		ListWallsResponse: &message.ListWallsResponsePayload{
+			Walls: s.walls.list(),
+		},
+	}, nil
+}
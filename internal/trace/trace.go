@@ -0,0 +1,192 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redgoat650/barnacle-net/internal/message"
+)
+
+// NewID returns a random identifier for a trace or span.
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recorder receives spans as command/response exchanges complete.
+type Recorder interface {
+	Record(sp message.Span)
+}
+
+type RecorderFunc func(sp message.Span)
+
+func (f RecorderFunc) Record(sp message.Span) {
+	f(sp)
+}
+
+// FileRecorder appends spans to a file as JSON lines.
+type FileRecorder struct {
+	path string
+	f    *os.File
+	mu   *sync.Mutex
+}
+
+func NewFileRecorder(path string) (*FileRecorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %s", err)
+	}
+
+	return &FileRecorder{
+		path: path,
+		f:    f,
+		mu:   new(sync.Mutex),
+	}, nil
+}
+
+func (r *FileRecorder) Path() string {
+	return r.path
+}
+
+func (r *FileRecorder) Record(sp message.Span) {
+	b, err := json.Marshal(sp)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.f.Write(append(b, '\n'))
+}
+
+func (r *FileRecorder) Close() error {
+	return r.f.Close()
+}
+
+// ReadTrace returns every span recorded in the JSON lines file at path for
+// the given trace, in submit order.
+func ReadTrace(path, traceID string) ([]message.Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %s", err)
+	}
+	defer f.Close()
+
+	var ret []message.Span
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		// Cheap check before decoding every line.
+		if !strings.Contains(sc.Text(), traceID) {
+			continue
+		}
+
+		sp := message.Span{}
+		if err := json.Unmarshal(sc.Bytes(), &sp); err != nil {
+			return nil, fmt.Errorf("decoding span: %s", err)
+		}
+
+		if sp.TraceID == traceID {
+			ret = append(ret, sp)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading trace file: %s", err)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return timeOrZero(ret[i].SubmitTime).Before(timeOrZero(ret[j].SubmitTime))
+	})
+
+	return ret, nil
+}
+
+// PrintTree writes the spans of a trace as an indented tree with per-hop
+// latencies. Spans whose parent was not recorded are printed as roots.
+func PrintTree(w io.Writer, spans []message.Span) {
+	ids := make(map[string]bool)
+	for _, sp := range spans {
+		ids[sp.SpanID] = true
+	}
+
+	children := make(map[string][]message.Span)
+	var roots []message.Span
+	for _, sp := range spans {
+		if sp.ParentID == "" || !ids[sp.ParentID] {
+			roots = append(roots, sp)
+			continue
+		}
+		children[sp.ParentID] = append(children[sp.ParentID], sp)
+	}
+
+	var print func(sp message.Span, depth int)
+	print = func(sp message.Span, depth int) {
+		fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), describe(sp))
+		for _, child := range children[sp.SpanID] {
+			print(child, depth+1)
+		}
+	}
+
+	for _, root := range roots {
+		print(root, 0)
+	}
+}
+
+func describe(sp message.Span) string {
+	from, to := sp.Peer, "server"
+	if sp.Kind == message.SentSpan {
+		from, to = to, from
+	}
+
+	var hops []string
+	if d, ok := between(sp.SubmitTime, sp.ArriveTime); ok {
+		hops = append(hops, "out "+d.String())
+	}
+	if d, ok := between(sp.ArriveTime, sp.RespondTime); ok {
+		hops = append(hops, "handle "+d.String())
+	}
+	if d, ok := between(sp.RespondTime, sp.DoneTime); ok {
+		hops = append(hops, "back "+d.String())
+	}
+
+	ret := fmt.Sprintf("%s %s -> %s [%s]", sp.Op, from, to, sp.SpanID)
+	if total, ok := between(sp.SubmitTime, sp.DoneTime); ok {
+		ret += " total " + total.String()
+	}
+	if len(hops) > 0 {
+		ret += " (" + strings.Join(hops, ", ") + ")"
+	}
+	if sp.Error != "" {
+		ret += " error: " + sp.Error
+	}
+
+	return ret
+}
+
+func between(start, end *time.Time) (time.Duration, bool) {
+	if start == nil || end == nil {
+		return 0, false
+	}
+
+	return end.Sub(*start), true
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
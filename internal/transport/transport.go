@@ -2,16 +2,19 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/redgoat650/barnacle-net/internal/inflight"
+	"github.com/redgoat650/barnacle-net/internal/logging"
 	"github.com/redgoat650/barnacle-net/internal/message"
+	"github.com/redgoat650/barnacle-net/internal/trace"
 )
 
 const (
@@ -21,43 +24,107 @@ const (
 type Transport struct {
 	incomingCmds chan *message.Command
 	inflight     *inflight.Inflight
-	conn         *websocket.Conn
+	conn         Conn
 	wMu          *sync.Mutex
+	limits       Limits
+	recorder     trace.Recorder
+	log          *slog.Logger
 
 	stopping bool
 	stopMu   *sync.RWMutex
 }
 
-func NewTransportConn(server, path string) (*Transport, error) {
-	// Dial the websocket at host/path.
+// Conn is the subset of *websocket.Conn used by a Transport. It lets callers
+// wrap the underlying connection, e.g. to inject faults for testing.
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteJSON(v any) error
+	WriteMessage(messageType int, data []byte) error
+	SetReadLimit(limit int64)
+	Close() error
+}
+
+// Limits bounds the size in bytes of incoming messages. Responses are limited
+// by the op of the command they answer.
+type Limits struct {
+	Default int64
+	PerOp   map[message.Op]int64
+}
+
+// Options configures a Transport.
+type Options struct {
+	Limits Limits
+
+	// Recorder, if set, receives a span for every traced command this
+	// transport handles or sends.
+	Recorder trace.Recorder
+
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// ForOp returns the size limit for messages of the given op.
+func (l Limits) ForOp(op message.Op) int64 {
+	if lim, ok := l.PerOp[op]; ok {
+		return lim
+	}
+
+	return l.Default
+}
+
+// max returns the largest limit for any op, or zero if unlimited.
+func (l Limits) max() int64 {
+	ret := l.Default
+	for _, lim := range l.PerOp {
+		if lim > ret {
+			ret = lim
+		}
+	}
+
+	return ret
+}
+
+// Dial opens a websocket connection to host/path.
+func Dial(server, path string) (*websocket.Conn, error) {
 	URL := url.URL{Scheme: "ws", Host: server, Path: path}
 	c, _, err := websocket.DefaultDialer.Dial(URL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	t := &Transport{
-		incomingCmds: make(chan *message.Command, 5),
-		inflight:     inflight.NewInflight(),
-		conn:         c,
-		wMu:          new(sync.Mutex),
-		stopMu:       new(sync.RWMutex),
-	}
+	return c, nil
+}
 
-	go t.listen()
+func NewTransportConn(server, path string, opts Options) (*Transport, error) {
+	c, err := Dial(server, path)
+	if err != nil {
+		return nil, err
+	}
 
-	return t, nil
+	return NewTransportForConn(c, opts), nil
 }
 
-func NewTransportForConn(c *websocket.Conn) *Transport {
+func NewTransportForConn(c Conn, opts Options) *Transport {
 	t := &Transport{
 		incomingCmds: make(chan *message.Command, 5),
 		inflight:     inflight.NewInflight(),
 		conn:         c,
 		wMu:          new(sync.Mutex),
+		limits:       opts.Limits,
+		recorder:     opts.Recorder,
+		log:          opts.Logger,
 		stopMu:       new(sync.RWMutex),
 	}
 
+	if t.log == nil {
+		t.log = slog.Default()
+	}
+
+	// Hard cap; anything larger than the most generous op limit closes the conn.
+	if max := t.limits.max(); max > 0 {
+		c.SetReadLimit(max)
+	}
+
 	go t.listen()
 
 	return t
@@ -81,7 +148,7 @@ func (t *Transport) GracefullyClose() error {
 	// Mark this transport as in the process of shutting down.
 	t.shutdown()
 
-	log.Println("sending close message to websocket")
+	t.log.Debug("sending close message to websocket")
 	err := t.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -118,12 +185,23 @@ func (t *Transport) IncomingCmds() <-chan *message.Command {
 	return t.incomingCmds
 }
 
+// Inflight returns the number of sent commands awaiting a response.
+func (t *Transport) Inflight() int {
+	return t.inflight.Len()
+}
+
+// QueueDepth returns the number of received commands not yet picked up by
+// the owner of the transport.
+func (t *Transport) QueueDepth() int {
+	return len(t.incomingCmds)
+}
+
 func (t *Transport) handleClosedWebsocket() {
 	// Accept no more outgoing commands.
 	t.shutdown()
 
 	// Formally close the websocket
-	log.Println("websocket close:", t.conn.Close())
+	t.log.Debug("websocket closed", logging.Err(t.conn.Close()))
 
 	// Notify anyone waiting on a response that no response will be arriving.
 	t.sendClosingRepliesToAllInflight()
@@ -136,30 +214,70 @@ func (t *Transport) listen() {
 	defer t.handleClosedWebsocket()
 
 	for {
-		err := t.readJSON()
+		err := t.readMessage()
 		if err != nil {
 			closeErr := &websocket.CloseError{}
 			if errors.As(err, &closeErr) {
 				if closeErr.Code == websocket.CloseNormalClosure {
-					log.Println("normal closure message received")
+					t.log.Debug("normal closure message received")
 					err = nil
 				}
 				return
 			}
 
-			log.Println("Error reading message from conn:", err)
+			t.log.Warn("error reading message from conn", logging.Err(err))
 			return
 		}
 	}
 }
 
-func (t *Transport) readJSON() error {
-	m := &message.Message{}
-	err := t.conn.ReadJSON(m)
+// header is the part of a message needed to apply per-op limits without
+// decoding the (possibly large) payload.
+type header struct {
+	Command *struct {
+		Op     message.Op `json:"op"`
+		Opaque uint64     `json:"opaque"`
+	} `json:"command,omitempty"`
+	Response *struct {
+		Command *struct {
+			Op     message.Op `json:"op"`
+			Opaque uint64     `json:"opaque"`
+		} `json:"command,omitempty"`
+	} `json:"response,omitempty"`
+}
+
+func (t *Transport) readMessage() error {
+	_, b, err := t.conn.ReadMessage()
 	if err != nil {
 		return err
 	}
 
+	h := &header{}
+	if err := json.Unmarshal(b, h); err != nil {
+		return fmt.Errorf("decoding message header: %s", err)
+	}
+
+	switch {
+	case h.Command != nil:
+		if lim := t.limits.ForOp(h.Command.Op); lim > 0 && int64(len(b)) > lim {
+			c := &message.Command{Op: h.Command.Op, Opaque: h.Command.Opaque}
+			return t.SendResponse(nil, fmt.Errorf("%s command of %d bytes exceeds limit of %d", c.Op, len(b), lim), c)
+		}
+	case h.Response != nil && h.Response.Command != nil:
+		if lim := t.limits.ForOp(h.Response.Command.Op); lim > 0 && int64(len(b)) > lim {
+			t.handleResponse(&message.Response{
+				Command: &message.Command{Op: h.Response.Command.Op, Opaque: h.Response.Command.Opaque},
+				Error:   fmt.Sprintf("%s response of %d bytes exceeds limit of %d", h.Response.Command.Op, len(b), lim),
+			})
+			return nil
+		}
+	}
+
+	m := &message.Message{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("decoding message: %s", err)
+	}
+
 	switch {
 	case m.Command != nil:
 		t.handleCommand(m.Command)
@@ -176,10 +294,17 @@ func (t *Transport) handleCommand(c *message.Command) {
 	tNow := time.Now()
 	c.ArriveTime = &tNow
 
+	if err := c.Validate(); err != nil {
+		if err := t.SendResponse(nil, fmt.Errorf("invalid %s command: %s", c.Op, err), c); err != nil {
+			logging.WithCommand(t.log, c).Warn("sending validation failure response", logging.Err(err))
+		}
+		return
+	}
+
 	if t.Stopping() {
 		err := t.SendResponse(nil, errors.New("not accepting commands due to closing websocket"), c)
 		if err != nil {
-			log.Println("Sending socket-closed response:", err)
+			logging.WithCommand(t.log, c).Warn("sending socket-closed response", logging.Err(err))
 		}
 		return
 	}
@@ -191,12 +316,27 @@ func (t *Transport) handleResponse(r *message.Response) {
 	tNow := time.Now()
 	r.ArriveTime = &tNow
 
+	if r.Command == nil {
+		t.log.Warn("response is missing its command")
+		return
+	}
+
 	ch, ok := t.inflight.Get(r.Command.Opaque)
 	if !ok {
-		log.Println("No one waiting for response")
+		logging.WithCommand(t.log, r.Command).Warn("no one waiting for response")
 		return
 	}
 
+	if err := r.Validate(); err != nil {
+		logging.WithCommand(t.log, r.Command).Warn("received invalid response", logging.Err(err))
+
+		r.Success = false
+		r.Error = fmt.Sprintf("invalid %s response: %s", r.Command.Op, err)
+		r.Payload = nil
+	}
+
+	t.recordSent(r)
+
 	ch <- r
 
 	close(ch)
@@ -229,6 +369,11 @@ func (t *Transport) SendCommand(c *message.Command) (<-chan *message.Response, e
 	tNow := time.Now()
 	c.SubmitTime = &tNow
 
+	if c.TraceID == "" {
+		c.TraceID = trace.NewID()
+	}
+	c.SpanID = trace.NewID()
+
 	id, ch := t.inflight.Register()
 	c.Opaque = id
 
@@ -262,9 +407,50 @@ func (t *Transport) SendResponse(rp *message.ResponsePayload, gotErr error, cmd
 		},
 	}
 
+	t.recordHandled(m.Response)
+
 	return t.sendMessage(m)
 }
 
+func (t *Transport) recordHandled(r *message.Response) {
+	if t.recorder == nil || r.Command == nil || r.Command.TraceID == "" {
+		return
+	}
+
+	c := r.Command
+	t.recorder.Record(message.Span{
+		TraceID:     c.TraceID,
+		SpanID:      c.SpanID,
+		ParentID:    c.ParentSpanID,
+		Op:          c.Op,
+		Kind:        message.HandledSpan,
+		Error:       r.Error,
+		SubmitTime:  c.SubmitTime,
+		ArriveTime:  c.ArriveTime,
+		RespondTime: r.SubmitTime,
+	})
+}
+
+func (t *Transport) recordSent(r *message.Response) {
+	if t.recorder == nil || r.Command.TraceID == "" {
+		return
+	}
+
+	c := r.Command
+	t.recorder.Record(message.Span{
+		TraceID:     c.TraceID,
+		SpanID:      c.SpanID,
+		ParentID:    c.ParentSpanID,
+		Op:          c.Op,
+		Kind:        message.SentSpan,
+		Error:       r.Error,
+		SubmitTime:  c.SubmitTime,
+		ArriveTime:  c.ArriveTime,
+		RespondTime: r.SubmitTime,
+		DoneTime:    r.ArriveTime,
+	})
+}
+
 func WaitOnResponse(respCh <-chan *message.Response, timeout time.Duration) (*message.Response, error) {
 	if timeout == 0 {
 		timeout = defaultWaitTimeout